@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"github.com/SUSE/HANA-Firewall/generator"
+	"sort"
+)
+
+// HANAProcesses are the command names of processes that serve HANA network services, even if they do not belong to an instance.
+var HANAProcesses = []string{
+	"hdbnameserver", "hdbindexserver", "hdbxsengine", "hdbcompileserver", "hdbpreprocessor", "hdbwebdispatcher",
+	"hdbdiserver", "hdbdocstore", "hdbesserver", "hdbscriptserver", "hdbdpserver", "hdbrsutil",
+	"sapstartsrv", "saphostexec", "sapwebdisp",
+}
+
+// ExpectedPort is a port opened by generated firewalld services.
+type ExpectedPort struct {
+	Protocol       string
+	Port           int
+	Services       []string // Services are the short names of firewalld services that open the port.
+	InstanceNumber string   // InstanceNumber is the HANA instance the port is calculated for, or empty if the port is shared by instances.
+}
+
+// key identifies a port of a protocol.
+type key struct {
+	protocol string
+	port     int
+}
+
+/*
+ExpectedPorts returns the ports opened by the firewalld services that GenerateConfig makes, sorted by protocol and port.
+The services are generated once for each instance number, so that every port is attributed to the instance it is
+calculated for. Ports that come out the same for more than one instance are not attributed to any instance.
+*/
+func ExpectedPorts(fw *generator.Firewalld) (ret []ExpectedPort, err error) {
+	ports := make(map[key]*ExpectedPort)
+	for _, instanceNumber := range fw.HANAGlobal.InstanceNumbers {
+		single := *fw
+		single.HANAGlobal.InstanceNumbers = []string{instanceNumber}
+		services, err := single.GenerateConfig()
+		if err != nil {
+			return nil, err
+		}
+		for shortName, svc := range services {
+			for _, port := range svc.Ports {
+				k := key{port.Protocol, port.Port}
+				expected, exists := ports[k]
+				if !exists {
+					expected = &ExpectedPort{Protocol: port.Protocol, Port: port.Port, InstanceNumber: instanceNumber}
+					ports[k] = expected
+				} else if expected.InstanceNumber != instanceNumber {
+					expected.InstanceNumber = ""
+				}
+				if !containsString(expected.Services, shortName) {
+					expected.Services = append(expected.Services, shortName)
+				}
+			}
+		}
+	}
+	ret = make([]ExpectedPort, 0, len(ports))
+	for _, expected := range ports {
+		sort.Strings(expected.Services)
+		ret = append(ret, *expected)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Protocol != ret[j].Protocol {
+			return ret[i].Protocol < ret[j].Protocol
+		}
+		return ret[i].Port < ret[j].Port
+	})
+	return
+}
+
+// Report tells the gaps between listening sockets and generated firewalld services, grouped by HANA instance number.
+type Report struct {
+	Uncovered map[string][]Socket       // Uncovered are HANA sockets reachable from network on ports that no generated service opens.
+	Unused    map[string][]ExpectedPort // Unused are ports opened by generated services, on which nothing listens.
+}
+
+// InstanceNumbers returns the instance numbers that have gaps in the report, the empty instance number comes last.
+func (report *Report) InstanceNumbers() []string {
+	all := make(map[string]struct{})
+	for instanceNumber := range report.Uncovered {
+		all[instanceNumber] = struct{}{}
+	}
+	for instanceNumber := range report.Unused {
+		all[instanceNumber] = struct{}{}
+	}
+	ret := make([]string, 0, len(all))
+	for instanceNumber := range all {
+		ret = append(ret, instanceNumber)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		// Sort the empty instance number to the end
+		return ret[i] != "" && (ret[j] == "" || ret[i] < ret[j])
+	})
+	return ret
+}
+
+// HasGaps returns true if any gap is found.
+func (report *Report) HasGaps() bool {
+	return len(report.Uncovered) > 0 || len(report.Unused) > 0
+}
+
+/*
+Compare finds HANA sockets that listen on ports not opened by any of the expected ports, and expected ports that nothing
+listens on. A socket belongs to HANA if its owner process belongs to an instance or is among HANAProcesses. Sockets that
+only listen on loopback addresses are not reachable from network, hence they are never reported as uncovered, however
+they do count as listening for the expected ports.
+*/
+func Compare(sockets []Socket, expected []ExpectedPort) *Report {
+	report := &Report{Uncovered: make(map[string][]Socket), Unused: make(map[string][]ExpectedPort)}
+	expectedKeys := make(map[key]struct{})
+	for _, port := range expected {
+		expectedKeys[key{port.Protocol, port.Port}] = struct{}{}
+	}
+	listening := make(map[key]struct{})
+	for _, sock := range sockets {
+		k := key{sock.Protocol, sock.Port}
+		listening[k] = struct{}{}
+		if _, covered := expectedKeys[k]; covered || sock.IsLoopback() {
+			continue
+		}
+		if sock.InstanceNumber != "" || containsString(HANAProcesses, sock.Process) {
+			report.Uncovered[sock.InstanceNumber] = append(report.Uncovered[sock.InstanceNumber], sock)
+		}
+	}
+	for _, port := range expected {
+		if _, found := listening[key{port.Protocol, port.Port}]; !found {
+			report.Unused[port.InstanceNumber] = append(report.Unused[port.InstanceNumber], port)
+		}
+	}
+	return report
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/generator"
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// writeProcFixture creates a fake proc file system with socket tables and processes owning sockets.
+func writeProcFixture(t *testing.T, procRoot string) {
+	hostOrderHex := func(ip net.IP) string {
+		// Format the address the same way as the kernel does on this host
+		ret := ""
+		for i := 0; i < len(ip); i += 4 {
+			ret += fmt.Sprintf("%08X", hostByteOrder.Uint32(ip[i:]))
+		}
+		return ret
+	}
+	lo4, any4, any6 := hostOrderHex(net.IPv4(127, 0, 0, 1).To4()), hostOrderHex(net.IPv4zero.To4()), hostOrderHex(net.IPv6zero)
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	files := map[string]string{
+		"net/tcp": header +
+			"   0: " + any4 + ":7539 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1001        0 101 1\n" + // 30009 nameserver
+			"   1: " + any4 + ":7547 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1001        0 102 1\n" + // 30023 indexserver
+			"   2: " + lo4 + ":754B 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1001        0 103 1\n" + // 30027 loopback
+			"   3: " + any4 + ":0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 104 1\n" + // 22 sshd
+			"   4: " + any4 + ":7541 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1001        0 105 1\n", // established
+		"net/tcp6": header +
+			"   0: " + any6 + ":FAEA 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1001        0 201 1\n", // 64234 sapstartsrv
+		"net/udp":     header,
+		"100/comm":    "hdbnameserver\n",
+		"100/cmdline": "/usr/sap/ABC/HDB00/exe/hdbnameserver\x00-port\x00",
+		"200/comm":    "hdbindexserver\n",
+		"200/cmdline": "hdbindexserver\x00-sid\x00ABC\x00/usr/sap/ABC/HDB00/exe\x00",
+		"300/comm":    "sshd\n",
+		"300/cmdline": "/usr/sbin/sshd\x00-D\x00",
+		"400/comm":    "sapstartsrv\n",
+		"400/cmdline": "/usr/sap/hostctrl/exe/sapstartsrv\x00pf=/usr/sap/hostctrl/exe/host_profile\x00",
+	}
+	for filePath, content := range files {
+		filePath = path.Join(procRoot, filePath)
+		if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"100/fd/3": "socket:[101]", "100/fd/4": "socket:[103]", "100/fd/5": "/dev/null",
+		"200/fd/7": "socket:[102]", "300/fd/3": "socket:[104]", "400/fd/9": "socket:[201]",
+	}
+	for link, target := range links {
+		link = path.Join(procRoot, link)
+		if err := os.MkdirAll(path.Dir(link), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadListeningSockets(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "hana-firewall-TestReadListeningSockets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+	writeProcFixture(t, procRoot)
+	sockets, err := ReadListeningSockets(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := make([]string, 0, len(sockets))
+	for _, sock := range sockets {
+		summary = append(summary, sock.String()+" instance "+sock.InstanceNumber)
+	}
+	if !reflect.DeepEqual(summary, []string{
+		"tcp 22 on 0.0.0.0 by sshd (pid 300) instance ",
+		"tcp 30009 on 0.0.0.0 by hdbnameserver (pid 100) instance 00",
+		"tcp 30023 on 0.0.0.0 by hdbindexserver (pid 200) instance 00",
+		"tcp 30027 on 127.0.0.1 by hdbnameserver (pid 100) instance 00",
+		"tcp 64234 on :: by sapstartsrv (pid 400) instance ",
+	}) {
+		t.Fatal(summary)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "hana-firewall-TestCompare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+	writeProcFixture(t, procRoot)
+	sockets, err := ReadListeningSockets(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw := &generator.Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00", "01"}},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "HANA database client", TCP: []string{"3__INST_NUM__13", "3__INST_NUM__15"}},
+			{FileBaseName: "HANA internal", TCP: []string{"3__INST_NUM__09", "22"}},
+		},
+	}
+	expected, err := ExpectedPorts(fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != 7 || !reflect.DeepEqual(expected[0], ExpectedPort{Protocol: "tcp", Port: 22, Services: []string{"hana-internal"}}) ||
+		!reflect.DeepEqual(expected[1], ExpectedPort{Protocol: "tcp", Port: 30009, Services: []string{"hana-internal"}, InstanceNumber: "00"}) {
+		t.Fatalf("%+v", expected)
+	}
+	report := Compare(sockets, expected)
+	if !report.HasGaps() || !reflect.DeepEqual(report.InstanceNumbers(), []string{"00", "01", ""}) {
+		t.Fatalf("%+v", report)
+	}
+	// Port 30023 of instance 00 is not covered, the loopback port 30027 and sshd are never reported
+	if len(report.Uncovered["00"]) != 1 || report.Uncovered["00"][0].Port != 30023 {
+		t.Fatalf("%+v", report.Uncovered)
+	}
+	// sapstartsrv of host agent is a HANA process outside of instances
+	if len(report.Uncovered[""]) != 1 || report.Uncovered[""][0].Port != 64234 || len(report.Uncovered) != 2 {
+		t.Fatalf("%+v", report.Uncovered)
+	}
+	unused := make(map[string][]int)
+	for instanceNumber, ports := range report.Unused {
+		for _, port := range ports {
+			unused[instanceNumber] = append(unused[instanceNumber], port.Port)
+		}
+	}
+	if !reflect.DeepEqual(unused, map[string][]int{"00": {30013, 30015}, "01": {30109, 30113, 30115}}) {
+		t.Fatal(unused)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Audit listening sockets against generated firewalld services.
+
+Listening sockets are read from /proc/net/tcp, tcp6, udp, and udp6, and mapped to their processes by looking for the
+socket inodes among /proc/<pid>/fd. A process belongs to a HANA instance if its command line mentions the instance
+directory HDB<instance number>.
+*/
+package audit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	tcpStateListen   = "0A" // tcpStateListen is the state of a listening TCP socket.
+	udpStateUnbound  = "07" // udpStateUnbound is the state of a UDP socket that is not connected to a peer.
+	socketLinkPrefix = "socket:["
+)
+
+// instanceInCmdline finds the HANA instance number in the command line of a process, such as /usr/sap/ABC/HDB00/exe/hdbnameserver.
+var instanceInCmdline = regexp.MustCompile(`HDB(\d\d)`)
+
+// Socket is a listening TCP socket or a bound UDP socket, along with the process that owns it.
+type Socket struct {
+	Protocol       string // Protocol is either "tcp" or "udp".
+	Address        net.IP
+	Port           int
+	Inode          uint64
+	PID            int    // PID of the owner process, or 0 if the owner is unknown.
+	Process        string // Process is the command name of the owner process.
+	InstanceNumber string // InstanceNumber is the HANA instance that the owner process belongs to, or empty if it does not.
+}
+
+// IsLoopback returns true if the socket can only be reached from the host itself.
+func (sock Socket) IsLoopback() bool {
+	return sock.Address.IsLoopback()
+}
+
+func (sock Socket) String() string {
+	owner := "unknown process"
+	if sock.PID != 0 {
+		owner = fmt.Sprintf("%s (pid %d)", sock.Process, sock.PID)
+	}
+	return fmt.Sprintf("%s %d on %s by %s", sock.Protocol, sock.Port, sock.Address, owner)
+}
+
+/*
+ReadListeningSockets reads listening TCP sockets and bound UDP sockets from the proc file system mounted at procRoot
+(usually /proc), and finds out their owner processes. Socket tables that do not exist, such as tcp6 on a host without
+IPv6, are skipped. The returned sockets are sorted by protocol and port.
+*/
+func ReadListeningSockets(procRoot string) (ret []Socket, err error) {
+	ret = make([]Socket, 0, 64)
+	for _, table := range []struct{ fileName, protocol, state string }{
+		{"tcp", "tcp", tcpStateListen}, {"tcp6", "tcp", tcpStateListen},
+		{"udp", "udp", udpStateUnbound}, {"udp6", "udp", udpStateUnbound},
+	} {
+		sockets, err := readSocketTable(path.Join(procRoot, "net", table.fileName), table.protocol, table.state)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ret = append(ret, sockets...)
+	}
+	owners, err := findSocketOwners(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	for i, sock := range ret {
+		if owner, found := owners[sock.Inode]; found {
+			ret[i].PID, ret[i].Process, ret[i].InstanceNumber = owner.pid, owner.name, owner.instanceNumber
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Protocol != ret[j].Protocol {
+			return ret[i].Protocol < ret[j].Protocol
+		}
+		return ret[i].Port < ret[j].Port
+	})
+	return
+}
+
+// readSocketTable reads the sockets of the state from a socket table such as /proc/net/tcp.
+func readSocketTable(filePath, protocol, state string) (ret []Socket, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	ret = make([]Socket, 0, 16)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if lineNum == 1 || len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		sock := Socket{Protocol: protocol}
+		colon := strings.IndexRune(fields[1], ':')
+		if colon == -1 {
+			return nil, fmt.Errorf("audit: malformed address \"%s\" in %s line %d", fields[1], filePath, lineNum)
+		}
+		if sock.Address, err = decodeAddress(fields[1][:colon]); err != nil {
+			return nil, fmt.Errorf("audit: malformed address \"%s\" in %s line %d - %v", fields[1], filePath, lineNum, err)
+		}
+		port, err := strconv.ParseUint(fields[1][colon+1:], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("audit: malformed port \"%s\" in %s line %d - %v", fields[1], filePath, lineNum, err)
+		}
+		sock.Port = int(port)
+		if sock.Inode, err = strconv.ParseUint(fields[9], 10, 64); err != nil {
+			return nil, fmt.Errorf("audit: malformed inode \"%s\" in %s line %d - %v", fields[9], filePath, lineNum, err)
+		}
+		ret = append(ret, sock)
+	}
+	return ret, scanner.Err()
+}
+
+// hostByteOrder is the byte order of this computer, in which the kernel prints the 32-bit words of socket addresses.
+var hostByteOrder = func() binary.ByteOrder {
+	one := uint16(1)
+	if *(*byte)(unsafe.Pointer(&one)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// decodeAddress decodes an IPv4 or IPv6 address printed by the kernel as hexadecimal 32-bit words.
+func decodeAddress(hexAddr string) (net.IP, error) {
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil, fmt.Errorf("unexpected length %d", len(raw))
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		hostByteOrder.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	return ip, nil
+}
+
+// process is the owner of sockets.
+type process struct {
+	pid            int
+	name           string
+	instanceNumber string
+}
+
+// findSocketOwners returns socket inode vs the process that holds the socket open.
+func findSocketOwners(procRoot string) (map[uint64]process, error) {
+	owners := make(map[uint64]process)
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		pidDir := path.Join(procRoot, entry.Name())
+		fds, err := ioutil.ReadDir(path.Join(pidDir, "fd"))
+		if err != nil {
+			// The process is gone or inaccessible
+			continue
+		}
+		var owner *process
+		for _, fd := range fds {
+			target, err := os.Readlink(path.Join(pidDir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(target, socketLinkPrefix) {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(target, socketLinkPrefix), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if owner == nil {
+				owner = readProcess(pidDir, pid)
+			}
+			owners[inode] = *owner
+		}
+	}
+	return owners, nil
+}
+
+// readProcess reads the command name and HANA instance number of a process.
+func readProcess(pidDir string, pid int) *process {
+	proc := &process{pid: pid}
+	if comm, err := ioutil.ReadFile(path.Join(pidDir, "comm")); err == nil {
+		proc.name = strings.TrimSpace(string(comm))
+	}
+	if cmdline, err := ioutil.ReadFile(path.Join(pidDir, "cmdline")); err == nil {
+		if match := instanceInCmdline.FindSubmatch(cmdline); match != nil {
+			proc.instanceNumber = string(match[1])
+		}
+	}
+	return proc
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/generator"
+	"github.com/SUSE/HANA-Firewall/journal"
+	"github.com/SUSE/HANA-Firewall/loader"
+	"github.com/SUSE/HANA-Firewall/model"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit statuses of hana-firewall, they are documented in the help message and manual page.
+const (
+	ExitOK         = 0 // ExitOK means success.
+	ExitFailure    = 1 // ExitFailure is any failure not covered by the other statuses.
+	ExitUsage      = 2 // ExitUsage means the command line is incorrect.
+	ExitPermission = 3 // ExitPermission means the program is not run with root privilege, or a file may not be accessed.
+	ExitParse      = 4 // ExitParse means a configuration or definition file could not be read or parsed.
+	ExitValidation = 5 // ExitValidation means a configuration or definition value is invalid.
+	ExitWrite      = 6 // ExitWrite means generated files could not be written.
+)
+
+const (
+	LogFormatText    = "text"
+	LogFormatJSON    = "json"
+	LogFormatJournal = "journal"
+)
+
+// logFormat is the format of diagnostic messages, it is either "text", "json", or "journal".
+var logFormat = LogFormatText
+
+// diagnostic is a message printed to standard error in JSON format.
+type diagnostic struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Message    string `json:"message"`
+	ErrorType  string `json:"error_type,omitempty"`
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	ExitStatus int    `json:"exit_status,omitempty"`
+}
+
+/*
+print writes the diagnostic message in the chosen log format. Text goes to standard output for informational messages
+and to standard error for the others, JSON always goes to standard error. Journal entries carry the details in
+structured fields, and if journal cannot be reached, the message is printed as text instead.
+*/
+func (diag diagnostic) print() {
+	switch logFormat {
+	case LogFormatJSON:
+		diag.Time = time.Now().Format(time.RFC3339)
+		out, _ := json.Marshal(diag)
+		fmt.Fprintln(os.Stderr, string(out))
+		return
+	case LogFormatJournal:
+		if journal.Send(diag.journalFields()) == nil {
+			return
+		}
+	}
+	if diag.Level == "info" {
+		fmt.Println(diag.Message)
+	} else {
+		fmt.Fprintln(os.Stderr, diag.Message)
+	}
+}
+
+// journalFields returns the diagnostic message in the form of journal fields.
+func (diag diagnostic) journalFields() map[string]string {
+	fields := map[string]string{
+		"MESSAGE":           diag.Message,
+		"SYSLOG_IDENTIFIER": "hana-firewall",
+		"PRIORITY":          strconv.Itoa(journal.PriorityInfo),
+	}
+	switch diag.Level {
+	case "error":
+		fields["PRIORITY"] = strconv.Itoa(journal.PriorityError)
+	case "warning":
+		fields["PRIORITY"] = strconv.Itoa(journal.PriorityWarning)
+	}
+	if diag.ErrorType != "" {
+		fields["HANA_FIREWALL_ERROR_TYPE"] = diag.ErrorType
+	}
+	if diag.File != "" {
+		fields["HANA_FIREWALL_FILE"] = diag.File
+	}
+	if diag.Line > 0 {
+		fields["HANA_FIREWALL_LINE"] = strconv.Itoa(diag.Line)
+	}
+	if diag.ExitStatus > 0 {
+		fields["HANA_FIREWALL_EXIT_STATUS"] = strconv.Itoa(diag.ExitStatus)
+	}
+	return fields
+}
+
+// describeError fills error type, file, line, and exit status into the diagnostic according to the type of error.
+func (diag *diagnostic) describeError(err error) {
+	var parseErr *txtparser.ParseError
+	var parseErrs txtparser.ParseErrors
+	var validationErr *model.ValidationError
+	var writeErr *generator.WriteError
+	var modifiedErr *generator.ModifiedError
+	var fileErr *loader.FileError
+	diag.ExitStatus = ExitFailure
+	if errors.As(err, &fileErr) {
+		diag.File = fileErr.Path
+	}
+	if errors.As(err, &parseErrs) {
+		// Describe the first of many parse errors
+		err = parseErrs[0]
+	}
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		// Such as EACCES of reading a configuration file or writing a generated file
+		diag.ErrorType, diag.ExitStatus = "PermissionError", ExitPermission
+		if errors.As(err, &writeErr) {
+			diag.File = writeErr.Path
+		}
+	case errors.As(err, &parseErr):
+		diag.ErrorType, diag.ExitStatus, diag.Line = "ParseError", ExitParse, parseErr.Line
+		if parseErr.File != "" {
+			diag.File = parseErr.File
+		}
+	case errors.As(err, &validationErr):
+		diag.ErrorType, diag.ExitStatus = "ValidationError", ExitValidation
+	case errors.As(err, &writeErr):
+		diag.ErrorType, diag.ExitStatus, diag.File = "WriteError", ExitWrite, writeErr.Path
+	case errors.As(err, &modifiedErr):
+		diag.ErrorType, diag.ExitStatus, diag.File = "ModifiedError", ExitWrite, modifiedErr.Paths[0]
+	case fileErr != nil:
+		diag.ErrorType, diag.ExitStatus = "FileError", ExitParse
+	}
+}
+
+// diagnosticLogWriter turns messages of the standard logger into warning diagnostics.
+type diagnosticLogWriter struct{}
+
+func (diagnosticLogWriter) Write(p []byte) (int, error) {
+	diagnostic{Level: "warning", Message: strings.TrimSpace(string(p))}.print()
+	return len(p), nil
+}
+
+/*
+parseLogFormat looks for flag "--log-format text|json|journal" among the global options that precede the command, and
+returns the arguments without the flag. Arguments from the command onwards are left as they are. If the format is not
+valid, the program will exit. If journal is asked for but it cannot be reached, text is used instead.
+*/
+func parseLogFormat(args []string) []string {
+	ret := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		format := ""
+		if i == 0 {
+			ret = append(ret, args[i])
+			continue
+		} else if args[i] == "--log-format" && i+1 < len(args) {
+			format = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], "--log-format=") {
+			format = strings.TrimPrefix(args[i], "--log-format=")
+		} else {
+			ret = append(ret, args[i:]...)
+			break
+		}
+		if format != LogFormatText && format != LogFormatJSON && format != LogFormatJournal {
+			usageExit("The log format must be one of %s, %s, and %s.", LogFormatText, LogFormatJSON, LogFormatJournal)
+		}
+		logFormat = format
+	}
+	if logFormat == LogFormatJournal && !journal.IsAvailable() {
+		// Such as running outside of systemd, the messages are then printed as text
+		logFormat = LogFormatText
+	}
+	if logFormat != LogFormatText {
+		log.SetFlags(0)
+		log.SetOutput(diagnosticLogWriter{})
+	}
+	return ret
+}
+
+/*
+errorExit prints out a message to standard error and then exits the program. The exit status is decided by the type of
+the first error among stuff, or it is ExitFailure if there is no error among stuff.
+*/
+func errorExit(template string, stuff ...interface{}) {
+	diag := diagnostic{Level: "error", Message: fmt.Sprintf(template, stuff...), ExitStatus: ExitFailure}
+	for _, thing := range stuff {
+		if err, isErr := thing.(error); isErr {
+			diag.describeError(err)
+			break
+		}
+	}
+	diag.print()
+	os.Exit(diag.ExitStatus)
+}
+
+// exitWithStatus prints out a message to standard error and then exits the program with the status.
+func exitWithStatus(status int, template string, stuff ...interface{}) {
+	diagnostic{Level: "error", Message: fmt.Sprintf(template, stuff...), ExitStatus: status}.print()
+	os.Exit(status)
+}
+
+// usageExit prints out a message about incorrect command line to standard error and then exits the program.
+func usageExit(template string, stuff ...interface{}) {
+	exitWithStatus(ExitUsage, template, stuff...)
+}
+
+/*
+reportError prints an error to standard error without exiting the program, and returns the exit status that corresponds
+to the error. Each of many parse errors is printed individually.
+*/
+func reportError(err error) (status int) {
+	var parseErrs txtparser.ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			status = reportError(parseErr)
+		}
+		return
+	}
+	diag := diagnostic{Level: "error", Message: err.Error()}
+	diag.describeError(err)
+	diag.print()
+	return diag.ExitStatus
+}
+
+// reportInfo prints an informational message.
+func reportInfo(template string, stuff ...interface{}) {
+	diagnostic{Level: "info", Message: fmt.Sprintf(template, stuff...)}.print()
+}
+
+// reportWarning prints a warning.
+func reportWarning(template string, stuff ...interface{}) {
+	diagnostic{Level: "warning", Message: fmt.Sprintf(template, stuff...)}.print()
+}
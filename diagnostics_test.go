@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/SUSE/HANA-Firewall/generator"
+	"github.com/SUSE/HANA-Firewall/loader"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestDiagnostic_DescribeError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestDiagnostic_DescribeError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A configuration file that cannot be read as a file is a parse failure
+	_, readErr := txtparser.ParseSysconfigFile(dir, false)
+	if readErr == nil {
+		t.Fatal("did not error")
+	}
+	var diag diagnostic
+	diag.describeError(&loader.FileError{Path: dir, Err: readErr})
+	if diag.ExitStatus != ExitParse || diag.ErrorType != "FileError" || diag.File != dir {
+		t.Fatalf("%+v", diag)
+	}
+	// A configuration file that may not be read is a permission failure
+	confPath := path.Join(dir, "hana-firewall")
+	if err := ioutil.WriteFile(confPath, []byte("HANA_INSTANCE_NUMBERS=\"00\"\n"), 0000); err != nil {
+		t.Fatal(err)
+	}
+	_, readErr = txtparser.ParseSysconfigFile(confPath, false)
+	if readErr == nil {
+		// The superuser reads the file regardless of its mode
+		readErr = &os.PathError{Op: "open", Path: confPath, Err: syscall.EACCES}
+	}
+	diag = diagnostic{}
+	diag.describeError(&loader.FileError{Path: confPath, Err: readErr})
+	if diag.ExitStatus != ExitPermission || diag.File != confPath {
+		t.Fatalf("%+v", diag)
+	}
+	// So is a generated file that may not be written
+	diag = diagnostic{}
+	diag.describeError(&generator.WriteError{Path: confPath, Err: &os.PathError{Op: "open", Path: confPath, Err: syscall.EPERM}})
+	if diag.ExitStatus != ExitPermission || diag.File != confPath {
+		t.Fatalf("%+v", diag)
+	}
+	diag = diagnostic{}
+	diag.describeError(&generator.WriteError{Path: confPath, Err: &os.PathError{Op: "open", Path: confPath, Err: syscall.ENOSPC}})
+	if diag.ExitStatus != ExitWrite {
+		t.Fatalf("%+v", diag)
+	}
+}
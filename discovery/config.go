@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// TenantConfigDirPrefix starts the names of sub-directories that hold the configuration specific to a tenant database.
+const TenantConfigDirPrefix = "DB_"
+
+// ConfigDirs returns the directories of custom INI configuration of a HANA system, in the order they are read.
+func ConfigDirs(sapRoot, hanaSharedRoot, sid string) []string {
+	return []string{
+		path.Join(sapRoot, sid, "SYS", "global", "hdb", "custom", "config"),
+		path.Join(hanaSharedRoot, sid, "global", "hdb", "custom", "config"),
+	}
+}
+
+/*
+DiscoverConfig reads the custom INI configuration (such as global.ini) of a HANA system. The system-wide configuration
+in <SAP root>/<SID>/SYS/global/hdb/custom/config is read first, then the configuration in
+<HANA shared root>/<SID>/global/hdb/custom/config is merged over it. The returned config is INI file name vs content.
+Each tenant database gets its own configuration, which is the system-wide configuration with the configuration in the
+DB_<tenant> sub-directories of both merged over it, the returned tenants are tenant name vs INI file name vs content.
+Missing configuration directories are not an error, but the first INI file that cannot be read or parsed is.
+*/
+func DiscoverConfig(sapRoot, hanaSharedRoot, sid string) (config map[string]*txtparser.INI, tenants map[string]map[string]*txtparser.INI, err error) {
+	config = make(map[string]*txtparser.INI)
+	tenants = make(map[string]map[string]*txtparser.INI)
+	configDirs := ConfigDirs(sapRoot, hanaSharedRoot, sid)
+	for _, configDir := range configDirs {
+		if err = readConfigDir(configDir, config); err != nil {
+			return
+		}
+	}
+	for _, configDir := range configDirs {
+		entries, err := ioutil.ReadDir(configDir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return config, tenants, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || !strings.HasPrefix(entry.Name(), TenantConfigDirPrefix) {
+				continue
+			}
+			tenant := strings.TrimPrefix(entry.Name(), TenantConfigDirPrefix)
+			if tenants[tenant] == nil {
+				tenants[tenant] = copyConfig(config)
+			}
+			if err := readConfigDir(path.Join(configDir, entry.Name()), tenants[tenant]); err != nil {
+				return config, tenants, err
+			}
+		}
+	}
+	return
+}
+
+// copyConfig returns a copy of the configuration that can be merged into without modifying the original.
+func copyConfig(config map[string]*txtparser.INI) map[string]*txtparser.INI {
+	ret := make(map[string]*txtparser.INI, len(config))
+	for fileName, ini := range config {
+		ret[fileName] = &txtparser.INI{Sections: make(map[string]map[string]string)}
+		ret[fileName].Merge(ini)
+	}
+	return ret
+}
+
+// readConfigDir merges the INI files of the directory into the configuration. A missing directory is not an error.
+func readConfigDir(configDir string, config map[string]*txtparser.INI) error {
+	entries, err := ioutil.ReadDir(configDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".ini") {
+			continue
+		}
+		ini, err := txtparser.ParseINIFile(path.Join(configDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if existing := config[entry.Name()]; existing != nil {
+			existing.Merge(ini)
+		} else {
+			config[entry.Name()] = ini
+		}
+	}
+	return nil
+}
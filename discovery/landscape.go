@@ -0,0 +1,170 @@
+// Discover HANA systems installed on this host.
+package discovery
+
+import (
+	"context"
+	"github.com/SUSE/HANA-Firewall/model"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	sidDirName      = regexp.MustCompile(`^[A-Z][A-Z0-9]{2}$`)
+	instanceDirName = regexp.MustCompile(`^HDB([0-9]{2})$`)
+	// lookupIPAddr resolves host names, tests replace it so that they do not depend on name resolution.
+	lookupIPAddr = net.DefaultResolver.LookupIPAddr
+)
+
+// DefaultResolveTimeout is the time that ResolveVirtualHosts waits for the addresses of a virtual host name.
+const DefaultResolveTimeout = 5 * time.Second
+
+/*
+DiscoverSystems looks for HANA systems under SAP root directory (usually /usr/sap), in which every HANA system has a
+directory /usr/sap/<SID>/HDB<instance number>. The instance directory contains one sub-directory per host that runs
+the system, such host directory carries a sapprofile.ini file. The HANA version is read from the manifest in the exe
+sub-directory of the instance, and the virtual host name from SAPLOCALHOST of the instance profile; the virtual host
+name is not resolved, see ResolveVirtualHosts. If the SAP root directory does not exist, the returned systems are empty
+and there is no error.
+*/
+func DiscoverSystems(sapRoot string) (systems []model.HANASystem, err error) {
+	systems = make([]model.HANASystem, 0, 2)
+	sidDirs, err := ioutil.ReadDir(sapRoot)
+	if os.IsNotExist(err) {
+		return systems, nil
+	} else if err != nil {
+		return
+	}
+	for _, sidDir := range sidDirs {
+		if !sidDir.IsDir() || !sidDirName.MatchString(sidDir.Name()) {
+			continue
+		}
+		instanceDirs, err := ioutil.ReadDir(path.Join(sapRoot, sidDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, instanceDir := range instanceDirs {
+			match := instanceDirName.FindStringSubmatch(instanceDir.Name())
+			// The instance directory is usually a symbolic link to /hana/shared/<SID>/HDB<instance number>
+			instancePath := path.Join(sapRoot, sidDir.Name(), instanceDir.Name())
+			if info, err := os.Stat(instancePath); match == nil || err != nil || !info.IsDir() {
+				continue
+			}
+			system := model.HANASystem{
+				SID:            sidDir.Name(),
+				InstanceNumber: match[1],
+				Hosts:          findHosts(instancePath),
+				Version:        findVersion(instancePath),
+			}
+			system.VirtualHost = findVirtualHost(instancePath, system.Hosts)
+			systems = append(systems, system)
+		}
+	}
+	return
+}
+
+// findHosts returns names of the host directories among the instance directory.
+func findHosts(instancePath string) []string {
+	hosts := make([]string, 0, 1)
+	entries, err := ioutil.ReadDir(instancePath)
+	if err != nil {
+		return hosts
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(path.Join(instancePath, entry.Name(), "sapprofile.ini")); err == nil {
+			hosts = append(hosts, entry.Name())
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+/*
+findVersion returns the HANA version written in the "release" (or otherwise "fullversion") line of the manifest file
+among the executables of the instance. The version is empty if it cannot be found.
+*/
+func findVersion(instancePath string) model.HANAVersion {
+	content, err := ioutil.ReadFile(path.Join(instancePath, "exe", "manifest"))
+	if err != nil {
+		return nil
+	}
+	found := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		colon := strings.IndexRune(line, ':')
+		if colon < 1 {
+			continue
+		}
+		if fields := strings.Fields(line[colon+1:]); len(fields) > 0 {
+			found[strings.TrimSpace(line[:colon])] = fields[0]
+		}
+	}
+	for _, key := range []string{"release", "fullversion"} {
+		if version, err := model.ParseHANAVersion(found[key]); found[key] != "" && err == nil {
+			return version
+		}
+	}
+	return nil
+}
+
+/*
+findVirtualHost returns SAPLOCALHOST of the instance profile (sapprofile.ini) in the host directory of this host, or of
+the only host of the instance. The virtual host is empty if the instance does not use one.
+*/
+func findVirtualHost(instancePath string, hosts []string) (virtualHost string) {
+	hostDir := ""
+	if hostname, err := os.Hostname(); err == nil {
+		for _, host := range hosts {
+			if host == strings.SplitN(hostname, ".", 2)[0] {
+				hostDir = host
+			}
+		}
+	}
+	if hostDir == "" && len(hosts) == 1 {
+		hostDir = hosts[0]
+	}
+	if hostDir == "" {
+		return
+	}
+	profile, err := txtparser.ParseINIFile(path.Join(instancePath, hostDir, "sapprofile.ini"))
+	if err != nil {
+		return
+	}
+	if virtualHost, _ = profile.Get("", "SAPLOCALHOST"); strings.Contains(virtualHost, "$(") {
+		return ""
+	}
+	return
+}
+
+/*
+ResolveVirtualHosts looks up the IP addresses of the virtual host names of the systems, and places them among the
+systems' virtual addresses. Each lookup gives up after the timeout. The addresses of a name that cannot be resolved are
+left empty, and the first lookup error is returned after all names are tried. Name resolution may be slow, hence it is
+only worthwhile if the addresses are used, for example by instance destinations.
+*/
+func ResolveVirtualHosts(systems []model.HANASystem, timeout time.Duration) (err error) {
+	for i, system := range systems {
+		if system.VirtualHost == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ipAddrs, lookupErr := lookupIPAddr(ctx, system.VirtualHost)
+		cancel()
+		if lookupErr != nil {
+			if err == nil {
+				err = lookupErr
+			}
+			continue
+		}
+		systems[i].VirtualAddresses = make([]string, 0, len(ipAddrs))
+		for _, ipAddr := range ipAddrs {
+			systems[i].VirtualAddresses = append(systems[i].VirtualAddresses, ipAddr.IP.String())
+		}
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package discovery
+
+import (
+	"context"
+	"github.com/SUSE/HANA-Firewall/loader"
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiscoverSystems(t *testing.T) {
+	sapRoot, err := ioutil.TempDir("", "hana-firewall-TestDiscoverSystems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sapRoot)
+	for _, hostDir := range []string{"PRD/HDB00/hana1", "PRD/HDB00/hana2", "PRD/HDB00/exe", "QAS/HDB10/hana1", "QAS/SYS/profile", "hostctrl/exe"} {
+		if err := os.MkdirAll(path.Join(sapRoot, hostDir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, hostDir := range []string{"PRD/HDB00/hana1", "PRD/HDB00/hana2", "QAS/HDB10/hana1"} {
+		if err := ioutil.WriteFile(path.Join(sapRoot, hostDir, "sapprofile.ini"), []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(sapRoot, "QAS/HDB10/hana1/sapprofile.ini"), []byte("SAPSYSTEMNAME = QAS\nSAPLOCALHOST = qasvirt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		t.Fatal("should not resolve during discovery")
+		return nil, nil
+	}
+	defer func() { lookupIPAddr = net.DefaultResolver.LookupIPAddr }()
+	manifest := "compiletype: opt\nfullversion: 2.00.059.00.1636541146 Build 1636541146-1530\nrelease: 2.00.059.00.1636541146\n"
+	if err := ioutil.WriteFile(path.Join(sapRoot, "PRD/HDB00/exe/manifest"), []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	systems, err := DiscoverSystems(sapRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := []model.HANASystem{
+		{SID: "PRD", InstanceNumber: "00", Hosts: []string{"hana1", "hana2"}, Version: model.HANAVersion{2, 0, 59, 0}},
+		{SID: "QAS", InstanceNumber: "10", Hosts: []string{"hana1"}, VirtualHost: "qasvirt"},
+	}
+	if !reflect.DeepEqual(systems, match) {
+		t.Fatalf("\n%+v\n%+v\n", systems, match)
+	}
+
+	// Virtual host names are resolved on request
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "qasvirt" {
+			t.Fatal(host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("192.168.1.10")}, {IP: net.ParseIP("fd00::10")}}, nil
+	}
+	if err := ResolveVirtualHosts(systems, time.Second); err != nil || systems[0].VirtualAddresses != nil ||
+		!reflect.DeepEqual(systems[1].VirtualAddresses, []string{"192.168.1.10", "fd00::10"}) {
+		t.Fatalf("%+v %v", systems, err)
+	}
+	// A slow lookup gives up after the timeout
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	systems[1].VirtualAddresses = nil
+	if err := ResolveVirtualHosts(systems, 10*time.Millisecond); err == nil || systems[1].VirtualAddresses != nil {
+		t.Fatalf("%+v %v", systems, err)
+	}
+
+	// Missing SAP root is not an error
+	if systems, err := DiscoverSystems(path.Join(sapRoot, "does-not-exist")); err != nil || len(systems) != 0 {
+		t.Fatal(systems, err)
+	}
+}
+
+func TestDiscoverConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "hana-firewall-TestDiscoverConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	sapRoot, hanaSharedRoot := path.Join(root, "usr/sap"), path.Join(root, "hana/shared")
+	files := map[string]string{
+		path.Join(sapRoot, "PRD/SYS/global/hdb/custom/config/global.ini"):        "[communication]\nsqlport = 30041\nlistenport = 30000\n",
+		path.Join(sapRoot, "PRD/SYS/global/hdb/custom/config/README"):            "not an INI file",
+		path.Join(hanaSharedRoot, "PRD/global/hdb/custom/config/global.ini"):     "[communication]\nsqlport = 30051\n",
+		path.Join(hanaSharedRoot, "PRD/global/hdb/custom/config/nameserver.ini"): "[landscape]\nid = 1\n",
+		// Tenant-specific configuration is merged over the system-wide configuration of each tenant
+		path.Join(sapRoot, "PRD/SYS/global/hdb/custom/config/DB_TEN/global.ini"):         "[communication]\nlistenport = 30040\n",
+		path.Join(hanaSharedRoot, "PRD/global/hdb/custom/config/DB_TEN/indexserver.ini"): "[sql]\nsqlport = 30044\n",
+		path.Join(hanaSharedRoot, "PRD/global/hdb/custom/config/DB_TWO/indexserver.ini"): "[sql]\nsqlport = 30047\n",
+		path.Join(hanaSharedRoot, "PRD/global/hdb/custom/config/backup/global.ini"):      "[communication]\nlistenport = 1\n",
+	}
+	for filePath, content := range files {
+		if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, tenants, err := DiscoverConfig(sapRoot, hanaSharedRoot, "PRD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config) != 2 || config["nameserver.ini"] == nil || config["global.ini"] == nil {
+		t.Fatalf("%+v", config)
+	}
+	// HANA shared configuration wins
+	if value, _ := config["global.ini"].Get("communication", "sqlport"); value != "30051" {
+		t.Fatal(value)
+	}
+	if value, _ := config["global.ini"].Get("communication", "listenport"); value != "30000" {
+		t.Fatal(value)
+	}
+	if len(tenants) != 2 || len(tenants["TEN"]) != 3 || len(tenants["TWO"]) != 3 {
+		t.Fatalf("%+v", tenants)
+	}
+	if value, _ := tenants["TEN"]["global.ini"].Get("communication", "listenport"); value != "30040" {
+		t.Fatal(value)
+	}
+	if value, _ := tenants["TWO"]["global.ini"].Get("communication", "listenport"); value != "30000" {
+		t.Fatal(value)
+	}
+
+	// Definitions refer to the configuration by INI placeholders
+	defDir := path.Join(root, "definitions")
+	if err := os.MkdirAll(defDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(defDir, "tenant"), []byte(`TCP="__INI:global.ini:communication:listenport:3$(SAPSYSTEM)00__ __INI:indexserver.ini:sql:sqlport:3$(SAPSYSTEM)15__"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	definitions, report := (&loader.Loader{Dirs: []string{defDir}}).Load()
+	if err := report.Err(); err != nil || len(definitions) != 1 {
+		t.Fatal(definitions, err)
+	}
+	global := model.HANAGlobalParameters{InstanceNumbers: []string{"00"}}
+	global.UseDiscoveredSystems([]model.HANASystem{{SID: "PRD", InstanceNumber: "00", Config: config, TenantConfig: tenants}})
+	var ports []int
+	for _, portDefinition := range definitions[0].TCP {
+		instancePorts, err := global.GetPortNumbers(portDefinition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, instancePorts...)
+	}
+	// Ports of all tenants are opened
+	if !reflect.DeepEqual(ports, []int{30000, 30040, 30015, 30044, 30047}) {
+		t.Fatal(ports)
+	}
+
+	// Missing configuration is not an error
+	if config, tenants, err := DiscoverConfig(sapRoot, hanaSharedRoot, "QAS"); err != nil || len(config) != 0 || len(tenants) != 0 {
+		t.Fatal(config, tenants, err)
+	}
+}
@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"errors"
+	"github.com/SUSE/HANA-Firewall/model"
+	"os"
+	"path"
+)
+
+// ErrNoServices tells that there is no firewalld service to generate, because instance numbers or definitions are missing.
+var ErrNoServices = errors.New("HANA instance number or service definitions are missing")
+
+// Applied describes the outcome of Apply.
+type Applied struct {
+	Services    map[string]model.FirewalldService // Services are the generated firewalld services.
+	Policies    map[string]model.FirewalldPolicy  // Policies are the generated firewalld policies, they may be empty.
+	Fingerprint string                            // Fingerprint of the services, policies, and generated files on disk.
+	Changed     bool                              // Changed is false if the fingerprint did not change, then nothing was written.
+}
+
+/*
+Apply generates firewalld services and policies and writes them into "services" and "policies" under the firewalld
+directory, unless their fingerprint is the same as the last fingerprint, which may be empty. The fingerprint covers the
+generated files on disk too, so that files removed or modified by hand since the last run are written again. The
+policies directory is only created if there are policies to write. Firewalld is not reloaded.
+*/
+func (fw *Firewalld) Apply(firewalldDir, lastFingerprint string) (applied Applied, err error) {
+	if applied.Services, err = fw.GenerateConfig(); err != nil {
+		return
+	}
+	if len(applied.Services) == 0 {
+		err = ErrNoServices
+		return
+	}
+	applied.Policies = fw.GeneratePolicies(applied.Services)
+	servicesDir := path.Join(firewalldDir, "services")
+	policiesDir := path.Join(firewalldDir, "policies")
+	configFingerprint := Fingerprint(applied.Services, applied.Policies)
+	applied.Fingerprint = configFingerprint + " " + OwnedFilesChecksum(servicesDir, policiesDir)
+	if applied.Fingerprint == lastFingerprint {
+		return
+	}
+	if err = fw.WriteConfig(servicesDir, applied.Services); err != nil {
+		return
+	}
+	if len(applied.Policies) > 0 {
+		if err = os.MkdirAll(policiesDir, 0750); err != nil {
+			err = &WriteError{Path: policiesDir, Err: err}
+			return
+		}
+	}
+	// Remove the previously generated policy if it is no longer wanted
+	if info, statErr := os.Stat(policiesDir); statErr == nil && info.IsDir() {
+		if err = fw.WritePolicies(policiesDir, applied.Policies); err != nil {
+			return
+		}
+	}
+	applied.Fingerprint = configFingerprint + " " + OwnedFilesChecksum(servicesDir, policiesDir)
+	applied.Changed = true
+	return
+}
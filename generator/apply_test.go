@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFirewalld_Apply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_Apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(path.Join(dir, "services"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	fw := Firewalld{HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00"}}}
+	if _, err := fw.Apply(dir, ""); err != ErrNoServices {
+		t.Fatal(err)
+	}
+	fw.HANAServices = []model.HANAServiceDefinition{{FileBaseName: "a", TCP: []string{"3__INST_NUM__15"}}}
+	applied, err := fw.Apply(dir, "")
+	if err != nil || !applied.Changed || len(applied.Services) != 1 || len(applied.Policies) != 0 {
+		t.Fatal(err, applied)
+	}
+	if _, err := os.Stat(path.Join(dir, "services", "a.xml")); err != nil {
+		t.Fatal(err)
+	}
+	// Without policy, the policies directory is not created
+	if _, err := os.Stat(path.Join(dir, "policies")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	// Nothing is written if the fingerprint did not change
+	if again, err := fw.Apply(dir, applied.Fingerprint); err != nil || again.Changed || again.Fingerprint != applied.Fingerprint {
+		t.Fatal(err, again)
+	}
+	// A generated file removed by hand is written again
+	if err := os.Remove(path.Join(dir, "services", "a.xml")); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := fw.Apply(dir, applied.Fingerprint); err != nil || !again.Changed || again.Fingerprint != applied.Fingerprint {
+		t.Fatal(err, again)
+	}
+	if _, err := os.Stat(path.Join(dir, "services", "a.xml")); err != nil {
+		t.Fatal(err)
+	}
+	// A generated file modified by hand changes the fingerprint
+	content, err := ioutil.ReadFile(path.Join(dir, "services", "a.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "services", "a.xml"), append(content, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := fw.Apply(dir, applied.Fingerprint); again.Fingerprint == applied.Fingerprint {
+		t.Fatal(err, again)
+	} else if _, modified := err.(*ModifiedError); !modified {
+		t.Fatal(err)
+	}
+	fw.Force = true
+	if applied, err = fw.Apply(dir, applied.Fingerprint); err != nil || !applied.Changed {
+		t.Fatal(err, applied)
+	}
+	fw.Force = false
+	// Policy zones make a policy
+	fw.HANAGlobal.PolicyIngressZones = []string{"internal"}
+	fw.HANAGlobal.PolicyEgressZones = []string{"public"}
+	if applied, err = fw.Apply(dir, applied.Fingerprint); err != nil || !applied.Changed || len(applied.Policies) != 1 {
+		t.Fatal(err, applied)
+	}
+	if _, err := os.Stat(path.Join(dir, "policies", PolicyName+".xml")); err != nil {
+		t.Fatal(err)
+	}
+}
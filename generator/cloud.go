@@ -0,0 +1,469 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"net"
+	"sort"
+	"strings"
+)
+
+// CloudProviders are the clouds whose rules can be rendered by the terraform format.
+var CloudProviders = []string{"aws", "azure", "gcp"}
+
+const (
+	awsMaxRules         = 60   // inbound rules per security group by default quota, each CIDR and port range counts as one rule
+	awsMaxDescription   = 255  // characters of a rule description
+	azureMaxRules       = 1000 // rules per network security group
+	azureMinPriority    = 100
+	azureMaxPriority    = 4096
+	azureMaxDescription = 140
+	gcpMinPriority      = 0
+	gcpMaxPriority      = 65535
+	gcpMaxDescription   = 2048
+	cloudMaxName        = 63 // characters of a rule name, which is the limit of GCP and within the limit of Azure
+)
+
+// cloudRule allows traffic of a single protocol from the source CIDRs to the ports of the destination CIDRs.
+type cloudRule struct {
+	Name         string
+	Description  string
+	Protocol     string
+	Ranges       []model.PortRange
+	Sources      []string
+	Destinations []string // Destinations is empty if the rule allows traffic to all addresses.
+	Priority     int
+}
+
+// PortStrings returns the port ranges written as the number or FIRST-LAST.
+func (rule *cloudRule) PortStrings() []string {
+	ret := make([]string, 0, len(rule.Ranges))
+	for _, portRange := range rule.Ranges {
+		ret = append(ret, portRange.String())
+	}
+	return ret
+}
+
+// cloudRuleGroup is one or more services that are rendered into the same cloud rules.
+type cloudRuleGroup struct {
+	Name       string
+	ShortNames []string
+	CIDRs      []string
+	Ports      []exportPorts
+}
+
+// cloudRuleName returns a rule name made of the prefix and base name, which is shortened to leave room for the suffix.
+func cloudRuleName(prefix, base, suffix string) string {
+	name := exportName(prefix, base)
+	if len(name)+len(suffix) > cloudMaxName {
+		name = strings.TrimRight(name[:cloudMaxName-len(suffix)], "-")
+	}
+	return name + suffix
+}
+
+// cloudDescription joins the service short names into a rule description of at most the length.
+func cloudDescription(shortNames []string, maxLen int) string {
+	desc := "HANA firewall: " + strings.Join(shortNames, ", ")
+	if len(desc) > maxLen {
+		desc = strings.TrimSpace(desc[:maxLen-3]) + "..."
+	}
+	return desc
+}
+
+// splitFamilies returns the IPv4 and IPv6 CIDRs separately.
+func splitFamilies(cidrs []string) (ipv4, ipv6 []string) {
+	for _, cidr := range cidrs {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() == nil {
+			ipv6 = append(ipv6, cidr)
+		} else {
+			ipv4 = append(ipv4, cidr)
+		}
+	}
+	return
+}
+
+// mergePorts combines the ports of the services per protocol, and folds them into ranges again.
+func mergePorts(services []exportService) (ret []exportPorts) {
+	for _, protocol := range []string{model.FirewalldProtocolTCP, model.FirewalldProtocolUDP} {
+		ports := make([]int, 0, 8)
+		for _, svc := range services {
+			for _, svcPorts := range svc.Ports {
+				if svcPorts.Protocol != protocol {
+					continue
+				}
+				for _, portRange := range svcPorts.Ranges {
+					for port := portRange.First; port <= portRange.Last; port++ {
+						ports = append(ports, port)
+					}
+				}
+			}
+		}
+		if len(ports) > 0 {
+			ret = append(ret, exportPorts{Protocol: protocol, Ranges: model.FoldPortRanges(ports)})
+		}
+	}
+	return
+}
+
+/*
+fitPortRanges merges the port ranges that are the closest to each other, across all protocols, until there are no more
+ranges than the maximum. It returns the merged ranges and, per protocol, the ports that merging opened in addition. The
+ranges cannot fit if there are more protocols than the maximum.
+*/
+func fitPortRanges(ports []exportPorts, max int) (ret []exportPorts, opened map[string][]model.PortRange, fit bool) {
+	ret = make([]exportPorts, len(ports))
+	total := 0
+	for i, protocolPorts := range ports {
+		ret[i] = exportPorts{Protocol: protocolPorts.Protocol, Ranges: append([]model.PortRange{}, protocolPorts.Ranges...)}
+		total += len(protocolPorts.Ranges)
+	}
+	opened = make(map[string][]model.PortRange)
+	for ; total > max; total-- {
+		closestProtocol, closestRange, closestGap := -1, -1, 0
+		for i, protocolPorts := range ret {
+			for j := 0; j < len(protocolPorts.Ranges)-1; j++ {
+				gap := protocolPorts.Ranges[j+1].First - protocolPorts.Ranges[j].Last
+				if closestProtocol == -1 || gap < closestGap {
+					closestProtocol, closestRange, closestGap = i, j, gap
+				}
+			}
+		}
+		if closestProtocol == -1 {
+			return nil, nil, false
+		}
+		ranges := ret[closestProtocol].Ranges
+		protocol := ret[closestProtocol].Protocol
+		opened[protocol] = append(opened[protocol], model.PortRange{First: ranges[closestRange].Last + 1, Last: ranges[closestRange+1].First - 1})
+		ranges[closestRange].Last = ranges[closestRange+1].Last
+		ret[closestProtocol].Ranges = append(ranges[:closestRange+1], ranges[closestRange+2:]...)
+	}
+	return ret, opened, true
+}
+
+/*
+awsRules combines the services into one rule per protocol, because a security group applies to all addresses of the
+instances it is attached to, and the same port may not be allowed twice. Every port range and source CIDR counts as
+a rule of the security group, and the closest port ranges are merged to fit in the limit. The rules of previous split
+files count towards the limit, because the files are meant for the same security group.
+*/
+func awsRules(services []exportService, opts *ExportOptions) (rules []cloudRule, warnings []string, err error) {
+	shortNames := make([]string, 0, len(services))
+	for _, svc := range services {
+		shortNames = append(shortNames, svc.ShortName)
+		if svc.Destination {
+			warnings = append(warnings, fmt.Sprintf("aws: security groups cannot restrict the destination address of service %s, its ports are allowed to all instances of the group", svc.ShortName))
+		}
+	}
+	maxRules := awsMaxRules
+	if opts.MaxRules > 0 {
+		maxRules = opts.MaxRules
+	}
+	if opts.usedRules > 0 && opts.usedRules+len(opts.SourceCIDRs) > maxRules {
+		return nil, nil, fmt.Errorf("aws: the previous files already take %d of the %d rules of a security group", opts.usedRules, maxRules)
+	}
+	maxRules -= opts.usedRules
+	ports := mergePorts(services)
+	ports, opened, fit := fitPortRanges(ports, maxRules/len(opts.SourceCIDRs))
+	if !fit {
+		return nil, nil, &model.ValidationError{Source: "export", Key: "source CIDR", Value: strings.Join(opts.SourceCIDRs, ","),
+			Message: fmt.Sprintf("there are too many source CIDRs to fit in %d rules of a security group", maxRules)}
+	}
+	for _, protocolPorts := range ports {
+		opts.usedRules += len(protocolPorts.Ranges) * len(opts.SourceCIDRs)
+	}
+	for _, protocolPorts := range ports {
+		if protocolOpened := opened[protocolPorts.Protocol]; len(protocolOpened) > 0 {
+			sort.Slice(protocolOpened, func(i, j int) bool { return protocolOpened[i].First < protocolOpened[j].First })
+			openedPorts := make([]string, 0, len(protocolOpened))
+			for _, portRange := range protocolOpened {
+				openedPorts = append(openedPorts, portRange.String())
+			}
+			warnings = append(warnings, fmt.Sprintf("aws: port ranges are merged to fit in %d rules of a security group, which also allows %s ports %s",
+				maxRules, protocolPorts.Protocol, strings.Join(openedPorts, " ")))
+		}
+		base := protocolPorts.Protocol
+		if len(services) == 1 {
+			base = services[0].ShortName + "-" + protocolPorts.Protocol
+		}
+		rules = append(rules, cloudRule{
+			Name:        cloudRuleName(opts.NamePrefix, base, ""),
+			Description: cloudDescription(shortNames, awsMaxDescription),
+			Protocol:    protocolPorts.Protocol,
+			Ranges:      protocolPorts.Ranges,
+			Sources:     opts.SourceCIDRs,
+		})
+	}
+	return
+}
+
+// groupRules makes the rules of the groups, one per protocol and address family, with ascending priorities if asked.
+func groupRules(groups []cloudRuleGroup, opts *ExportOptions, ascending bool, maxDescription int) (rules []cloudRule) {
+	sourceIPv4, sourceIPv6 := splitFamilies(opts.SourceCIDRs)
+	priority := opts.nextPriority
+	for _, group := range groups {
+		destIPv4, destIPv6 := splitFamilies(group.CIDRs)
+		for _, protocolPorts := range group.Ports {
+			for _, family := range []struct {
+				suffix       string
+				sources      []string
+				destinations []string
+			}{{"", sourceIPv4, destIPv4}, {"-ipv6", sourceIPv6, destIPv6}} {
+				// A rule cannot mix address families, and a service restricted to addresses of another family does not get the rule
+				if len(family.sources) == 0 || (len(group.CIDRs) > 0 && len(family.destinations) == 0) {
+					continue
+				}
+				rules = append(rules, cloudRule{
+					Name:         cloudRuleName(opts.NamePrefix, group.Name, "-"+protocolPorts.Protocol+family.suffix),
+					Description:  cloudDescription(group.ShortNames, maxDescription),
+					Protocol:     protocolPorts.Protocol,
+					Ranges:       protocolPorts.Ranges,
+					Sources:      family.sources,
+					Destinations: family.destinations,
+					Priority:     priority,
+				})
+				if ascending {
+					priority++
+				}
+			}
+		}
+	}
+	return
+}
+
+/*
+serviceRules makes rules of each service individually. If there are more rules than the maximum, the services that
+are destined to the same CIDRs are combined into one group of rules, which merges their port ranges.
+*/
+func serviceRules(provider string, services []exportService, opts *ExportOptions, ascending bool, maxRules, maxDescription int) (rules []cloudRule, warnings []string, err error) {
+	groups := make([]cloudRuleGroup, 0, len(services))
+	for _, svc := range services {
+		groups = append(groups, cloudRuleGroup{Name: svc.ShortName, ShortNames: []string{svc.ShortName}, CIDRs: svc.CIDRs, Ports: svc.Ports})
+	}
+	rules = groupRules(groups, opts, ascending, maxDescription)
+	if maxRules <= 0 || len(rules) <= maxRules {
+		return
+	}
+	byCIDRs := make(map[string][]exportService)
+	keys := make([]string, 0, len(services))
+	for _, svc := range services {
+		key := strings.Join(svc.CIDRs, ",")
+		if _, exists := byCIDRs[key]; !exists {
+			keys = append(keys, key)
+		}
+		byCIDRs[key] = append(byCIDRs[key], svc)
+	}
+	groups = make([]cloudRuleGroup, 0, len(keys))
+	for i, key := range keys {
+		combined := byCIDRs[key]
+		group := cloudRuleGroup{Name: fmt.Sprintf("combined-%d", i+1), CIDRs: combined[0].CIDRs, Ports: mergePorts(combined)}
+		for _, svc := range combined {
+			group.ShortNames = append(group.ShortNames, svc.ShortName)
+		}
+		groups = append(groups, group)
+	}
+	combinedRules := groupRules(groups, opts, ascending, maxDescription)
+	if len(combinedRules) > maxRules {
+		return nil, nil, fmt.Errorf("%s: the %d rules of the services do not fit in %d rules even if the services are combined", provider, len(combinedRules), maxRules)
+	}
+	warnings = append(warnings, fmt.Sprintf("%s: services are combined into %d rules to fit in %d rules instead of %d", provider, len(combinedRules), maxRules, len(rules)))
+	return combinedRules, warnings, nil
+}
+
+/*
+cloudRules makes the rules of a cloud provider that allow traffic from the source CIDRs of the options to the ports of
+the services. The priority of the options is advanced past the rules, and the rules are counted, so that the next
+split file continues with the priority and shares the rule limit of the provider.
+*/
+func cloudRules(provider string, services []exportService, opts *ExportOptions) (rules []cloudRule, warnings []string, err error) {
+	if len(opts.SourceCIDRs) == 0 {
+		return nil, nil, &model.ValidationError{Source: "export", Key: "source CIDR", Message: "the CIDRs of clients are required by cloud rules"}
+	}
+	switch provider {
+	case "aws":
+		return awsRules(services, opts)
+	case "azure":
+		if opts.nextPriority < azureMinPriority || opts.nextPriority > azureMaxPriority {
+			return nil, nil, &model.ValidationError{Source: "export", Key: "priority", Value: fmt.Sprint(opts.nextPriority),
+				Message: fmt.Sprintf("the priority of Azure rules must be between %d and %d", azureMinPriority, azureMaxPriority)}
+		}
+		maxRules := azureMaxRules
+		if opts.MaxRules > 0 {
+			maxRules = opts.MaxRules
+		}
+		if maxRules -= opts.usedRules; maxRules < 1 {
+			return nil, nil, fmt.Errorf("%s: the previous files already take all %d rules", provider, opts.usedRules)
+		}
+		if remaining := azureMaxPriority - opts.nextPriority + 1; remaining < maxRules {
+			maxRules = remaining
+		}
+		rules, warnings, err = serviceRules(provider, services, opts, true, maxRules, azureMaxDescription)
+		opts.nextPriority += len(rules)
+		opts.usedRules += len(rules)
+		return
+	case "gcp":
+		if opts.nextPriority < gcpMinPriority || opts.nextPriority > gcpMaxPriority {
+			return nil, nil, &model.ValidationError{Source: "export", Key: "priority", Value: fmt.Sprint(opts.nextPriority),
+				Message: fmt.Sprintf("the priority of GCP rules must be between %d and %d", gcpMinPriority, gcpMaxPriority)}
+		}
+		maxRules := 0
+		if opts.MaxRules > 0 {
+			if maxRules = opts.MaxRules - opts.usedRules; maxRules < 1 {
+				return nil, nil, fmt.Errorf("%s: the previous files already take all %d rules", provider, opts.usedRules)
+			}
+		}
+		rules, warnings, err = serviceRules(provider, services, opts, false, maxRules, gcpMaxDescription)
+		opts.usedRules += len(rules)
+		return
+	}
+	return nil, nil, fmt.Errorf("unknown cloud provider \"%s\", the providers are: %s", provider, strings.Join(CloudProviders, ", "))
+}
+
+// marshalJSON returns the value as indented JSON that ends with a new line.
+func marshalJSON(v interface{}) (string, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+type awsIPRange struct {
+	CidrIp      string `json:"CidrIp"`
+	Description string `json:"Description,omitempty"`
+}
+
+type awsIPv6Range struct {
+	CidrIpv6    string `json:"CidrIpv6"`
+	Description string `json:"Description,omitempty"`
+}
+
+type awsPermission struct {
+	IpProtocol string         `json:"IpProtocol"`
+	FromPort   int            `json:"FromPort"`
+	ToPort     int            `json:"ToPort"`
+	IpRanges   []awsIPRange   `json:"IpRanges,omitempty"`
+	Ipv6Ranges []awsIPv6Range `json:"Ipv6Ranges,omitempty"`
+}
+
+/*
+renderAWS renders the ingress permissions of a security group in the input format of
+"aws ec2 authorize-security-group-ingress --cli-input-json", which takes the group ID as an additional argument.
+*/
+func renderAWS(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	rules, warnings, err := cloudRules("aws", services, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	permissions := make([]awsPermission, 0, len(rules))
+	for _, rule := range rules {
+		ipv4, ipv6 := splitFamilies(rule.Sources)
+		for _, portRange := range rule.Ranges {
+			permission := awsPermission{IpProtocol: rule.Protocol, FromPort: portRange.First, ToPort: portRange.Last}
+			for _, cidr := range ipv4 {
+				permission.IpRanges = append(permission.IpRanges, awsIPRange{CidrIp: cidr, Description: rule.Description})
+			}
+			for _, cidr := range ipv6 {
+				permission.Ipv6Ranges = append(permission.Ipv6Ranges, awsIPv6Range{CidrIpv6: cidr, Description: rule.Description})
+			}
+			permissions = append(permissions, permission)
+		}
+	}
+	content, err := marshalJSON(struct {
+		IpPermissions []awsPermission `json:"IpPermissions"`
+	}{permissions})
+	return content, warnings, err
+}
+
+type azureRuleProperties struct {
+	Description                string   `json:"description"`
+	Protocol                   string   `json:"protocol"`
+	SourcePortRange            string   `json:"sourcePortRange"`
+	DestinationPortRanges      []string `json:"destinationPortRanges"`
+	SourceAddressPrefixes      []string `json:"sourceAddressPrefixes"`
+	DestinationAddressPrefix   string   `json:"destinationAddressPrefix,omitempty"`
+	DestinationAddressPrefixes []string `json:"destinationAddressPrefixes,omitempty"`
+	Access                     string   `json:"access"`
+	Priority                   int      `json:"priority"`
+	Direction                  string   `json:"direction"`
+}
+
+type azureRule struct {
+	Name       string              `json:"name"`
+	Properties azureRuleProperties `json:"properties"`
+}
+
+// azureProtocol returns the protocol of a firewalld port in the notation of Azure, such as Tcp.
+func azureProtocol(protocol string) string {
+	return strings.ToUpper(protocol[:1]) + protocol[1:]
+}
+
+// renderAzure renders the security rules of a network security group in the notation of ARM templates.
+func renderAzure(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	rules, warnings, err := cloudRules("azure", services, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	azureRules := make([]azureRule, 0, len(rules))
+	for _, rule := range rules {
+		properties := azureRuleProperties{
+			Description:                rule.Description,
+			Protocol:                   azureProtocol(rule.Protocol),
+			SourcePortRange:            "*",
+			DestinationPortRanges:      rule.PortStrings(),
+			SourceAddressPrefixes:      rule.Sources,
+			DestinationAddressPrefixes: rule.Destinations,
+			Access:                     "Allow",
+			Priority:                   rule.Priority,
+			Direction:                  "Inbound",
+		}
+		if len(rule.Destinations) == 0 {
+			properties.DestinationAddressPrefix = "*"
+		}
+		azureRules = append(azureRules, azureRule{Name: rule.Name, Properties: properties})
+	}
+	content, err := marshalJSON(struct {
+		SecurityRules []azureRule `json:"securityRules"`
+	}{azureRules})
+	return content, warnings, err
+}
+
+type gcpAllowed struct {
+	IPProtocol string   `json:"IPProtocol"`
+	Ports      []string `json:"ports"`
+}
+
+type gcpFirewall struct {
+	Name              string       `json:"name"`
+	Description       string       `json:"description"`
+	Direction         string       `json:"direction"`
+	Priority          int          `json:"priority"`
+	SourceRanges      []string     `json:"sourceRanges"`
+	DestinationRanges []string     `json:"destinationRanges,omitempty"`
+	Allowed           []gcpAllowed `json:"allowed"`
+}
+
+/*
+renderGCP renders a list of VPC firewall rules in the notation of the Compute Engine API, the network of each rule is
+left to be filled in.
+*/
+func renderGCP(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	rules, warnings, err := cloudRules("gcp", services, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	firewalls := make([]gcpFirewall, 0, len(rules))
+	for _, rule := range rules {
+		firewalls = append(firewalls, gcpFirewall{
+			Name:              rule.Name,
+			Description:       rule.Description,
+			Direction:         "INGRESS",
+			Priority:          rule.Priority,
+			SourceRanges:      rule.Sources,
+			DestinationRanges: rule.Destinations,
+			Allowed:           []gcpAllowed{{IPProtocol: rule.Protocol, Ports: rule.PortStrings()}},
+		})
+	}
+	content, err := marshalJSON(firewalls)
+	return content, warnings, err
+}
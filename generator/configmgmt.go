@@ -0,0 +1,205 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// firewalldDefinition is an XML file of firewalld configuration that a configuration management tool installs.
+type firewalldDefinition struct {
+	Path    string
+	Content string
+	Service string // Service is the short name of the service defined by the file, or empty for the policy.
+}
+
+/*
+firewalldDefinitions returns the service XML files of the services and the policy XML file, if there is a policy. The
+files carry the ownership marker and provenance, just like the files of generate-firewalld-services, so that both
+ways of installing them recognise each other's files.
+*/
+func firewalldDefinitions(services []exportService, opts *ExportOptions) (ret []firewalldDefinition) {
+	fw := opts.Firewalld
+	if fw == nil {
+		fw = &Firewalld{}
+	}
+	for _, svc := range services {
+		def, _ := fw.definitionOf(svc.ShortName)
+		ret = append(ret, firewalldDefinition{
+			Path:    path.Join("/etc/firewalld/services", svc.ShortName+".xml"),
+			Content: fw.serviceXML(svc.Firewalld, def),
+			Service: svc.ShortName,
+		})
+	}
+	if opts.Policy != nil {
+		ret = append(ret, firewalldDefinition{Path: path.Join("/etc/firewalld/policies", PolicyName+".xml"), Content: fw.policyXML(*opts.Policy)})
+	}
+	return
+}
+
+// zoneAssignments returns zone name vs the short names of those services allowed in the zone, in zone name order.
+func zoneAssignments(services []exportService, opts *ExportOptions) (zoneNames []string, assignments map[string][]string) {
+	assignments = make(map[string][]string)
+	for zoneName, allowed := range opts.Zones {
+		for _, shortName := range allowed {
+			for _, svc := range services {
+				if svc.ShortName == shortName {
+					assignments[zoneName] = append(assignments[zoneName], shortName)
+				}
+			}
+		}
+		if len(assignments[zoneName]) > 0 {
+			zoneNames = append(zoneNames, zoneName)
+		}
+	}
+	sort.Strings(zoneNames)
+	return
+}
+
+// writeYAMLBlock writes the text as a literal block scalar, whose lines are indented by the indentation.
+func writeYAMLBlock(out *bytes.Buffer, indent, text string) {
+	out.WriteString("|\n")
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			out.WriteString("\n")
+		} else {
+			out.WriteString(indent + line + "\n")
+		}
+	}
+}
+
+/*
+renderAnsible renders a task file that installs the XML files of the services and policy, reloads firewalld if any of
+them changed, and allows the services in the zones that are configured to allow them.
+*/
+func renderAnsible(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(services))
+	register := strings.Replace(name, "-", "_", -1) + "_definitions"
+	if definitions := firewalldDefinitions(services, opts); len(definitions) > 0 {
+		out.WriteString("- name: Install HANA firewalld definitions\n")
+		out.WriteString("  ansible.builtin.copy:\n")
+		out.WriteString("    dest: \"{{ item.dest }}\"\n")
+		out.WriteString("    content: \"{{ item.content }}\"\n")
+		out.WriteString("    owner: root\n")
+		out.WriteString("    group: root\n")
+		out.WriteString("    mode: \"0600\"\n")
+		out.WriteString("  loop:\n")
+		for _, definition := range definitions {
+			fmt.Fprintf(&out, "    - dest: %s\n", yamlString(definition.Path))
+			out.WriteString("      content: ")
+			writeYAMLBlock(&out, "        ", definition.Content)
+		}
+		out.WriteString("  loop_control:\n")
+		out.WriteString("    label: \"{{ item.dest }}\"\n")
+		fmt.Fprintf(&out, "  register: %s\n", register)
+		out.WriteString("\n")
+		out.WriteString("- name: Reload firewalld to load HANA firewalld definitions\n")
+		out.WriteString("  ansible.builtin.systemd:\n")
+		out.WriteString("    name: firewalld\n")
+		out.WriteString("    state: reloaded\n")
+		fmt.Fprintf(&out, "  when: %s.changed\n", register)
+	}
+	if zoneNames, assignments := zoneAssignments(services, opts); len(zoneNames) > 0 {
+		out.WriteString("\n")
+		out.WriteString("- name: Allow HANA firewalld services in zones\n")
+		out.WriteString("  ansible.posix.firewalld:\n")
+		out.WriteString("    zone: \"{{ item.zone }}\"\n")
+		out.WriteString("    service: \"{{ item.service }}\"\n")
+		out.WriteString("    permanent: true\n")
+		out.WriteString("    immediate: true\n")
+		out.WriteString("    state: enabled\n")
+		out.WriteString("  loop:\n")
+		for _, zoneName := range zoneNames {
+			for _, shortName := range assignments[zoneName] {
+				fmt.Fprintf(&out, "    - zone: %s\n", yamlString(zoneName))
+				fmt.Fprintf(&out, "      service: %s\n", yamlString(shortName))
+			}
+		}
+		out.WriteString("  loop_control:\n")
+		out.WriteString("    label: \"{{ item.service }} in {{ item.zone }}\"\n")
+	}
+	return out.String(), nil, nil
+}
+
+/*
+renderSalt renders a state file of firewalld.service states that define the services, and firewalld.present states
+that allow them in the zones that are configured to allow them. Salt cannot define the destination of a service nor a
+policy, hence the XML files of those are managed as files and firewalld is reloaded when they change.
+*/
+func renderSalt(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(services))
+	requisites := make(map[string]string) // service short name vs requisite that defines the service
+	managedFiles := make([]string, 0, 2)
+	for _, definition := range firewalldDefinitions(services, opts) {
+		id := PolicyName + "-policy"
+		if definition.Service != "" {
+			id = PolicyName + "-service-" + definition.Service
+		}
+		var svc *exportService
+		for i := range services {
+			if services[i].ShortName == definition.Service {
+				svc = &services[i]
+			}
+		}
+		out.WriteString("\n")
+		fmt.Fprintf(&out, "%s:\n", id)
+		if svc != nil && !svc.Destination {
+			requisites[svc.ShortName] = "firewalld: " + id
+			out.WriteString("  firewalld.service:\n")
+			fmt.Fprintf(&out, "    - name: %s\n", svc.ShortName)
+			out.WriteString("    - ports:\n")
+			for _, ports := range svc.Ports {
+				for _, portRange := range ports.Ranges {
+					fmt.Fprintf(&out, "      - %s/%s\n", portRange, ports.Protocol)
+				}
+			}
+			continue
+		}
+		if svc != nil {
+			requisites[svc.ShortName] = "cmd: " + name + "-reload"
+		}
+		managedFiles = append(managedFiles, id)
+		out.WriteString("  file.managed:\n")
+		fmt.Fprintf(&out, "    - name: %s\n", definition.Path)
+		out.WriteString("    - user: root\n")
+		out.WriteString("    - group: root\n")
+		out.WriteString("    - mode: \"0600\"\n")
+		out.WriteString("    - contents: ")
+		writeYAMLBlock(&out, "        ", definition.Content)
+	}
+	if len(managedFiles) > 0 {
+		out.WriteString("\n")
+		fmt.Fprintf(&out, "%s-reload:\n", name)
+		out.WriteString("  cmd.run:\n")
+		out.WriteString("    - name: firewall-cmd --reload\n")
+		out.WriteString("    - onchanges:\n")
+		for _, id := range managedFiles {
+			fmt.Fprintf(&out, "      - file: %s\n", id)
+		}
+	}
+	zoneNames, assignments := zoneAssignments(services, opts)
+	for _, zoneName := range zoneNames {
+		out.WriteString("\n")
+		fmt.Fprintf(&out, "%s-zone-%s:\n", name, zoneName)
+		out.WriteString("  firewalld.present:\n")
+		fmt.Fprintf(&out, "    - name: %s\n", yamlString(zoneName))
+		out.WriteString("    - services:\n")
+		for _, shortName := range assignments[zoneName] {
+			fmt.Fprintf(&out, "      - %s\n", shortName)
+		}
+		out.WriteString("    - prune_services: False\n")
+		out.WriteString("    - require:\n")
+		required := make(map[string]bool)
+		for _, shortName := range assignments[zoneName] {
+			if requisite := requisites[shortName]; !required[requisite] {
+				required[requisite] = true
+				fmt.Fprintf(&out, "      - %s\n", requisite)
+			}
+		}
+	}
+	return out.String(), nil, nil
+}
@@ -0,0 +1,30 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WriteError tells that generated configuration could not be written into, or removed from, the file system.
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("failed to write \"%s\" - %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// ModifiedError tells that generated files were modified by hand, hence they were neither overwritten nor removed.
+type ModifiedError struct {
+	Paths []string
+}
+
+func (e *ModifiedError) Error() string {
+	return fmt.Sprintf("refuse to overwrite or remove generated files that were modified by hand: %s", strings.Join(e.Paths, ", "))
+}
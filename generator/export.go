@@ -0,0 +1,229 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportFormats are the formats that Export renders, in the order they are presented to users.
+var ExportFormats = []string{"kubernetes", "cilium", "aws", "azure", "gcp", "terraform", "ansible", "salt"}
+
+// DefaultExportPriority is the priority of the first rule of cloud formats that have rule priorities.
+const DefaultExportPriority = 1000
+
+// ExportOptions are the settings of rendering generated services in another firewall's format.
+type ExportOptions struct {
+	CIDRs       []string               // CIDRs of the HANA hosts, they are used for services that do not carry a destination.
+	Namespace   string                 // Namespace of Kubernetes policies, it may be empty.
+	PodSelector map[string]string      // PodSelector are the labels of client pods, all pods are selected if it is empty.
+	Split       bool                   // Split renders one file per service instead of a single file.
+	SourceCIDRs []string               // SourceCIDRs are the clients that cloud rules allow traffic from.
+	Priority    *int                   // Priority of the first cloud rule, nil means DefaultExportPriority.
+	NamePrefix  string                 // NamePrefix of cloud rule names, an empty prefix means "hana-firewall-".
+	Provider    string                 // Provider is the cloud of the terraform format: aws, azure, or gcp.
+	MaxRules    int                    // MaxRules overrides the rule limit of the cloud provider, 0 keeps the limit.
+	Zones       map[string][]string    // Zones are firewalld zone name vs the short names of services allowed in it.
+	Policy      *model.FirewalldPolicy // Policy is the firewalld policy of routed HANA traffic, it may be nil.
+	// Firewalld serialises the XML files installed by configuration management, the same way as they are generated.
+	Firewalld *Firewalld
+
+	nextPriority int // nextPriority is the priority of the next cloud rule, split files continue the priorities.
+	usedRules    int // usedRules counts the cloud rules of previous split files, they share the rule limit.
+}
+
+// exportFormat renders prepared services into a file of a format, along with warnings about the rendering.
+type exportFormat struct {
+	Extension  string
+	NeedsCIDRs bool // NeedsCIDRs is true if every service must be destined to CIDRs.
+	Policy     bool // Policy is true if the format carries the firewalld policy and zone assignments.
+	Render     func(name string, services []exportService, opts *ExportOptions) (string, []string, error)
+}
+
+// exportFormats are the renderers of export formats.
+var exportFormats = map[string]exportFormat{
+	"kubernetes": {Extension: ".yaml", NeedsCIDRs: true, Render: renderKubernetes},
+	"cilium":     {Extension: ".yaml", NeedsCIDRs: true, Render: renderCilium},
+	"aws":        {Extension: ".json", Render: renderAWS},
+	"azure":      {Extension: ".json", Render: renderAzure},
+	"gcp":        {Extension: ".json", Render: renderGCP},
+	"terraform":  {Extension: ".tf", Render: renderTerraform},
+	"ansible":    {Extension: ".yml", Policy: true, Render: renderAnsible},
+	"salt":       {Extension: ".sls", Policy: true, Render: renderSalt},
+}
+
+// exportPorts are the ports of a service folded into ranges, per protocol.
+type exportPorts struct {
+	Protocol string
+	Ranges   []model.PortRange
+}
+
+// exportService is a generated firewalld service prepared for rendering in other formats.
+type exportService struct {
+	ShortName   string
+	Description string
+	CIDRs       []string
+	Destination bool // Destination is true if the CIDRs are the addresses that the service is restricted to.
+	Ports       []exportPorts
+	Firewalld   model.FirewalldService
+}
+
+/*
+prepareExport sorts the services by short name, folds their ports into ranges, and works out the CIDRs that the traffic
+is destined to. A service that carries a destination uses its addresses, the others use the CIDRs of the options, if
+there are any.
+*/
+func prepareExport(services map[string]model.FirewalldService, opts ExportOptions) (ret []exportService, err error) {
+	names := make([]string, 0, len(services))
+	for shortName := range services {
+		names = append(names, shortName)
+	}
+	sort.Strings(names)
+	ret = make([]exportService, 0, len(names))
+	for _, shortName := range names {
+		svc := services[shortName]
+		prepared := exportService{ShortName: shortName, Description: svc.Description, CIDRs: opts.CIDRs, Firewalld: svc}
+		if svc.Destination != nil {
+			prepared.Destination = true
+			prepared.CIDRs = make([]string, 0, 2)
+			for _, addr := range []string{svc.Destination.IPv4, svc.Destination.IPv6} {
+				if addr != "" {
+					prepared.CIDRs = append(prepared.CIDRs, hostCIDR(addr))
+				}
+			}
+		}
+		for _, protocol := range []string{model.FirewalldProtocolTCP, model.FirewalldProtocolUDP} {
+			ports := make([]int, 0, len(svc.Ports))
+			for _, port := range svc.Ports {
+				if port.Protocol == protocol {
+					ports = append(ports, port.Port)
+				}
+			}
+			if len(ports) > 0 {
+				prepared.Ports = append(prepared.Ports, exportPorts{Protocol: protocol, Ranges: model.FoldPortRanges(ports)})
+			}
+		}
+		ret = append(ret, prepared)
+	}
+	return
+}
+
+// hostCIDR turns a single address into a CIDR of that host, an address that carries a mask is returned as-is.
+func hostCIDR(addr string) string {
+	if strings.ContainsRune(addr, '/') {
+		return addr
+	}
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return addr + "/128"
+	}
+	return addr + "/32"
+}
+
+// ValidateCIDRs returns an error if any of the CIDRs is not an IPv4 or IPv6 network written as ADDRESS/MASK.
+func ValidateCIDRs(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return &model.ValidationError{Key: "CIDR", Value: cidr, Message: "the value must be an IPv4 or IPv6 network such as 10.0.0.0/24"}
+		}
+	}
+	return nil
+}
+
+// exportName returns a name of at most 63 characters made of lower case letters, digits, and dashes.
+func exportName(prefix, shortName string) string {
+	name := strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			return c
+		} else if c >= 'A' && c <= 'Z' {
+			return c - 'A' + 'a'
+		}
+		return '-'
+	}, prefix+shortName)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// yamlString quotes the text as a YAML double-quoted scalar, which shares the escape sequences of Go string literals.
+func yamlString(text string) string {
+	return strconv.Quote(text)
+}
+
+/*
+Export renders the generated firewalld services in another firewall's format, and returns file name vs file content,
+along with warnings about rules that had to be changed to fit in the limits of the format. If the options ask for split
+output, every service goes into its own file named after the service, otherwise there is a single file named after
+PolicyName. Cloud rules of split files continue the priorities of the previous file and share the rule limit of the
+provider, so that they may go into the same group, and formats that carry the firewalld policy put it into a file of
+its own.
+*/
+func Export(format string, services map[string]model.FirewalldService, opts ExportOptions) (files map[string]string, warnings []string, err error) {
+	exporter, found := exportFormats[format]
+	if !found {
+		return nil, nil, fmt.Errorf("unknown export format \"%s\", the formats are: %s", format, strings.Join(ExportFormats, ", "))
+	}
+	if format == "terraform" && !isCloudProvider(opts.Provider) {
+		return nil, nil, &model.ValidationError{Source: "export", Key: "provider", Value: opts.Provider, Message: "the provider must be one of: " + strings.Join(CloudProviders, ", ")}
+	}
+	if err = ValidateCIDRs(opts.CIDRs); err != nil {
+		return
+	}
+	if err = ValidateCIDRs(opts.SourceCIDRs); err != nil {
+		return
+	}
+	opts.nextPriority = DefaultExportPriority
+	if opts.Priority != nil {
+		opts.nextPriority = *opts.Priority
+	}
+	if opts.NamePrefix == "" {
+		opts.NamePrefix = PolicyName + "-"
+	}
+	prepared, err := prepareExport(services, opts)
+	if err != nil {
+		return
+	}
+	for _, svc := range prepared {
+		if exporter.NeedsCIDRs && len(svc.CIDRs) == 0 {
+			return nil, nil, &model.ValidationError{Source: "export", Key: "CIDR", Message: fmt.Sprintf("the CIDRs of HANA hosts are required for service %s, which is not restricted to instance addresses", svc.ShortName)}
+		}
+	}
+	groups := [][]exportService{prepared}
+	names := []string{PolicyName}
+	if opts.Split {
+		groups, names = nil, nil
+		for _, svc := range prepared {
+			groups = append(groups, []exportService{svc})
+			names = append(names, exportName(PolicyName+"-", svc.ShortName))
+		}
+	}
+	policy := opts.Policy
+	if opts.Split {
+		opts.Policy = nil
+	}
+	files = make(map[string]string)
+	for i, group := range groups {
+		content, groupWarnings, err := exporter.Render(names[i], group, &opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[names[i]+exporter.Extension] = content
+		warnings = append(warnings, groupWarnings...)
+	}
+	if opts.Split && policy != nil && exporter.Policy {
+		opts.Policy = policy
+		name := exportName(PolicyName+"-", "policy")
+		content, _, err := exporter.Render(name, nil, &opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[name+exporter.Extension] = content
+	}
+	if format == "terraform" {
+		files[terraformVariablesFile] = terraformVariables(opts.Provider)
+	}
+	return
+}
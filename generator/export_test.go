@@ -0,0 +1,242 @@
+package generator
+
+import (
+	"flag"
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files of export formats in testdata")
+
+// exportTestServices are the generated services that export tests render.
+var exportTestServices = map[string]model.FirewalldService{
+	"hana-database-client": {
+		ShortName:   "HANA database client access",
+		Description: "Provide access to system database and all tenant databases.",
+		Ports: []model.FirewalldPort{
+			{Port: 30013, Protocol: "tcp"}, {Port: 30015, Protocol: "tcp"},
+			{Port: 30041, Protocol: "tcp"}, {Port: 30042, Protocol: "tcp"}, {Port: 30043, Protocol: "tcp"},
+		},
+	},
+	"hana-database-client-10": {
+		ShortName:   "HANA database client access (instance 10)",
+		Description: "Provide access to system database and all tenant databases.",
+		Ports:       []model.FirewalldPort{{Port: 31013, Protocol: "tcp"}, {Port: 31015, Protocol: "tcp"}},
+		Destination: &model.FirewalldDestination{IPv4: "192.168.1.10", IPv6: "fd00::10"},
+	},
+	"sap-special-support": {
+		ShortName:   "HANA special support",
+		Description: "The ports should be used in rare technical support scenarios.",
+		Ports:       []model.FirewalldPort{{Port: 1128, Protocol: "tcp"}, {Port: 1129, Protocol: "tcp"}, {Port: 1129, Protocol: "udp"}},
+	},
+}
+
+// checkGoldenFiles compares the exported files with those in the golden directory, or updates the golden directory.
+func checkGoldenFiles(t *testing.T, goldenDir string, files map[string]string) {
+	if *updateGolden {
+		os.RemoveAll(goldenDir)
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(path.Join(goldenDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+	entries, err := ioutil.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		goldenNames = append(goldenNames, entry.Name())
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, goldenNames) {
+		t.Fatalf("%s: files %v, golden files %v", goldenDir, names, goldenNames)
+	}
+	for name, content := range files {
+		golden, err := ioutil.ReadFile(path.Join(goldenDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != string(golden) {
+			t.Fatalf("%s/%s differs from golden file:\n%s", goldenDir, name, content)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	priority := 200
+	opts := ExportOptions{
+		CIDRs:       []string{"10.0.0.0/24", "fd00::/64"},
+		Namespace:   "erp",
+		PodSelector: map[string]string{"app": "erp", "tier": "application"},
+		SourceCIDRs: []string{"10.1.0.0/16", "fd01::/48"},
+		Priority:    &priority,
+		Zones: map[string][]string{
+			"public":   {"sap-special-support", "hana-database-client"},
+			"internal": {"hana-database-client-10", "ssh"},
+		},
+		Policy: &model.FirewalldPolicy{
+			Target:       "CONTINUE",
+			ShortName:    PolicyName,
+			Description:  "Allow HANA services to be reached from zones external",
+			IngressZones: model.MakeFirewalldNameRefs([]string{"external"}),
+			EgressZones:  model.MakeFirewalldNameRefs([]string{"HOST"}),
+			Services:     model.MakeFirewalldNameRefs([]string{"hana-database-client", "hana-database-client-10", "sap-special-support"}),
+		},
+		Firewalld: &Firewalld{
+			HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00", "10"}},
+			HANAServices: []model.HANAServiceDefinition{
+				{FileBaseName: "HANA database client", FilePath: "/usr/share/hana-firewall/HANA database client"},
+			},
+		},
+	}
+	for _, format := range ExportFormats {
+		providers := []string{""}
+		if format == "terraform" {
+			providers = CloudProviders
+		}
+		for _, provider := range providers {
+			for _, split := range []bool{false, true} {
+				opts.Provider = provider
+				opts.Split = split
+				files, _, err := Export(format, exportTestServices, opts)
+				if err != nil {
+					t.Fatal(format, provider, err)
+				}
+				goldenDir := path.Join("testdata", "export", format)
+				if provider != "" {
+					goldenDir += "-" + provider
+				}
+				if split {
+					goldenDir += "-split"
+				}
+				checkGoldenFiles(t, goldenDir, files)
+			}
+		}
+	}
+}
+
+func TestExport_CloudLimits(t *testing.T) {
+	opts := ExportOptions{SourceCIDRs: []string{"10.1.0.0/16"}, MaxRules: 3}
+	// AWS merges the closest port ranges, 1128-1129/tcp is too far from the others and 1129/udp is the only UDP range
+	files, warnings, err := Export("aws", exportTestServices, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(warnings, []string{
+		"aws: security groups cannot restrict the destination address of service hana-database-client-10, its ports are allowed to all instances of the group",
+		"aws: port ranges are merged to fit in 3 rules of a security group, which also allows tcp ports 30014 30016-30040 30044-31012 31014",
+	}) {
+		t.Fatal(warnings)
+	}
+	if content := files["hana-firewall.json"]; !strings.Contains(content, `"FromPort": 30013,
+      "ToPort": 31015`) {
+		t.Fatal(content)
+	}
+	// Two source CIDRs leave room for a single range per protocol, which is not enough for TCP and UDP
+	opts.SourceCIDRs = []string{"10.1.0.0/16", "10.2.0.0/16"}
+	if _, _, err := Export("aws", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+
+	// Azure combines services of the same destination, the instance service keeps its own rules
+	priority := 4094
+	opts = ExportOptions{SourceCIDRs: []string{"10.1.0.0/16"}, Priority: &priority}
+	files, warnings, err = Export("azure", exportTestServices, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(warnings, []string{"azure: services are combined into 3 rules to fit in 3 rules instead of 4"}) {
+		t.Fatal(warnings)
+	}
+	for _, name := range []string{"hana-firewall-combined-1-tcp", "hana-firewall-combined-1-udp", "hana-firewall-combined-2-tcp", `"priority": 4096`} {
+		if !strings.Contains(files["hana-firewall.json"], name) {
+			t.Fatal(name, files["hana-firewall.json"])
+		}
+	}
+	priority = 4096
+	if _, _, err := Export("azure", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+	priority = 99
+	if _, _, err := Export("azure", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+	// Split files continue the priorities
+	opts = ExportOptions{SourceCIDRs: []string{"10.1.0.0/16"}, Split: true}
+	files, _, err = Export("azure", exportTestServices, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(files["hana-firewall-sap-special-support.json"], `"priority": 1002`) {
+		t.Fatal(files)
+	}
+	// Split files share the rule limit
+	opts.MaxRules = 3
+	if _, _, err := Export("azure", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+	opts.MaxRules = 4
+	if _, _, err := Export("gcp", exportTestServices, opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.MaxRules = 3
+	if _, _, err := Export("gcp", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+	opts.MaxRules = 0
+	if files, _, err = Export("aws", exportTestServices, opts); err != nil || len(files) != 3 {
+		t.Fatal(files, err)
+	}
+	opts.MaxRules = 2
+	if _, _, err := Export("aws", exportTestServices, opts); err == nil {
+		t.Fatal("did not error")
+	}
+	// GCP accepts priority 0
+	priority = 0
+	opts = ExportOptions{SourceCIDRs: []string{"10.1.0.0/16"}, Priority: &priority}
+	if files, _, err = Export("gcp", exportTestServices, opts); err != nil || !strings.Contains(files["hana-firewall.json"], `"priority": 0`) {
+		t.Fatal(files, err)
+	}
+}
+
+func TestExport_Invalid(t *testing.T) {
+	if _, _, err := Export("iptables", exportTestServices, ExportOptions{CIDRs: []string{"10.0.0.0/24"}}); err == nil {
+		t.Fatal("did not error")
+	}
+	if _, _, err := Export("kubernetes", exportTestServices, ExportOptions{CIDRs: []string{"10.0.0.1"}}); err == nil {
+		t.Fatal("did not error")
+	}
+	// Services without destination need CIDRs
+	if _, _, err := Export("kubernetes", exportTestServices, ExportOptions{}); err == nil {
+		t.Fatal("did not error")
+	}
+	// Cloud rules need source CIDRs, and terraform needs a provider
+	if _, _, err := Export("gcp", exportTestServices, ExportOptions{}); err == nil {
+		t.Fatal("did not error")
+	}
+	if _, _, err := Export("gcp", exportTestServices, ExportOptions{SourceCIDRs: []string{"10.1.0.0"}}); err == nil {
+		t.Fatal("did not error")
+	}
+	if _, _, err := Export("terraform", exportTestServices, ExportOptions{SourceCIDRs: []string{"10.1.0.0/16"}, Provider: "openstack"}); err == nil {
+		t.Fatal("did not error")
+	}
+	if files, _, err := Export("kubernetes", map[string]model.FirewalldService{"a": exportTestServices["hana-database-client-10"]}, ExportOptions{}); err != nil || len(files) != 1 {
+		t.Fatal(files, err)
+	}
+}
@@ -6,20 +6,74 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
+	"sort"
+	"strings"
 )
 
+// PolicyName is the name of firewalld policy (and its XML file) that is generated for routed HANA traffic.
+const PolicyName = "hana-firewall"
+
+// Version of hana-firewall that is recorded in generated files, it may be overridden at build time by "-ldflags -X".
+var Version = "2.0"
+
 // Firewalld takes input from existing service configuration to install HANA firewall configuration.
 type Firewalld struct {
 	// HANAGlobal is the global configuration of HANA services.
 	HANAGlobal model.HANAGlobalParameters
 	// HANAServiceDefinition has association between short name of HANA services and their definitions.
 	HANAServices []model.HANAServiceDefinition
+	// Force overwrites and removes generated files even if they were modified by hand.
+	Force bool
 }
 
-// GenerateConfig takes HANA configuration as input returns generated XML file paths vs firewalld service definition.
+/*
+ApplicableServices returns the HANA service definitions that should be turned into firewalld services, and the file
+base name vs reason of those definitions that are skipped.
+*/
+func (fw *Firewalld) ApplicableServices() (applicable []model.HANAServiceDefinition, skipped map[string]string) {
+	applicable = make([]model.HANAServiceDefinition, 0, len(fw.HANAServices))
+	skipped = make(map[string]string)
+	for _, def := range fw.HANAServices {
+		if ok, reason := fw.HANAGlobal.IsApplicable(&def); ok {
+			applicable = append(applicable, def)
+		} else {
+			skipped[def.FileBaseName] = reason
+		}
+	}
+	return
+}
+
+/*
+GenerateConfig takes HANA configuration as input returns generated XML file paths vs firewalld service definition.
+Definitions that are disabled or whose conditions do not match are skipped. If system replication peers are
+configured, a replication definition yields one service per adjacent peer. If instance destinations are configured, a
+definition that depends on the instance number yields one service per instance that has destination addresses.
+*/
 func (fw *Firewalld) GenerateConfig() (ret map[string]model.FirewalldService, err error) {
 	ret = make(map[string]model.FirewalldService)
-	for _, def := range fw.HANAServices {
+	applicable, _ := fw.ApplicableServices()
+	for _, def := range applicable {
+		if def.Replication && fw.HANAGlobal.ReplicationEnabled() {
+			peerServices, err := fw.HANAGlobal.MakeReplicationServices(&def)
+			if err != nil {
+				return nil, err
+			}
+			for shortName, svc := range peerServices {
+				ret[shortName] = svc
+			}
+			continue
+		}
+		if !def.Replication && fw.HANAGlobal.DestinationsEnabled() && def.DependsOnInstance() {
+			instanceServices, err := fw.HANAGlobal.MakeInstanceServices(&def)
+			if err != nil {
+				return nil, err
+			}
+			for shortName, svc := range instanceServices {
+				ret[shortName] = svc
+			}
+			continue
+		}
 		shortName, svc, err := fw.HANAGlobal.MakeFirewalldService(&def)
 		if err != nil {
 			return nil, err
@@ -29,16 +83,256 @@ func (fw *Firewalld) GenerateConfig() (ret map[string]model.FirewalldService, er
 	return
 }
 
-// WriteConfig serialises firewalld service definition into XML files and place them under the directory.
+/*
+definitionOf returns the HANA service definition that the firewalld service of the short name is generated from,
+including the services generated for system replication peers and for instances. If the short name is not generated
+from a definition of the same name, the definition of the longest matching name prefix wins.
+*/
+func (fw *Firewalld) definitionOf(shortName string) (def model.HANAServiceDefinition, found bool) {
+	for _, candidate := range fw.HANAServices {
+		candidateName := candidate.GetShortName()
+		if candidateName == shortName {
+			return candidate, true
+		}
+		if strings.HasPrefix(shortName, candidateName+"-") && (!found || len(candidateName) > len(def.GetShortName())) {
+			def, found = candidate, true
+		}
+	}
+	return
+}
+
+/*
+GeneratedNamesOf returns the sorted names of generated firewalld services that come from the HANA service definition of
+the short name, such as the services generated per system replication peer and per instance. The services are the
+output of GenerateConfig.
+*/
+func (fw *Firewalld) GeneratedNamesOf(services map[string]model.FirewalldService, shortName string) (ret []string) {
+	ret = make([]string, 0, 0)
+	for name := range services {
+		if def, found := fw.definitionOf(name); found && def.GetShortName() == shortName {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return
+}
+
+/*
+GeneratePolicies returns policy name vs firewalld policy definition that allows the generated services to be used by
+traffic flowing from ingress zones to egress zones. If the global configuration does not ask for policy, the returned
+map is empty.
+*/
+func (fw *Firewalld) GeneratePolicies(services map[string]model.FirewalldService) map[string]model.FirewalldPolicy {
+	ret := make(map[string]model.FirewalldPolicy)
+	if !fw.HANAGlobal.PolicyEnabled() || len(services) == 0 {
+		return ret
+	}
+	serviceNames := make([]string, 0, len(services))
+	for shortName := range services {
+		serviceNames = append(serviceNames, shortName)
+	}
+	sort.Strings(serviceNames)
+	ret[PolicyName] = model.FirewalldPolicy{
+		Target:       "CONTINUE",
+		ShortName:    PolicyName,
+		Description:  "Allow HANA services to be reached from zones " + strings.Join(fw.HANAGlobal.PolicyIngressZones, ", "),
+		IngressZones: model.MakeFirewalldNameRefs(fw.HANAGlobal.PolicyIngressZones),
+		EgressZones:  model.MakeFirewalldNameRefs(fw.HANAGlobal.PolicyEgressZones),
+		Services:     model.MakeFirewalldNameRefs(serviceNames),
+	}
+	return ret
+}
+
+// provenance returns the provenance of a generated file, made from the source files.
+func (fw *Firewalld) provenance(sources ...string) model.Provenance {
+	return model.Provenance{
+		Version:         Version,
+		Sources:         sources,
+		InstanceNumbers: fw.HANAGlobal.InstanceNumbers,
+	}
+}
+
+// serviceXML serialises firewalld service into XML along with the provenance of the HANA service definition.
+func (fw *Firewalld) serviceXML(svc model.FirewalldService, def model.HANAServiceDefinition) string {
+	sources := []string{}
+	if def.FilePath != "" {
+		sources = append(sources, def.FilePath)
+	}
+	return svc.ToXMLWithProvenance(fw.provenance(sources...))
+}
+
+// policyXML serialises firewalld policy into XML along with the provenance of the global configuration.
+func (fw *Firewalld) policyXML(policy model.FirewalldPolicy) string {
+	return policy.ToXMLWithProvenance(fw.provenance(model.HANAGlobalParametersFile))
+}
+
+/*
+WriteConfig serialises firewalld service definition into XML files and place them under the directory.
+Previously generated XML files that no longer correspond to a service are removed. Unless Force is set, generated files
+that were modified by hand are neither overwritten nor removed, and ModifiedError is returned instead.
+*/
 func (fw *Firewalld) WriteConfig(destDir string, services map[string]model.FirewalldService) error {
+	contents := make(map[string]string)
+	for shortName, svc := range services {
+		def, _ := fw.definitionOf(shortName)
+		contents[shortName+".xml"] = fw.serviceXML(svc, def)
+	}
+	return writeOwnedFiles(destDir, "*.xml", contents, fw.Force)
+}
+
+/*
+WritePolicies serialises firewalld policy definition into XML files and place them under the directory.
+Previously generated XML files that no longer correspond to a policy are removed. Hand-modified files are treated the
+same way as WriteConfig does.
+*/
+func (fw *Firewalld) WritePolicies(destDir string, policies map[string]model.FirewalldPolicy) error {
+	contents := make(map[string]string)
+	for name, policy := range policies {
+		contents[name+".xml"] = fw.policyXML(policy)
+	}
+	return writeOwnedFiles(destDir, "*.xml", contents, fw.Force)
+}
+
+/*
+writeOwnedFiles writes file name vs content into the directory, and then removes files matching the pattern that were
+generated earlier but are no longer among the file names. Unless force is set, nothing is written or removed if a file
+of the same name exists that was not generated by hana-firewall, or if any of the generated files to be overwritten or
+removed was modified by hand. Files that were not generated by hana-firewall are never removed. The files are readable
+by everyone, just like the files that come with firewalld.
+*/
+func writeOwnedFiles(destDir, pattern string, contents map[string]string, force bool) error {
 	if info, err := os.Stat(destDir); err != nil || !info.IsDir() {
-		return fmt.Errorf("Firewalld.WriteConfig: destination directory \"%s\" does not exist or it is not a directory", destDir)
+		return &WriteError{Path: destDir, Err: fmt.Errorf("destination directory does not exist or it is not a directory")}
 	}
-	for shortName, svc := range services {
-		filePath := path.Join(destDir, shortName+".xml")
-		if err := ioutil.WriteFile(filePath, []byte(svc.ToXML()), 0600); err != nil {
-			return err
+	stale, err := FindStaleFiles(destDir, pattern, contents)
+	if err != nil {
+		return &WriteError{Path: destDir, Err: err}
+	}
+	if !force {
+		foreign, err := FindForeignFiles(destDir, contents)
+		if err != nil {
+			return &WriteError{Path: destDir, Err: err}
+		}
+		if len(foreign) > 0 {
+			return &WriteError{Path: foreign[0], Err: fmt.Errorf("refuse to overwrite a file that was not generated by hana-firewall")}
+		}
+		modified, err := FindModifiedFiles(destDir, contents, stale)
+		if err != nil {
+			return &WriteError{Path: destDir, Err: err}
+		}
+		if len(modified) > 0 {
+			return &ModifiedError{Paths: modified}
+		}
+	}
+	for fileName, content := range contents {
+		filePath := path.Join(destDir, fileName)
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return &WriteError{Path: filePath, Err: err}
+		}
+	}
+	for _, filePath := range stale {
+		if err := os.Remove(filePath); err != nil {
+			return &WriteError{Path: filePath, Err: err}
 		}
 	}
 	return nil
 }
+
+/*
+FindStaleFiles returns paths of files generated by hana-firewall in the directory whose names match the pattern (e.g.
+"*.xml"), that are not among the file names.
+*/
+func FindStaleFiles(dir, pattern string, contents map[string]string) (ret []string, err error) {
+	ret = make([]string, 0, 0)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if _, wanted := contents[entry.Name()]; wanted || !entry.Mode().IsRegular() {
+			continue
+		}
+		if matched, _ := path.Match(pattern, entry.Name()); !matched {
+			continue
+		}
+		filePath := path.Join(dir, entry.Name())
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if model.IsGeneratedFile(content) || model.IsLegacyGeneratedFile(entry.Name(), content) {
+			ret = append(ret, filePath)
+		}
+	}
+	return
+}
+
+/*
+FindForeignFiles returns paths of the existing files among the file names that were not generated by hana-firewall.
+A service file written by earlier versions that did not place the ownership marker is not foreign, as long as it
+allows the same ports as the content about to be written in its place.
+*/
+func FindForeignFiles(dir string, contents map[string]string) (ret []string, err error) {
+	ret = make([]string, 0, 0)
+	for fileName := range contents {
+		filePath := path.Join(dir, fileName)
+		content, err := ioutil.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !model.IsGeneratedFile(content) && !isLegacyGeneratedService(fileName, content, []byte(contents[fileName])) {
+			ret = append(ret, filePath)
+		}
+	}
+	sort.Strings(ret)
+	return
+}
+
+// isLegacyGeneratedService returns true if the existing file is a legacy generated service of the same ports as wanted.
+func isLegacyGeneratedService(fileName string, existing, wanted []byte) bool {
+	if !model.IsLegacyGeneratedFile(fileName, existing) {
+		return false
+	}
+	existingSvc, err := model.ParseFirewalldServiceXML(existing)
+	if err != nil {
+		return false
+	}
+	wantedSvc, err := model.ParseFirewalldServiceXML(wanted)
+	if err != nil {
+		return false
+	}
+	existingPorts := make(map[model.FirewalldPort]bool)
+	for _, port := range existingSvc.Ports {
+		existingPorts[port] = true
+	}
+	wantedPorts := make(map[model.FirewalldPort]bool)
+	for _, port := range wantedSvc.Ports {
+		wantedPorts[port] = true
+	}
+	return reflect.DeepEqual(existingPorts, wantedPorts)
+}
+
+// FindModifiedFiles returns paths of the generated files among the file names and stale paths that were modified by hand.
+func FindModifiedFiles(dir string, contents map[string]string, stale []string) (ret []string, err error) {
+	ret = make([]string, 0, 0)
+	candidates := make([]string, 0, len(contents)+len(stale))
+	for fileName := range contents {
+		candidates = append(candidates, path.Join(dir, fileName))
+	}
+	candidates = append(candidates, stale...)
+	sort.Strings(candidates)
+	for _, filePath := range candidates {
+		content, err := ioutil.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if model.IsModifiedFile(content) {
+			ret = append(ret, filePath)
+		}
+	}
+	return
+}
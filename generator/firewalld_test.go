@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -89,3 +90,276 @@ func TestFirewalld(t *testing.T) {
 		t.Fatalf("%+v", dbService)
 	}
 }
+
+func TestFirewalld_Policies(t *testing.T) {
+	fw := Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{
+			InstanceNumbers:    []string{"00"},
+			PolicyIngressZones: []string{"podman"},
+			PolicyEgressZones:  []string{"HOST"},
+		},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "Database Client", TCP: []string{"3__INST_NUM__13"}},
+			{FileBaseName: "Cockpit", TCP: []string{"51021"}},
+		},
+	}
+	services, err := fw.GenerateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := fw.GeneratePolicies(services)
+	policy, exists := policies[PolicyName]
+	if len(policies) != 1 || !exists {
+		t.Fatalf("%+v", policies)
+	}
+	if !reflect.DeepEqual(policy.Services, model.MakeFirewalldNameRefs([]string{"cockpit", "database-client"})) {
+		t.Fatalf("%+v", policy)
+	}
+	if !reflect.DeepEqual(policy.IngressZones, model.MakeFirewalldNameRefs([]string{"podman"})) ||
+		!reflect.DeepEqual(policy.EgressZones, model.MakeFirewalldNameRefs([]string{"HOST"})) {
+		t.Fatalf("%+v", policy)
+	}
+
+	// Policy is not generated without both ingress and egress zones
+	fw.HANAGlobal.PolicyEgressZones = nil
+	if policies := fw.GeneratePolicies(services); len(policies) != 0 {
+		t.Fatalf("%+v", policies)
+	}
+}
+
+func TestFirewalld_Prune(t *testing.T) {
+	dest, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_Prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	// A file not generated by hana-firewall must survive
+	if err := ioutil.WriteFile(path.Join(dest, "custom.xml"), []byte("<service/>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fw := Firewalld{}
+	if err := fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a"}, "b": {ShortName: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteConfig(dest, map[string]model.FirewalldService{"b": {ShortName: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	for fileName, shouldExist := range map[string]bool{"a.xml": false, "b.xml": true, "custom.xml": true} {
+		if _, err := os.Stat(path.Join(dest, fileName)); (err == nil) != shouldExist {
+			t.Fatal(fileName, err)
+		}
+	}
+
+	// Pruning applies to policies in the same way
+	policies := map[string]model.FirewalldPolicy{PolicyName: {ShortName: PolicyName}}
+	if err := fw.WritePolicies(dest, policies); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WritePolicies(dest, map[string]model.FirewalldPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dest, PolicyName+".xml")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestFirewalld_Modified(t *testing.T) {
+	dest, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_Modified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	fw := Firewalld{
+		HANAGlobal:   model.HANAGlobalParameters{InstanceNumbers: []string{"00"}},
+		HANAServices: []model.HANAServiceDefinition{{FileBaseName: "a", FilePath: "/etc/hana-firewall/a"}},
+	}
+	services := map[string]model.FirewalldService{"a": {ShortName: "a"}, "b": {ShortName: "b"}}
+	if err := fw.WriteConfig(dest, services); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path.Join(dest, "a.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prov, _, _ := model.ParseProvenance(content); !reflect.DeepEqual(prov.Sources, []string{"/etc/hana-firewall/a"}) ||
+		!reflect.DeepEqual(prov.InstanceNumbers, []string{"00"}) || prov.Version != Version {
+		t.Fatalf("%+v", prov)
+	}
+	// Modify both files by hand, then neither overwriting nor pruning may happen
+	for _, fileName := range []string{"a.xml", "b.xml"} {
+		filePath := path.Join(dest, fileName)
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, append(content, ' '), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a"}})
+	if modifiedErr, ok := err.(*ModifiedError); !ok || !reflect.DeepEqual(modifiedErr.Paths, []string{path.Join(dest, "a.xml"), path.Join(dest, "b.xml")}) {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dest, "b.xml")); err != nil {
+		t.Fatal(err)
+	}
+	// Force overwrites and prunes them
+	fw.Force = true
+	if err := fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dest, "b.xml")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dest, "a.xml")); err != nil || model.IsModifiedFile(content) {
+		t.Fatal(err)
+	}
+
+	// A file of the same name that was not generated is left alone, unless forced
+	fw.Force = false
+	handWritten := []byte("<service><short>c</short></service>")
+	if err := ioutil.WriteFile(path.Join(dest, "c.xml"), handWritten, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a"}, "c": {ShortName: "c"}})
+	if writeErr, ok := err.(*WriteError); !ok || writeErr.Path != path.Join(dest, "c.xml") {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dest, "c.xml")); err != nil || !reflect.DeepEqual(content, handWritten) {
+		t.Fatal(string(content), err)
+	}
+	fw.Force = true
+	if err := fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a"}, "c": {ShortName: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dest, "c.xml")); err != nil || !model.IsGeneratedFile(content) {
+		t.Fatal(string(content), err)
+	}
+}
+
+func TestFirewalld_Legacy(t *testing.T) {
+	dest, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_Legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	// Files written by earlier versions do not carry the ownership marker
+	legacyXML := func(shortName string, port int) []byte {
+		return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<service>
+    <short>` + shortName + `</short>
+    <description>HANA ` + shortName + `</description>
+    <port port="` + strconv.Itoa(port) + `" protocol="tcp"></port>
+    <port port="` + strconv.Itoa(port+1) + `" protocol="tcp"></port>
+</service>`)
+	}
+	for fileName, content := range map[string][]byte{
+		"a.xml":     legacyXML("a", 30013),
+		"b.xml":     legacyXML("b", 30015),
+		"c.xml":     legacyXML("c", 30017),
+		"other.xml": legacyXML("different", 30019),
+	} {
+		if err := ioutil.WriteFile(path.Join(dest, fileName), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for fileName, expected := range map[string]bool{"a.xml": true, "other.xml": false} {
+		content, err := ioutil.ReadFile(path.Join(dest, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if model.IsLegacyGeneratedFile(fileName, content) != expected {
+			t.Fatal(fileName)
+		}
+	}
+	fw := Firewalld{}
+	ports := func(port int) []model.FirewalldPort {
+		return []model.FirewalldPort{{Port: port, Protocol: "tcp"}, {Port: port + 1, Protocol: "tcp"}}
+	}
+	// A legacy file of different ports is not overwritten
+	err = fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a", Ports: ports(30013)}, "b": {ShortName: "b", Ports: ports(30040)}})
+	if writeErr, ok := err.(*WriteError); !ok || writeErr.Path != path.Join(dest, "b.xml") {
+		t.Fatal(err)
+	}
+	// Legacy files of the same ports are overwritten, legacy files of services no longer generated are pruned
+	if err := fw.WriteConfig(dest, map[string]model.FirewalldService{"a": {ShortName: "a", Ports: ports(30013)}, "b": {ShortName: "b", Ports: ports(30015)}}); err != nil {
+		t.Fatal(err)
+	}
+	for fileName, shouldExist := range map[string]bool{"a.xml": true, "b.xml": true, "c.xml": false, "other.xml": true} {
+		content, err := ioutil.ReadFile(path.Join(dest, fileName))
+		if (err == nil) != shouldExist {
+			t.Fatal(fileName, err)
+		}
+		if shouldExist && model.IsGeneratedFile(content) != (fileName != "other.xml") {
+			t.Fatal(fileName, string(content))
+		}
+	}
+	if info, err := os.Stat(path.Join(dest, "a.xml")); err != nil || info.Mode().Perm() != 0644 {
+		t.Fatal(info, err)
+	}
+}
+
+func TestFirewalld_ApplicableServices(t *testing.T) {
+	fw := Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00"}, SIDs: []string{"PRD"}},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "Enabled", TCP: []string{"1"}},
+			{FileBaseName: "Disabled", TCP: []string{"2"}, Disabled: true},
+			{FileBaseName: "Other SID", TCP: []string{"3"}, OnlyForSIDs: []string{"QAS"}},
+		},
+	}
+	services, err := fw.GenerateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := services["enabled"]; len(services) != 1 || !exists {
+		t.Fatalf("%+v", services)
+	}
+	if _, skipped := fw.ApplicableServices(); len(skipped) != 2 || skipped["Disabled"] == "" || skipped["Other SID"] == "" {
+		t.Fatalf("%+v", skipped)
+	}
+}
+
+func TestFirewalld_Replication(t *testing.T) {
+	fw := Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: "WDF", ReplicationTier: 2,
+			ReplicationPeers: []string{"ROT:1:00", "SIN:3:00"}},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "Client", FilePath: "/etc/hana-firewall/Client", TCP: []string{"3__INST_NUM__15"}},
+			{FileBaseName: "Replication", FilePath: "/usr/share/hana-firewall/Replication", TCP: []string{"3__INST_NUM+1__01"}, Replication: true},
+		},
+	}
+	services, err := fw.GenerateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 3 || services["replication-rot"].Ports[0].Port != 30101 || services["replication-sin"].Ports[0].Port != 30101 {
+		t.Fatalf("%+v", services)
+	}
+	// The services of replication peers come from the replication definition
+	dest, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_Replication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	if err := fw.WriteConfig(dest, services); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path.Join(dest, "replication-sin.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prov, _, found := model.ParseProvenance(content); !found || !reflect.DeepEqual(prov.Sources, []string{"/usr/share/hana-firewall/Replication"}) {
+		t.Fatalf("%+v", prov)
+	}
+	// Zones refer to the services generated from a definition by their generated names
+	if names := fw.GeneratedNamesOf(services, "replication"); !reflect.DeepEqual(names, []string{"replication-rot", "replication-sin"}) {
+		t.Fatal(names)
+	}
+	if names := fw.GeneratedNamesOf(services, "client"); !reflect.DeepEqual(names, []string{"client"}) {
+		t.Fatal(names)
+	}
+	if names := fw.GeneratedNamesOf(services, "ssh"); len(names) != 0 {
+		t.Fatal(names)
+	}
+}
@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// generatedHeader is the comment at the top of every generated YAML document, Terraform file, and state file.
+func generatedHeader(services []exportService) string {
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		names = append(names, svc.ShortName)
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("# Generated by hana-firewall %s\n", Version)
+	}
+	return fmt.Sprintf("# Generated by hana-firewall %s from firewalld services: %s\n", Version, strings.Join(names, ", "))
+}
+
+// writeYAMLMetadata writes the metadata of a Kubernetes object at the top level of the document.
+func writeYAMLMetadata(out *bytes.Buffer, name string, opts ExportOptions) {
+	out.WriteString("metadata:\n")
+	fmt.Fprintf(out, "  name: %s\n", name)
+	if opts.Namespace != "" {
+		fmt.Fprintf(out, "  namespace: %s\n", yamlString(opts.Namespace))
+	}
+	out.WriteString("  labels:\n")
+	out.WriteString("    app.kubernetes.io/managed-by: hana-firewall\n")
+}
+
+// writeYAMLSelector writes a label selector under the key, an empty selector selects all pods.
+func writeYAMLSelector(out *bytes.Buffer, key string, labels map[string]string) {
+	if len(labels) == 0 {
+		fmt.Fprintf(out, "  %s: {}\n", key)
+		return
+	}
+	fmt.Fprintf(out, "  %s:\n", key)
+	out.WriteString("    matchLabels:\n")
+	keys := make([]string, 0, len(labels))
+	for labelKey := range labels {
+		keys = append(keys, labelKey)
+	}
+	sort.Strings(keys)
+	for _, labelKey := range keys {
+		fmt.Fprintf(out, "      %s: %s\n", yamlString(labelKey), yamlString(labels[labelKey]))
+	}
+}
+
+/*
+renderKubernetes renders a NetworkPolicy that allows the selected pods to reach the HANA hosts on the ports of the
+services, with one egress rule per service. Port ranges use endPort, which requires Kubernetes 1.25 or newer.
+*/
+func renderKubernetes(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(services))
+	out.WriteString("apiVersion: networking.k8s.io/v1\n")
+	out.WriteString("kind: NetworkPolicy\n")
+	writeYAMLMetadata(&out, name, *opts)
+	out.WriteString("spec:\n")
+	writeYAMLSelector(&out, "podSelector", opts.PodSelector)
+	out.WriteString("  policyTypes:\n")
+	out.WriteString("    - Egress\n")
+	out.WriteString("  egress:\n")
+	for _, svc := range services {
+		fmt.Fprintf(&out, "    # %s\n", svc.ShortName)
+		out.WriteString("    - to:\n")
+		for _, cidr := range svc.CIDRs {
+			out.WriteString("        - ipBlock:\n")
+			fmt.Fprintf(&out, "            cidr: %s\n", cidr)
+		}
+		out.WriteString("      ports:\n")
+		for _, ports := range svc.Ports {
+			for _, portRange := range ports.Ranges {
+				fmt.Fprintf(&out, "        - protocol: %s\n", strings.ToUpper(ports.Protocol))
+				fmt.Fprintf(&out, "          port: %d\n", portRange.First)
+				if portRange.Last != portRange.First {
+					fmt.Fprintf(&out, "          endPort: %d\n", portRange.Last)
+				}
+			}
+		}
+	}
+	return out.String(), nil, nil
+}
+
+/*
+renderCilium renders a CiliumNetworkPolicy that allows the selected endpoints to reach the HANA hosts on the ports of
+the services, with one egress rule per service. Port ranges use endPort, which requires Cilium 1.12 or newer.
+*/
+func renderCilium(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(services))
+	out.WriteString("apiVersion: cilium.io/v2\n")
+	out.WriteString("kind: CiliumNetworkPolicy\n")
+	writeYAMLMetadata(&out, name, *opts)
+	out.WriteString("spec:\n")
+	writeYAMLSelector(&out, "endpointSelector", opts.PodSelector)
+	out.WriteString("  egress:\n")
+	for _, svc := range services {
+		fmt.Fprintf(&out, "    # %s\n", svc.ShortName)
+		out.WriteString("    - toCIDR:\n")
+		for _, cidr := range svc.CIDRs {
+			fmt.Fprintf(&out, "        - %s\n", cidr)
+		}
+		out.WriteString("      toPorts:\n")
+		out.WriteString("        - ports:\n")
+		for _, ports := range svc.Ports {
+			for _, portRange := range ports.Ranges {
+				fmt.Fprintf(&out, "            - port: \"%d\"\n", portRange.First)
+				if portRange.Last != portRange.First {
+					fmt.Fprintf(&out, "              endPort: %d\n", portRange.Last)
+				}
+				fmt.Fprintf(&out, "              protocol: %s\n", strings.ToUpper(ports.Protocol))
+			}
+		}
+	}
+	return out.String(), nil, nil
+}
@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// FirewalldVendorDir holds the default configuration that comes with firewalld, /etc/firewalld overrides it.
+const FirewalldVendorDir = "/usr/lib/firewalld"
+
+// serviceReference returns a regular expression that matches a reference to the service in zone or policy XML.
+func serviceReference(shortName string) *regexp.Regexp {
+	return regexp.MustCompile(`\n?[ \t]*<service\s+name="` + regexp.QuoteMeta(shortName) + `"\s*(?:/>|>\s*</service>)`)
+}
+
+/*
+ReplaceServiceReferences looks for references to a service among zone and policy XML files under firewalld
+configuration directory (e.g. /etc/firewalld), and replaces them by references to the new service name. If the new
+name is empty, the references are removed. The paths of modified files are returned.
+*/
+func ReplaceServiceReferences(firewalldDir, oldShortName, newShortName string) (modified []string, err error) {
+	modified = make([]string, 0, 4)
+	ref := serviceReference(oldShortName)
+	for _, subDir := range []string{"zones", "policies"} {
+		entries, err := ioutil.ReadDir(path.Join(firewalldDir, subDir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return modified, err
+		}
+		for _, entry := range entries {
+			if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".xml") {
+				continue
+			}
+			filePath := path.Join(firewalldDir, subDir, entry.Name())
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return modified, err
+			}
+			newContent := ref.ReplaceAllFunc(content, func(match []byte) []byte {
+				if newShortName == "" {
+					return []byte{}
+				}
+				return []byte(strings.Replace(string(match), `"`+oldShortName+`"`, `"`+newShortName+`"`, 1))
+			})
+			if string(newContent) == string(content) {
+				continue
+			}
+			if err := ioutil.WriteFile(filePath, newContent, entry.Mode().Perm()); err != nil {
+				return modified, &WriteError{Path: filePath, Err: err}
+			}
+			modified = append(modified, filePath)
+		}
+	}
+	return
+}
+
+/*
+RenameService updates references among zones and policies to use the new service name. If the XML file of the old
+service name was generated previously, it is removed and the XML file of the renamed service definition is generated.
+Paths of the files that were modified are returned.
+*/
+func (fw *Firewalld) RenameService(firewalldDir, oldShortName string, def model.HANAServiceDefinition) (modified []string, err error) {
+	shortName, svc, err := fw.HANAGlobal.MakeFirewalldService(&def)
+	if err != nil {
+		return
+	}
+	if modified, err = fw.DeleteService(firewalldDir, oldShortName, shortName); err != nil {
+		return
+	}
+	if len(modified) == 0 || modified[0] != path.Join(firewalldDir, "services", oldShortName+".xml") {
+		// The old service was never generated
+		return
+	}
+	filePath := path.Join(firewalldDir, "services", shortName+".xml")
+	if content, readErr := ioutil.ReadFile(filePath); readErr == nil && !model.IsGeneratedFile(content) {
+		return modified, &WriteError{Path: filePath, Err: fmt.Errorf("refuse to overwrite a file that was not generated by hana-firewall")}
+	}
+	if err = ioutil.WriteFile(filePath, []byte(fw.serviceXML(svc, def)), 0644); err != nil {
+		err = &WriteError{Path: filePath, Err: err}
+		return
+	}
+	modified = append(modified, filePath)
+	return
+}
+
+/*
+DeleteService removes the previously generated XML file of the service. References among zones and policies are
+replaced by the service name given in "replacement", or removed if the replacement is empty. Paths of the files that
+were modified are returned.
+*/
+func (fw *Firewalld) DeleteService(firewalldDir, shortName, replacement string) (modified []string, err error) {
+	modified = make([]string, 0, 4)
+	filePath := path.Join(firewalldDir, "services", shortName+".xml")
+	if content, readErr := ioutil.ReadFile(filePath); readErr == nil && model.IsGeneratedFile(content) {
+		if err = os.Remove(filePath); err != nil {
+			err = &WriteError{Path: filePath, Err: err}
+			return
+		}
+		modified = append(modified, filePath)
+	}
+	if shortName == replacement {
+		return
+	}
+	refModified, err := ReplaceServiceReferences(firewalldDir, shortName, replacement)
+	modified = append(modified, refModified...)
+	return
+}
+
+/*
+ServiceZones looks for zone XML files under firewalld configuration directories (e.g. /usr/lib/firewalld and
+/etc/firewalld) that allow any of the services, and returns zone name vs the short names of those services in the order
+the zone allows them. A zone file in a later directory replaces the zone file of the same name in earlier directories,
+just like /etc/firewalld overrides the defaults that come with firewalld.
+*/
+func ServiceZones(firewalldDirs []string, services map[string]model.FirewalldService) (ret map[string][]string, err error) {
+	zoneFiles := make(map[string]string)
+	for _, firewalldDir := range firewalldDirs {
+		zonesDir := path.Join(firewalldDir, "zones")
+		entries, err := ioutil.ReadDir(zonesDir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() && strings.HasSuffix(entry.Name(), ".xml") {
+				zoneFiles[strings.TrimSuffix(entry.Name(), ".xml")] = path.Join(zonesDir, entry.Name())
+			}
+		}
+	}
+	ret = make(map[string][]string)
+	for zoneName, filePath := range zoneFiles {
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		zone, err := model.ParseFirewalldZoneXML(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zone \"%s\" - %v", filePath, err)
+		}
+		for _, ref := range zone.Services {
+			if _, generated := services[ref.Name]; generated {
+				ret[zoneName] = append(ret[zoneName], ref.Name)
+			}
+		}
+	}
+	return
+}
+
+// StaleReference is a reference among zones or policies to a service that is generated under other names instead.
+type StaleReference struct {
+	Path         string   // Path of the zone or policy XML file.
+	ShortName    string   // ShortName is the referenced service, which is no longer generated.
+	Replacements []string // Replacements are the generated services that carry the ports of its definition instead.
+}
+
+/*
+FindStaleReferences looks for references among zone and policy XML files under firewalld configuration directory
+(e.g. /etc/firewalld) to services that are no longer generated because their definition yields services of other names,
+such as the services per instance once instance destinations are configured, or the services per system replication
+peer. The services are the output of GenerateConfig.
+*/
+func (fw *Firewalld) FindStaleReferences(firewalldDir string, services map[string]model.FirewalldService) (ret []StaleReference, err error) {
+	ret = make([]StaleReference, 0, 0)
+	for _, subDir := range []string{"zones", "policies"} {
+		entries, err := ioutil.ReadDir(path.Join(firewalldDir, subDir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return ret, err
+		}
+		for _, entry := range entries {
+			if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".xml") {
+				continue
+			}
+			filePath := path.Join(firewalldDir, subDir, entry.Name())
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return ret, err
+			}
+			for _, def := range fw.HANAServices {
+				shortName := def.GetShortName()
+				if _, generated := services[shortName]; generated || !serviceReference(shortName).Match(content) {
+					continue
+				}
+				if replacements := fw.GeneratedNamesOf(services, shortName); len(replacements) > 0 {
+					ret = append(ret, StaleReference{Path: filePath, ShortName: shortName, Replacements: replacements})
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,207 @@
+package generator
+
+import (
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFirewalld_RenameDeleteService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_RenameDeleteService")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, subDir := range []string{"services", "zones", "policies"} {
+		if err := os.MkdirAll(path.Join(dir, subDir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zone := `<?xml version="1.0" encoding="utf-8"?>
+<zone>
+  <short>Public</short>
+  <service name="ssh"/>
+  <service name="old-name"/>
+  <service name="old-name-2"/>
+</zone>
+`
+	zonePath := path.Join(dir, "zones", "public.xml")
+	if err := ioutil.WriteFile(zonePath, []byte(zone), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fw := Firewalld{HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00"}}}
+	old := model.HANAServiceDefinition{FileBaseName: "Old Name", TCP: []string{"3__INST_NUM__13"}}
+	fw.HANAServices = []model.HANAServiceDefinition{old}
+	services, err := fw.GenerateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteConfig(path.Join(dir, "services"), services); err != nil {
+		t.Fatal(err)
+	}
+	policies := map[string]model.FirewalldPolicy{PolicyName: {Services: model.MakeFirewalldNameRefs([]string{"old-name"})}}
+	if err := fw.WritePolicies(path.Join(dir, "policies"), policies); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename
+	renamed := old
+	renamed.FileBaseName = "New Name"
+	modified, err := fw.RenameService(dir, "old-name", renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := []string{
+		path.Join(dir, "services", "old-name.xml"),
+		path.Join(dir, "zones", "public.xml"),
+		path.Join(dir, "policies", PolicyName+".xml"),
+		path.Join(dir, "services", "new-name.xml"),
+	}
+	if !reflect.DeepEqual(modified, match) {
+		t.Fatalf("\n%+v\n%+v\n", modified, match)
+	}
+	content, err := ioutil.ReadFile(zonePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != `<?xml version="1.0" encoding="utf-8"?>
+<zone>
+  <short>Public</short>
+  <service name="ssh"/>
+  <service name="new-name"/>
+  <service name="old-name-2"/>
+</zone>
+` {
+		t.Fatal(string(content))
+	}
+
+	// Delete
+	if modified, err = fw.DeleteService(dir, "new-name", ""); err != nil || len(modified) != 3 {
+		t.Fatal(modified, err)
+	}
+	if content, err = ioutil.ReadFile(zonePath); err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != `<?xml version="1.0" encoding="utf-8"?>
+<zone>
+  <short>Public</short>
+  <service name="ssh"/>
+  <service name="old-name-2"/>
+</zone>
+` {
+		t.Fatal(string(content))
+	}
+	if _, err := os.Stat(path.Join(dir, "services", "new-name.xml")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceZones(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestServiceZones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	services := map[string]model.FirewalldService{"hana-database-client": {}, "sap-special-support": {}}
+	vendorDir, adminDir := path.Join(dir, "usr"), path.Join(dir, "etc")
+	dirs := []string{vendorDir, adminDir}
+	// There are no zones yet
+	if zones, err := ServiceZones(dirs, services); err != nil || len(zones) != 0 {
+		t.Fatal(zones, err)
+	}
+	for _, firewalldDir := range dirs {
+		if err := os.MkdirAll(path.Join(firewalldDir, "zones"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for filePath, content := range map[string]string{
+		// Zones of /etc/firewalld override the default zones of the same name
+		path.Join(vendorDir, "zones", "public.xml"):    `<zone><service name="ssh"/></zone>`,
+		path.Join(vendorDir, "zones", "trusted.xml"):   `<zone><service name="sap-special-support"/></zone>`,
+		path.Join(adminDir, "zones", "public.xml"):     `<zone><service name="ssh"/><service name="sap-special-support"/><service name="hana-database-client"/></zone>`,
+		path.Join(adminDir, "zones", "internal.xml"):   `<zone><service name="hana-database-client"/></zone>`,
+		path.Join(adminDir, "zones", "dmz.xml"):        `<zone><service name="ssh"/></zone>`,
+		path.Join(adminDir, "zones", "public.xml.old"): `<zone><service name="hana-database-client"/></zone>`,
+	} {
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zones, err := ServiceZones(dirs, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(zones, map[string][]string{
+		"internal": {"hana-database-client"},
+		"public":   {"sap-special-support", "hana-database-client"},
+		"trusted":  {"sap-special-support"},
+	}) {
+		t.Fatal(zones)
+	}
+	if err := ioutil.WriteFile(path.Join(adminDir, "zones", "broken.xml"), []byte(`<zone><service`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ServiceZones(dirs, services); err == nil {
+		t.Fatal("did not error")
+	}
+}
+
+func TestFirewalld_FindStaleReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_FindStaleReferences")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fw := Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00", "10"}, InstanceDestinations: []string{"00=10.0.0.5", "10=10.0.0.6"}},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "HANA database client", TCP: []string{"3__INST_NUM__13"}},
+			{FileBaseName: "SAP host agent", TCP: []string{"1128"}},
+		},
+	}
+	services, err := fw.GenerateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// There are no zones yet
+	if stale, err := fw.FindStaleReferences(dir, services); err != nil || len(stale) != 0 {
+		t.Fatal(stale, err)
+	}
+	for _, subDir := range []string{"zones", "policies"} {
+		if err := os.MkdirAll(path.Join(dir, subDir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for filePath, content := range map[string]string{
+		path.Join(dir, "zones", "public.xml"):     `<zone><service name="hana-database-client"/><service name="sap-host-agent"/></zone>`,
+		path.Join(dir, "zones", "internal.xml"):   `<zone><service name="hana-database-client-00"/></zone>`,
+		path.Join(dir, "policies", "hana.xml"):    `<policy><service name="hana-database-client"></service></policy>`,
+		path.Join(dir, "zones", "public.xml.old"): `<zone><service name="hana-database-client"/></zone>`,
+	} {
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, err := fw.FindStaleReferences(dir, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacements := []string{"hana-database-client-00", "hana-database-client-10"}
+	if !reflect.DeepEqual(stale, []StaleReference{
+		{Path: path.Join(dir, "zones", "public.xml"), ShortName: "hana-database-client", Replacements: replacements},
+		{Path: path.Join(dir, "policies", "hana.xml"), ShortName: "hana-database-client", Replacements: replacements},
+	}) {
+		t.Fatalf("%+v", stale)
+	}
+	// The service of the usual name remains for instances without destination, its references are fine
+	fw.HANAGlobal.InstanceDestinations = []string{"00=10.0.0.5"}
+	if services, err = fw.GenerateConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := fw.FindStaleReferences(dir, services); err != nil || len(stale) != 0 {
+		t.Fatal(stale, err)
+	}
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	FirewalldDBusName   = "org.fedoraproject.FirewallD1"  // FirewalldDBusName is the bus name and interface of firewalld.
+	FirewalldDBusObject = "/org/fedoraproject/FirewallD1" // FirewalldDBusObject is the object path of firewalld.
+)
+
+/*
+Fingerprint returns a checksum of the firewalld services and policies. Because they are derived from the global
+configuration, service definitions, and discovered HANA systems, the fingerprint changes whenever any of the inputs
+changes in a way that affects the generated files.
+*/
+func Fingerprint(services map[string]model.FirewalldService, policies map[string]model.FirewalldPolicy) string {
+	var out bytes.Buffer
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc := services[name]
+		out.WriteString("service " + name + "\n" + svc.ToXML() + "\n")
+	}
+	names = make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		policy := policies[name]
+		out.WriteString("policy " + name + "\n" + policy.ToXML() + "\n")
+	}
+	return model.Checksum(out.Bytes())
+}
+
+/*
+OwnedFilesChecksum returns a checksum of the names and content of the XML files generated by hana-firewall in the
+directories. Directories that do not exist are treated as empty, so are files that cannot be read. The checksum changes
+if a generated file is removed, modified, or replaced by hand.
+*/
+func OwnedFilesChecksum(dirs ...string) string {
+	var out bytes.Buffer
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if matched, _ := path.Match("*.xml", entry.Name()); !matched || !entry.Mode().IsRegular() {
+				continue
+			}
+			filePath := path.Join(dir, entry.Name())
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil || !model.IsGeneratedFile(content) {
+				continue
+			}
+			out.WriteString("file " + filePath + " " + model.Checksum(content) + "\n")
+		}
+	}
+	return model.Checksum(out.Bytes())
+}
+
+/*
+ReloadFirewalld asks the running firewalld to reload its permanent configuration via D-Bus, which makes the generated
+services and policies available. Just like restarting firewalld, reloading loses transient configuration.
+*/
+func ReloadFirewalld() error {
+	out, err := exec.Command("dbus-send", "--system", "--print-reply", "--dest="+FirewalldDBusName,
+		FirewalldDBusObject, FirewalldDBusName+".reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to reload firewalld via D-Bus - %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package generator
+
+import (
+	"github.com/SUSE/HANA-Firewall/model"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	services := map[string]model.FirewalldService{
+		"a": {ShortName: "a", Ports: []model.FirewalldPort{{Port: 1, Protocol: "tcp"}}},
+		"b": {ShortName: "b", Ports: []model.FirewalldPort{{Port: 2, Protocol: "udp"}}},
+	}
+	policies := map[string]model.FirewalldPolicy{PolicyName: {ShortName: PolicyName}}
+	fingerprint := Fingerprint(services, policies)
+	for i := 0; i < 10; i++ {
+		if Fingerprint(services, policies) != fingerprint {
+			t.Fatal("fingerprint should be stable")
+		}
+	}
+	if Fingerprint(services, nil) == fingerprint {
+		t.Fatal("fingerprint should change without policy")
+	}
+	services["b"] = model.FirewalldService{ShortName: "b", Ports: []model.FirewalldPort{{Port: 3, Protocol: "udp"}}}
+	if Fingerprint(services, policies) == fingerprint {
+		t.Fatal("fingerprint should change along with port")
+	}
+}
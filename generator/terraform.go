@@ -0,0 +1,143 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// terraformVariablesFile is the file of the terraform format that declares the input variables of the module.
+const terraformVariablesFile = "variables.tf"
+
+// isCloudProvider returns true if the provider is one of CloudProviders.
+func isCloudProvider(provider string) bool {
+	for _, known := range CloudProviders {
+		if provider == known {
+			return true
+		}
+	}
+	return false
+}
+
+// hclString quotes the text as an HCL string, in which template sequences are escaped.
+func hclString(text string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(strconv.Quote(text))
+}
+
+// hclList returns the texts as a list of HCL strings.
+func hclList(texts []string) string {
+	quoted := make([]string, 0, len(texts))
+	for _, text := range texts {
+		quoted = append(quoted, hclString(text))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// writeHCLAttributes writes the attributes with their equal signs aligned, in the same way as "terraform fmt" does.
+func writeHCLAttributes(out *bytes.Buffer, indent string, attrs [][2]string) {
+	width := 0
+	for _, attr := range attrs {
+		if len(attr[0]) > width {
+			width = len(attr[0])
+		}
+	}
+	for _, attr := range attrs {
+		fmt.Fprintf(out, "%s%-*s = %s\n", indent, width, attr[0], attr[1])
+	}
+}
+
+// terraformVariables returns the declaration of the variables that identify where the rules of the provider go.
+func terraformVariables(provider string) string {
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(nil))
+	variables := map[string][][2]string{
+		"aws":   {{"security_group_id", "ID of the security group attached to the HANA hosts"}},
+		"azure": {{"resource_group_name", "Name of the resource group of the network security group"}, {"network_security_group_name", "Name of the network security group of the HANA hosts"}},
+		"gcp":   {{"network", "Name or self link of the VPC network of the HANA hosts"}},
+	}[provider]
+	for _, variable := range variables {
+		fmt.Fprintf(&out, "\nvariable %s {\n", hclString(variable[0]))
+		writeHCLAttributes(&out, "  ", [][2]string{{"description", hclString(variable[1])}, {"type", "string"}})
+		out.WriteString("}\n")
+	}
+	return out.String()
+}
+
+/*
+renderTerraform renders the rules of the cloud provider of the options as Terraform resources of a module, whose
+variables are declared in terraformVariablesFile. AWS rules become security group ingress rules of one port range and
+CIDR each, Azure rules become network security rules, and GCP rules become VPC firewall rules.
+*/
+func renderTerraform(name string, services []exportService, opts *ExportOptions) (string, []string, error) {
+	rules, warnings, err := cloudRules(opts.Provider, services, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	var out bytes.Buffer
+	out.WriteString(generatedHeader(services))
+	for _, rule := range rules {
+		switch opts.Provider {
+		case "aws":
+			for _, portRange := range rule.Ranges {
+				for i, cidr := range rule.Sources {
+					fmt.Fprintf(&out, "\nresource \"aws_vpc_security_group_ingress_rule\" %s {\n", hclString(fmt.Sprintf("%s-%s-%d", rule.Name, portRange, i+1)))
+					cidrKey := "cidr_ipv4"
+					if _, ipv6 := splitFamilies([]string{cidr}); len(ipv6) > 0 {
+						cidrKey = "cidr_ipv6"
+					}
+					writeHCLAttributes(&out, "  ", [][2]string{
+						{"security_group_id", "var.security_group_id"},
+						{"description", hclString(rule.Description)},
+						{"ip_protocol", hclString(rule.Protocol)},
+						{"from_port", strconv.Itoa(portRange.First)},
+						{"to_port", strconv.Itoa(portRange.Last)},
+						{cidrKey, hclString(cidr)},
+					})
+					out.WriteString("}\n")
+				}
+			}
+		case "azure":
+			fmt.Fprintf(&out, "\nresource \"azurerm_network_security_rule\" %s {\n", hclString(rule.Name))
+			attrs := [][2]string{
+				{"name", hclString(rule.Name)},
+				{"resource_group_name", "var.resource_group_name"},
+				{"network_security_group_name", "var.network_security_group_name"},
+				{"description", hclString(rule.Description)},
+				{"priority", strconv.Itoa(rule.Priority)},
+				{"direction", hclString("Inbound")},
+				{"access", hclString("Allow")},
+				{"protocol", hclString(azureProtocol(rule.Protocol))},
+				{"source_port_range", hclString("*")},
+				{"destination_port_ranges", hclList(rule.PortStrings())},
+				{"source_address_prefixes", hclList(rule.Sources)},
+			}
+			if len(rule.Destinations) == 0 {
+				attrs = append(attrs, [2]string{"destination_address_prefix", hclString("*")})
+			} else {
+				attrs = append(attrs, [2]string{"destination_address_prefixes", hclList(rule.Destinations)})
+			}
+			writeHCLAttributes(&out, "  ", attrs)
+			out.WriteString("}\n")
+		case "gcp":
+			fmt.Fprintf(&out, "\nresource \"google_compute_firewall\" %s {\n", hclString(rule.Name))
+			attrs := [][2]string{
+				{"name", hclString(rule.Name)},
+				{"network", "var.network"},
+				{"description", hclString(rule.Description)},
+				{"direction", hclString("INGRESS")},
+				{"priority", strconv.Itoa(rule.Priority)},
+				{"source_ranges", hclList(rule.Sources)},
+			}
+			if len(rule.Destinations) > 0 {
+				attrs = append(attrs, [2]string{"destination_ranges", hclList(rule.Destinations)})
+			}
+			writeHCLAttributes(&out, "  ", attrs)
+			out.WriteString("\n  allow {\n")
+			writeHCLAttributes(&out, "    ", [][2]string{{"protocol", hclString(rule.Protocol)}, {"ports", hclList(rule.PortStrings())}})
+			out.WriteString("  }\n")
+			out.WriteString("}\n")
+		}
+	}
+	return out.String(), warnings, nil
+}
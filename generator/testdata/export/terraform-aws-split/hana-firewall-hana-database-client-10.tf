@@ -0,0 +1,37 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client-10
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-hana-database-client-10-tcp-31013-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client-10"
+  ip_protocol       = "tcp"
+  from_port         = 31013
+  to_port           = 31013
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-hana-database-client-10-tcp-31013-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client-10"
+  ip_protocol       = "tcp"
+  from_port         = 31013
+  to_port           = 31013
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-hana-database-client-10-tcp-31015-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client-10"
+  ip_protocol       = "tcp"
+  from_port         = 31015
+  to_port           = 31015
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-hana-database-client-10-tcp-31015-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client-10"
+  ip_protocol       = "tcp"
+  from_port         = 31015
+  to_port           = 31015
+  cidr_ipv6         = "fd01::/48"
+}
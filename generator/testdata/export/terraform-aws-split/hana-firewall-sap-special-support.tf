@@ -0,0 +1,37 @@
+# Generated by hana-firewall 2.0 from firewalld services: sap-special-support
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-sap-special-support-tcp-1128-1129-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 1128
+  to_port           = 1129
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-sap-special-support-tcp-1128-1129-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 1128
+  to_port           = 1129
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-sap-special-support-udp-1129-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: sap-special-support"
+  ip_protocol       = "udp"
+  from_port         = 1129
+  to_port           = 1129
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-sap-special-support-udp-1129-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: sap-special-support"
+  ip_protocol       = "udp"
+  from_port         = 1129
+  to_port           = 1129
+  cidr_ipv6         = "fd01::/48"
+}
@@ -0,0 +1,127 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client, hana-database-client-10, sap-special-support
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-1128-1129-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 1128
+  to_port           = 1129
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-1128-1129-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 1128
+  to_port           = 1129
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30013-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30013
+  to_port           = 30013
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30013-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30013
+  to_port           = 30013
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30015-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30015
+  to_port           = 30015
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30015-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30015
+  to_port           = 30015
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30041-30043-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30041
+  to_port           = 30043
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-30041-30043-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 30041
+  to_port           = 30043
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-31013-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 31013
+  to_port           = 31013
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-31013-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 31013
+  to_port           = 31013
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-31015-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 31015
+  to_port           = 31015
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-tcp-31015-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "tcp"
+  from_port         = 31015
+  to_port           = 31015
+  cidr_ipv6         = "fd01::/48"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-udp-1129-1" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "udp"
+  from_port         = 1129
+  to_port           = 1129
+  cidr_ipv4         = "10.1.0.0/16"
+}
+
+resource "aws_vpc_security_group_ingress_rule" "hana-firewall-udp-1129-2" {
+  security_group_id = var.security_group_id
+  description       = "HANA firewall: hana-database-client, hana-database-client-10, sap-special-support"
+  ip_protocol       = "udp"
+  from_port         = 1129
+  to_port           = 1129
+  cidr_ipv6         = "fd01::/48"
+}
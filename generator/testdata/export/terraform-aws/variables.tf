@@ -0,0 +1,6 @@
+# Generated by hana-firewall 2.0
+
+variable "security_group_id" {
+  description = "ID of the security group attached to the HANA hosts"
+  type        = string
+}
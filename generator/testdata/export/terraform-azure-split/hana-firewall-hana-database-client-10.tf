@@ -0,0 +1,31 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client-10
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-10-tcp" {
+  name                         = "hana-firewall-hana-database-client-10-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client-10"
+  priority                     = 202
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["31013", "31015"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["192.168.1.10/32"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-10-tcp-ipv6" {
+  name                         = "hana-firewall-hana-database-client-10-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client-10"
+  priority                     = 203
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["31013", "31015"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::10/128"]
+}
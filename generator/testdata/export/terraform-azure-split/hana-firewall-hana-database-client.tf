@@ -0,0 +1,31 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-tcp" {
+  name                         = "hana-firewall-hana-database-client-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client"
+  priority                     = 200
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["30013", "30015", "30041-30043"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-tcp-ipv6" {
+  name                         = "hana-firewall-hana-database-client-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client"
+  priority                     = 201
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["30013", "30015", "30041-30043"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
@@ -0,0 +1,61 @@
+# Generated by hana-firewall 2.0 from firewalld services: sap-special-support
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-tcp" {
+  name                         = "hana-firewall-sap-special-support-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 204
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1128-1129"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-tcp-ipv6" {
+  name                         = "hana-firewall-sap-special-support-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 205
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1128-1129"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-udp" {
+  name                         = "hana-firewall-sap-special-support-udp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 206
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Udp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1129"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-udp-ipv6" {
+  name                         = "hana-firewall-sap-special-support-udp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 207
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Udp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1129"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
@@ -0,0 +1,11 @@
+# Generated by hana-firewall 2.0
+
+variable "resource_group_name" {
+  description = "Name of the resource group of the network security group"
+  type        = string
+}
+
+variable "network_security_group_name" {
+  description = "Name of the network security group of the HANA hosts"
+  type        = string
+}
@@ -0,0 +1,121 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client, hana-database-client-10, sap-special-support
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-tcp" {
+  name                         = "hana-firewall-hana-database-client-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client"
+  priority                     = 200
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["30013", "30015", "30041-30043"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-tcp-ipv6" {
+  name                         = "hana-firewall-hana-database-client-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client"
+  priority                     = 201
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["30013", "30015", "30041-30043"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-10-tcp" {
+  name                         = "hana-firewall-hana-database-client-10-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client-10"
+  priority                     = 202
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["31013", "31015"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["192.168.1.10/32"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-hana-database-client-10-tcp-ipv6" {
+  name                         = "hana-firewall-hana-database-client-10-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: hana-database-client-10"
+  priority                     = 203
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["31013", "31015"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::10/128"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-tcp" {
+  name                         = "hana-firewall-sap-special-support-tcp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 204
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1128-1129"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-tcp-ipv6" {
+  name                         = "hana-firewall-sap-special-support-tcp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 205
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Tcp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1128-1129"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-udp" {
+  name                         = "hana-firewall-sap-special-support-udp"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 206
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Udp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1129"]
+  source_address_prefixes      = ["10.1.0.0/16"]
+  destination_address_prefixes = ["10.0.0.0/24"]
+}
+
+resource "azurerm_network_security_rule" "hana-firewall-sap-special-support-udp-ipv6" {
+  name                         = "hana-firewall-sap-special-support-udp-ipv6"
+  resource_group_name          = var.resource_group_name
+  network_security_group_name  = var.network_security_group_name
+  description                  = "HANA firewall: sap-special-support"
+  priority                     = 207
+  direction                    = "Inbound"
+  access                       = "Allow"
+  protocol                     = "Udp"
+  source_port_range            = "*"
+  destination_port_ranges      = ["1129"]
+  source_address_prefixes      = ["fd01::/48"]
+  destination_address_prefixes = ["fd00::/64"]
+}
@@ -0,0 +1,31 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client-10
+
+resource "google_compute_firewall" "hana-firewall-hana-database-client-10-tcp" {
+  name               = "hana-firewall-hana-database-client-10-tcp"
+  network            = var.network
+  description        = "HANA firewall: hana-database-client-10"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["10.1.0.0/16"]
+  destination_ranges = ["192.168.1.10/32"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["31013", "31015"]
+  }
+}
+
+resource "google_compute_firewall" "hana-firewall-hana-database-client-10-tcp-ipv6" {
+  name               = "hana-firewall-hana-database-client-10-tcp-ipv6"
+  network            = var.network
+  description        = "HANA firewall: hana-database-client-10"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["fd01::/48"]
+  destination_ranges = ["fd00::10/128"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["31013", "31015"]
+  }
+}
@@ -0,0 +1,31 @@
+# Generated by hana-firewall 2.0 from firewalld services: hana-database-client
+
+resource "google_compute_firewall" "hana-firewall-hana-database-client-tcp" {
+  name               = "hana-firewall-hana-database-client-tcp"
+  network            = var.network
+  description        = "HANA firewall: hana-database-client"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["10.1.0.0/16"]
+  destination_ranges = ["10.0.0.0/24"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["30013", "30015", "30041-30043"]
+  }
+}
+
+resource "google_compute_firewall" "hana-firewall-hana-database-client-tcp-ipv6" {
+  name               = "hana-firewall-hana-database-client-tcp-ipv6"
+  network            = var.network
+  description        = "HANA firewall: hana-database-client"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["fd01::/48"]
+  destination_ranges = ["fd00::/64"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["30013", "30015", "30041-30043"]
+  }
+}
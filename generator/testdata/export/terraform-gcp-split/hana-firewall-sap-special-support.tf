@@ -0,0 +1,61 @@
+# Generated by hana-firewall 2.0 from firewalld services: sap-special-support
+
+resource "google_compute_firewall" "hana-firewall-sap-special-support-tcp" {
+  name               = "hana-firewall-sap-special-support-tcp"
+  network            = var.network
+  description        = "HANA firewall: sap-special-support"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["10.1.0.0/16"]
+  destination_ranges = ["10.0.0.0/24"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["1128-1129"]
+  }
+}
+
+resource "google_compute_firewall" "hana-firewall-sap-special-support-tcp-ipv6" {
+  name               = "hana-firewall-sap-special-support-tcp-ipv6"
+  network            = var.network
+  description        = "HANA firewall: sap-special-support"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["fd01::/48"]
+  destination_ranges = ["fd00::/64"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["1128-1129"]
+  }
+}
+
+resource "google_compute_firewall" "hana-firewall-sap-special-support-udp" {
+  name               = "hana-firewall-sap-special-support-udp"
+  network            = var.network
+  description        = "HANA firewall: sap-special-support"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["10.1.0.0/16"]
+  destination_ranges = ["10.0.0.0/24"]
+
+  allow {
+    protocol = "udp"
+    ports    = ["1129"]
+  }
+}
+
+resource "google_compute_firewall" "hana-firewall-sap-special-support-udp-ipv6" {
+  name               = "hana-firewall-sap-special-support-udp-ipv6"
+  network            = var.network
+  description        = "HANA firewall: sap-special-support"
+  direction          = "INGRESS"
+  priority           = 200
+  source_ranges      = ["fd01::/48"]
+  destination_ranges = ["fd00::/64"]
+
+  allow {
+    protocol = "udp"
+    ports    = ["1129"]
+  }
+}
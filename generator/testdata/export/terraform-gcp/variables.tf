@@ -0,0 +1,6 @@
+# Generated by hana-firewall 2.0
+
+variable "network" {
+  description = "Name or self link of the VPC network of the HANA hosts"
+  type        = string
+}
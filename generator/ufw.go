@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"sort"
+	"strings"
+)
+
+// UFWApplicationsDir is the directory of ufw application profiles.
+const UFWApplicationsDir = "/etc/ufw/applications.d"
+
+// ufwMaxPorts is the number of ports in a single port list of an application profile, a range counts as two ports.
+const ufwMaxPorts = 15
+
+// UFWProfileFileName returns the file name of the application profile generated for the firewalld service.
+func UFWProfileFileName(shortName string) string {
+	return PolicyName + "-" + shortName
+}
+
+/*
+ufwPorts returns the ports of the service in the notation of ufw application profiles, in which port lists of the
+same protocol are separated by comma, ranges are written as FIRST:LAST, and lists are separated by "|", such as
+"30013,30015,30041:30043/tcp|1129/udp". A list that exceeds the ports that ufw accepts is continued in the next list.
+*/
+func ufwPorts(svc model.FirewalldService) string {
+	lists := make([]string, 0, 2)
+	for _, protocol := range []string{model.FirewalldProtocolTCP, model.FirewalldProtocolUDP} {
+		ports := make([]int, 0, len(svc.Ports))
+		for _, port := range svc.Ports {
+			if port.Protocol == protocol {
+				ports = append(ports, port.Port)
+			}
+		}
+		list := make([]string, 0, ufwMaxPorts)
+		count := 0
+		for _, portRange := range model.FoldPortRanges(ports) {
+			entry, size := fmt.Sprint(portRange.First), 1
+			if portRange.Last != portRange.First {
+				entry, size = fmt.Sprintf("%d:%d", portRange.First, portRange.Last), 2
+			}
+			if count+size > ufwMaxPorts {
+				lists = append(lists, strings.Join(list, ",")+"/"+protocol)
+				list, count = list[:0], 0
+			}
+			list = append(list, entry)
+			count += size
+		}
+		if len(list) > 0 {
+			lists = append(lists, strings.Join(list, ",")+"/"+protocol)
+		}
+	}
+	return strings.Join(lists, "|")
+}
+
+/*
+UFWProfile returns the ufw application profile of the firewalld service, named after the service short name, so that
+"ufw app list" shows the same names as firewalld. An application profile cannot restrict the destination address, the
+description tells the address to be given to "ufw allow" instead.
+*/
+func UFWProfile(shortName string, svc model.FirewalldService) string {
+	description := strings.Join(strings.Fields(svc.Description), " ")
+	if svc.Destination != nil {
+		description += fmt.Sprintf(" Allow it to %s only.", svc.Destination.String())
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "[%s]\n", shortName)
+	fmt.Fprintf(&out, "title=%s\n", strings.Join(strings.Fields(svc.ShortName), " "))
+	fmt.Fprintf(&out, "description=%s\n", description)
+	fmt.Fprintf(&out, "ports=%s\n", ufwPorts(svc))
+	return out.String()
+}
+
+/*
+WriteUFWProfiles writes an ufw application profile per firewalld service into the directory, along with the provenance
+of the HANA service definition. Previously generated profiles that no longer correspond to a service are removed, and
+hand-modified profiles are treated the same way as WriteConfig does.
+*/
+func (fw *Firewalld) WriteUFWProfiles(destDir string, services map[string]model.FirewalldService) error {
+	contents := make(map[string]string)
+	for shortName, svc := range services {
+		def, _ := fw.definitionOf(shortName)
+		sources := []string{}
+		if def.FilePath != "" {
+			sources = append(sources, def.FilePath)
+		}
+		contents[UFWProfileFileName(shortName)] = model.HashCommentedDocumentWithProvenance(UFWProfile(shortName, svc), fw.provenance(sources...))
+	}
+	return writeOwnedFiles(destDir, UFWProfileFileName("*"), contents, fw.Force)
+}
+
+/*
+ApplyUFW generates firewalld services and writes them as ufw application profiles into the directory, which is usually
+UFWApplicationsDir. The generated services are returned in the order of their short names.
+*/
+func (fw *Firewalld) ApplyUFW(destDir string) (shortNames []string, services map[string]model.FirewalldService, err error) {
+	if services, err = fw.GenerateConfig(); err != nil {
+		return
+	}
+	if len(services) == 0 {
+		err = ErrNoServices
+		return
+	}
+	if err = fw.WriteUFWProfiles(destDir, services); err != nil {
+		return
+	}
+	for shortName := range services {
+		shortNames = append(shortNames, shortName)
+	}
+	sort.Strings(shortNames)
+	return
+}
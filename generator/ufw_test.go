@@ -0,0 +1,130 @@
+package generator
+
+import (
+	"github.com/SUSE/HANA-Firewall/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUFWProfile(t *testing.T) {
+	svc := model.FirewalldService{
+		ShortName:   "HANA database client access (instance 10)",
+		Description: "Provide access to system database\nand all tenant databases.",
+		Ports: []model.FirewalldPort{
+			{Port: 31013, Protocol: "tcp"}, {Port: 31015, Protocol: "tcp"},
+			{Port: 31041, Protocol: "tcp"}, {Port: 31042, Protocol: "tcp"}, {Port: 31043, Protocol: "tcp"},
+			{Port: 1129, Protocol: "udp"},
+		},
+		Destination: &model.FirewalldDestination{IPv4: "192.168.1.10"},
+	}
+	if profile := UFWProfile("hana-database-client-10", svc); profile != `[hana-database-client-10]
+title=HANA database client access (instance 10)
+description=Provide access to system database and all tenant databases. Allow it to 192.168.1.10 only.
+ports=31013,31015,31041:31043/tcp|1129/udp
+` {
+		t.Fatal(profile)
+	}
+	// A port list holds at most 15 ports, of which a range counts as two, hence the range goes into the next list
+	svc = model.FirewalldService{}
+	for port := 30000; port < 30028; port += 2 {
+		svc.Ports = append(svc.Ports, model.FirewalldPort{Port: port, Protocol: "tcp"})
+	}
+	svc.Ports = append(svc.Ports, model.FirewalldPort{Port: 30028, Protocol: "tcp"}, model.FirewalldPort{Port: 30029, Protocol: "tcp"})
+	if ports := ufwPorts(svc); ports != "30000,30002,30004,30006,30008,30010,30012,30014,30016,30018,30020,30022,30024,30026/tcp|30028:30029/tcp" {
+		t.Fatal(ports)
+	}
+}
+
+func TestFirewalld_ApplyUFW(t *testing.T) {
+	dest, err := ioutil.TempDir("", "hana-firewall-TestFirewalld_ApplyUFW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	// Profiles of other applications must survive
+	for fileName, content := range map[string]string{"openssh-server": "[OpenSSH]\nports=22/tcp\n", "hana-custom": "[hana-custom]\nports=1/tcp\n"} {
+		if err := ioutil.WriteFile(path.Join(dest, fileName), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw := Firewalld{
+		HANAGlobal: model.HANAGlobalParameters{InstanceNumbers: []string{"00"}},
+		HANAServices: []model.HANAServiceDefinition{
+			{FileBaseName: "HANA database client", FilePath: "/etc/hana-firewall/HANA database client", TCP: []string{"3__INST_NUM__13", "3__INST_NUM__15"}},
+			{FileBaseName: "SAP host agent", TCP: []string{"1128", "1129"}, UDP: []string{"1129"}},
+		},
+	}
+	shortNames, services, err := fw.ApplyUFW(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(shortNames, []string{"hana-database-client", "sap-host-agent"}) || len(services) != 2 {
+		t.Fatal(shortNames, services)
+	}
+	content, err := ioutil.ReadFile(path.Join(dest, "hana-firewall-hana-database-client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov, document, found := model.ParseProvenance(content)
+	if !found || !reflect.DeepEqual(prov.Sources, []string{"/etc/hana-firewall/HANA database client"}) ||
+		!strings.Contains(string(document), "ports=30013,30015/tcp\n") {
+		t.Fatalf("%+v\n%s", prov, content)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dest, "hana-firewall-sap-host-agent")); err != nil || !strings.Contains(string(content), "ports=1128:1129/tcp|1129/udp\n") {
+		t.Fatal(string(content), err)
+	}
+
+	// A profile that is no longer generated is removed, unless it was modified by hand
+	fw.HANAServices = fw.HANAServices[:1]
+	hostAgentPath := path.Join(dest, "hana-firewall-sap-host-agent")
+	if _, _, err := fw.ApplyUFW(dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(hostAgentPath); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(path.Join(dest, "hana-firewall-hana-database-client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dest, "hana-firewall-hana-database-client"), []byte(strings.Replace(string(content), "30015", "30017", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fw.ApplyUFW(dest); err == nil {
+		t.Fatal("did not error")
+	} else if _, ok := err.(*ModifiedError); !ok {
+		t.Fatal(err)
+	}
+	for _, fileName := range []string{"openssh-server", "hana-custom"} {
+		if _, err := os.Stat(path.Join(dest, fileName)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A hand-written profile of the same name is left alone
+	fw.HANAServices = append(fw.HANAServices, model.HANAServiceDefinition{FileBaseName: "SAP host agent", TCP: []string{"1128"}})
+	handWritten := []byte("[sap-host-agent]\ntitle=SAP host agent\ndescription=Written by hand\nports=1128/tcp\n")
+	if err := ioutil.WriteFile(hostAgentPath, handWritten, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dest, "hana-firewall-hana-database-client"), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fw.ApplyUFW(dest); err == nil {
+		t.Fatal("did not error")
+	} else if writeErr, ok := err.(*WriteError); !ok || writeErr.Path != hostAgentPath {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(hostAgentPath); err != nil || !reflect.DeepEqual(content, handWritten) {
+		t.Fatal(string(content), err)
+	}
+
+	// The directory is only there if ufw is installed
+	if _, _, err := fw.ApplyUFW(path.Join(dest, "missing")); err == nil {
+		t.Fatal("did not error")
+	}
+}
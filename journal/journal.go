@@ -0,0 +1,79 @@
+// Send structured log entries to systemd journal using its native protocol.
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SocketPath is the location of the native protocol socket of systemd journal.
+var SocketPath = "/run/systemd/journal/socket"
+
+// Syslog priorities used in the PRIORITY field.
+const (
+	PriorityError   = 3
+	PriorityWarning = 4
+	PriorityInfo    = 6
+)
+
+// validFieldName matches the field names accepted by journal, which consist of upper case letters, digits, and underscores.
+var validFieldName = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_]*$`)
+
+// IsAvailable returns true only if the journal socket exists and accepts connections.
+func IsAvailable() bool {
+	conn, err := net.Dial("unixgram", SocketPath)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+/*
+Encode serialises the fields into a journal entry, the fields are written in the order of their names. Values that
+span multiple lines are written in the binary-safe form of the protocol.
+*/
+func Encode(fields map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if !validFieldName.MatchString(name) {
+			return nil, fmt.Errorf("journal.Encode: invalid field name \"%s\"", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out bytes.Buffer
+	for _, name := range names {
+		value := fields[name]
+		if strings.ContainsRune(value, '\n') {
+			out.WriteString(name + "\n")
+			binary.Write(&out, binary.LittleEndian, uint64(len(value)))
+			out.WriteString(value + "\n")
+		} else {
+			out.WriteString(name + "=" + value + "\n")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// Send writes an entry of the fields into journal, the MESSAGE field should always be among them.
+func Send(fields map[string]string) error {
+	entry, err := Encode(fields)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unixgram", SocketPath)
+	if err != nil {
+		return fmt.Errorf("journal.Send: failed to connect to journal - %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(entry); err != nil {
+		return fmt.Errorf("journal.Send: failed to write into journal - %v", err)
+	}
+	return nil
+}
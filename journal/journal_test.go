@@ -0,0 +1,56 @@
+package journal
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	entry, err := Encode(map[string]string{"MESSAGE": "two\nlines", "PRIORITY": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry) != "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\nPRIORITY=3\n" {
+		t.Fatalf("%q", entry)
+	}
+	if _, err := Encode(map[string]string{"lower": "case"}); err == nil {
+		t.Fatal("should have failed")
+	}
+}
+
+func TestSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestSend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(orig string) {
+		SocketPath = orig
+	}(SocketPath)
+	SocketPath = path.Join(dir, "socket")
+	if IsAvailable() || Send(map[string]string{"MESSAGE": "hello"}) == nil {
+		t.Fatal("journal should not be available")
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: SocketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !IsAvailable() {
+		t.Fatal("journal should be available")
+	}
+	if err := Send(map[string]string{"MESSAGE": "hello", "SYSLOG_IDENTIFIER": "hana-firewall"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "MESSAGE=hello\nSYSLOG_IDENTIFIER=hana-firewall\n" {
+		t.Fatalf("%q", buf[:n])
+	}
+}
@@ -0,0 +1,387 @@
+/*
+Load HANA service definitions from layered directories.
+
+Definitions shipped by the vendor are located in /usr/share/hana-firewall, and definitions written by administrator are
+located in /etc/hana-firewall. A definition in /etc/hana-firewall overrides the vendor definition of the same name, and
+a definition may be masked entirely by a symbolic link to /dev/null. Each definition may be amended by drop-in files
+"<name>.conf.d/*.conf" in either directory, the drop-ins are applied in the order of their file names, and a drop-in in
+/etc/hana-firewall overrides the vendor drop-in of the same file name.
+*/
+package loader
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/model"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	VendorDir    = "/usr/share/hana-firewall"
+	AdminDir     = "/etc/hana-firewall"
+	DropInSuffix = ".conf.d"
+	DropInExt    = ".conf"
+
+	// Drop-in keys that add or remove individual ports, in addition to the TCP and UDP keys that replace all ports.
+	DropInTCPAddKey    = "TCP_ADD"
+	DropInTCPRemoveKey = "TCP_REMOVE"
+	DropInUDPAddKey    = "UDP_ADD"
+	DropInUDPRemoveKey = "UDP_REMOVE"
+)
+
+// DropInSchema declares the keys of drop-in files, which are those of service definitions plus the keys that add or remove ports.
+var DropInSchema = model.HANAServiceDefinitionSchema.With("drop-in",
+	DropInTCPAddKey, DropInTCPRemoveKey, DropInUDPAddKey, DropInUDPRemoveKey)
+
+// Definition is a HANA service definition merged from all layers, along with the files that contributed to it.
+type Definition struct {
+	// FilePath of the embedded definition is the definition file that takes precedence.
+	model.HANAServiceDefinition
+	DropIns    []string          // DropIns are paths of the drop-in files applied to the definition, in the order of application.
+	TCPOrigins map[string]string // TCPOrigins are TCP port definition vs path of the file that contributed the port.
+	UDPOrigins map[string]string // UDPOrigins are UDP port definition vs path of the file that contributed the port.
+}
+
+// SymlinkPolicy decides how symbolic links among definition directories are treated.
+type SymlinkPolicy int
+
+const (
+	SymlinkFollow SymlinkPolicy = iota // SymlinkFollow reads the file or directory the link points to.
+	SymlinkReject                      // SymlinkReject reports links as errors, except for the ones that mask a definition.
+)
+
+var (
+	// backupName matches names of files left behind by editors and package managers.
+	backupName = regexp.MustCompile(`(~|\.swp|\.swo|\.swx|\.bak|\.orig|\.rej|\.tmp|\.rpmnew|\.rpmsave|\.rpmorig|\.dpkg-[a-z]+)$|^#.*#$|^\.`)
+)
+
+// FileError is an error that occurred while reading a file or directory.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	switch e.Err.(type) {
+	case *txtparser.ParseError, txtparser.ParseErrors:
+		// Parse errors already mention the file path
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Report tells the files that were skipped and the errors that occurred while loading definitions.
+type Report struct {
+	Skipped  map[string]string // Skipped are file path vs the reason of skipping it, such as being a backup file.
+	Errors   []*FileError      // Errors are per-file errors, the files are left out of the definitions.
+	Warnings []*FileError      // Warnings are per-file problems, such as unknown keys, that do not leave the files out.
+}
+
+// Err returns an error that describes all per-file errors, or nil if there are none.
+func (report *Report) Err() error {
+	if len(report.Errors) == 0 {
+		return nil
+	}
+	return report
+}
+
+func (report *Report) Error() string {
+	msgs := make([]string, len(report.Errors))
+	for i, err := range report.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (report *Report) addError(filePath string, err error) {
+	report.Errors = append(report.Errors, &FileError{Path: filePath, Err: err})
+}
+
+func (report *Report) addWarning(filePath string, err error) {
+	report.Warnings = append(report.Warnings, &FileError{Path: filePath, Err: err})
+}
+
+// Loader reads HANA service definitions from layered directories.
+type Loader struct {
+	Dirs     []string      // Dirs are definition directories, ordered from the lowest precedence to the highest.
+	Symlinks SymlinkPolicy // Symlinks decides whether symbolic links are followed or rejected.
+	Strict   bool          // Strict rejects files that have syntax errors, instead of reading what can be read of them.
+}
+
+// NewLoader returns a loader that reads vendor definitions and then administrator definitions.
+func NewLoader() *Loader {
+	return &Loader{Dirs: []string{VendorDir, AdminDir}, Symlinks: SymlinkFollow}
+}
+
+/*
+NewLoaderFor returns a loader like NewLoader does, whose symlink policy is taken from the global configuration. An
+unknown policy falls back to SymlinkFollow, see HANAGlobalParameters.RejectsDefinitionSymlinks.
+*/
+func NewLoaderFor(global *model.HANAGlobalParameters) *Loader {
+	loader := NewLoader()
+	if reject, _ := global.RejectsDefinitionSymlinks(); reject {
+		loader.Symlinks = SymlinkReject
+	}
+	return loader
+}
+
+/*
+Load reads all definitions, merges their layers and drop-ins, and returns them in the order of their names. Definitions
+that do not have any port are left out. Only regular files with valid names are read, files left behind by editors and
+package managers are skipped, and files are never created. Errors do not stop the loading, instead, the erroneous
+files are left out and the errors are collected in the report.
+*/
+func (loader *Loader) Load() (ret []Definition, report *Report) {
+	ret = make([]Definition, 0, 16)
+	report = &Report{Skipped: make(map[string]string), Errors: make([]*FileError, 0, 0), Warnings: make([]*FileError, 0, 0)}
+	mainFiles, dropIns := loader.findFiles(report)
+	names := make([]string, 0, len(mainFiles))
+	for name := range mainFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def, filePath, err := loader.loadDefinition(name, mainFiles[name], dropIns[name], report)
+		if err != nil {
+			report.addError(filePath, err)
+			continue
+		}
+		if len(def.TCP) > 0 || len(def.UDP) > 0 {
+			ret = append(ret, def)
+		} else {
+			report.Skipped[def.FilePath] = "the definition does not have any port"
+		}
+	}
+	return
+}
+
+/*
+checkEntry decides whether a directory entry should be read. For a symbolic link, the returned info describes the
+link target if the link is followed. If the entry should not be read, the returned info is nil.
+*/
+func (loader *Loader) checkEntry(entryPath string, info os.FileInfo, report *Report) os.FileInfo {
+	name := info.Name()
+	if backupName.MatchString(name) {
+		report.Skipped[entryPath] = "the file looks like a backup or temporary file"
+		return nil
+	}
+	if err := model.ValidateDefinitionName(strings.TrimSuffix(strings.TrimSuffix(name, DropInSuffix), DropInExt)); err != nil {
+		report.addError(entryPath, err)
+		return nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if loader.Symlinks == SymlinkReject {
+			report.addError(entryPath, fmt.Errorf("symbolic links are not allowed"))
+			return nil
+		}
+		target, err := os.Stat(entryPath)
+		if err != nil {
+			report.addError(entryPath, err)
+			return nil
+		}
+		info = target
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		report.addError(entryPath, fmt.Errorf("the file is not a regular file"))
+		return nil
+	}
+	return info
+}
+
+/*
+findFiles returns definition name vs path of the definition file that takes precedence, and definition name vs paths
+of drop-in files in the order of application.
+*/
+func (loader *Loader) findFiles(report *Report) (mainFiles map[string]string, dropIns map[string][]string) {
+	mainFiles = make(map[string]string)
+	dropInFiles := make(map[string]map[string]string)
+	for _, dir := range loader.Dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			report.addError(dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			entryPath := path.Join(dir, entry.Name())
+			if entry.Mode()&os.ModeSymlink != 0 && isMasked(entryPath) {
+				delete(mainFiles, entry.Name())
+				continue
+			}
+			info := loader.checkEntry(entryPath, entry, report)
+			switch {
+			case info == nil:
+			case info.IsDir() && strings.HasSuffix(entry.Name(), DropInSuffix):
+				name := strings.TrimSuffix(entry.Name(), DropInSuffix)
+				if dropInFiles[name] == nil {
+					dropInFiles[name] = make(map[string]string)
+				}
+				for baseName, conf := range loader.findDropIns(entryPath, report) {
+					dropInFiles[name][baseName] = conf
+				}
+			case info.IsDir():
+				report.Skipped[entryPath] = "sub-directories other than drop-in directories are not read"
+			default:
+				mainFiles[entry.Name()] = entryPath
+			}
+		}
+	}
+	dropIns = make(map[string][]string)
+	for name, byBaseName := range dropInFiles {
+		baseNames := make([]string, 0, len(byBaseName))
+		for baseName := range byBaseName {
+			baseNames = append(baseNames, baseName)
+		}
+		sort.Strings(baseNames)
+		for _, baseName := range baseNames {
+			dropIns[name] = append(dropIns[name], byBaseName[baseName])
+		}
+	}
+	return
+}
+
+// findDropIns returns file name vs path of the drop-in files among the drop-in directory.
+func (loader *Loader) findDropIns(dropInDir string, report *Report) map[string]string {
+	ret := make(map[string]string)
+	entries, err := ioutil.ReadDir(dropInDir)
+	if err != nil {
+		report.addError(dropInDir, err)
+		return ret
+	}
+	for _, entry := range entries {
+		entryPath := path.Join(dropInDir, entry.Name())
+		if !strings.HasSuffix(entry.Name(), DropInExt) {
+			report.Skipped[entryPath] = "the name of a drop-in file must end with " + DropInExt
+			continue
+		}
+		if info := loader.checkEntry(entryPath, entry, report); info != nil && info.Mode().IsRegular() {
+			ret[entry.Name()] = entryPath
+		} else if info != nil {
+			report.Skipped[entryPath] = "sub-directories are not read"
+		}
+	}
+	return ret
+}
+
+// isMasked returns true if the symbolic link points to /dev/null.
+func isMasked(linkPath string) bool {
+	target, err := os.Readlink(linkPath)
+	return err == nil && target == os.DevNull
+}
+
+/*
+parseFile reads a definition or drop-in file, the file is never created. In strict mode, syntax errors and keys unknown
+to the schema are returned as errors, otherwise the unknown keys are only added to the report as a warning.
+*/
+func (loader *Loader) parseFile(filePath string, schema *txtparser.Schema, report *Report) (*txtparser.Sysconfig, error) {
+	if !loader.Strict {
+		conf, err := txtparser.ParseSysconfigFile(filePath, false)
+		if err == nil {
+			if keyErrs := schema.CheckKeys(filePath, conf); len(keyErrs) > 0 {
+				report.addWarning(filePath, keyErrs)
+			}
+		}
+		return conf, err
+	}
+	conf, err := txtparser.ParseSysconfigFileStrict(filePath)
+	if conf == nil {
+		return nil, err
+	}
+	parseErrs, _ := err.(txtparser.ParseErrors)
+	if parseErrs = parseErrs.Merge(schema.CheckKeys(filePath, conf)); len(parseErrs) > 0 {
+		return nil, parseErrs
+	}
+	return conf, nil
+}
+
+/*
+loadDefinition reads a definition file and applies drop-ins to it. If an error occurs, the path of the erroneous file
+is returned as well.
+*/
+func (loader *Loader) loadDefinition(name, mainFile string, dropIns []string, report *Report) (def Definition, errPath string, err error) {
+	errPath = mainFile
+	conf, err := loader.parseFile(mainFile, model.HANAServiceDefinitionSchema, report)
+	if err != nil {
+		return
+	}
+	def = Definition{
+		DropIns:    make([]string, 0, len(dropIns)),
+		TCPOrigins: make(map[string]string),
+		UDPOrigins: make(map[string]string),
+	}
+	def.HANAServiceDefinition = model.HANAServiceDefinition{FileBaseName: name, FilePath: mainFile}
+	def.ReadFrom(conf)
+	setOrigins(def.TCPOrigins, def.TCP, mainFile)
+	setOrigins(def.UDPOrigins, def.UDP, mainFile)
+	for _, dropIn := range dropIns {
+		dropInConf, err := loader.parseFile(dropIn, DropInSchema, report)
+		if err != nil {
+			return def, dropIn, err
+		}
+		def.DropIns = append(def.DropIns, dropIn)
+		def.TCP = applyDropIn(dropInConf, dropIn, def.TCP, def.TCPOrigins, model.HANAServiceDefinitionTCPKey, DropInTCPAddKey, DropInTCPRemoveKey)
+		def.UDP = applyDropIn(dropInConf, dropIn, def.UDP, def.UDPOrigins, model.HANAServiceDefinitionUDPKey, DropInUDPAddKey, DropInUDPRemoveKey)
+		// Other keys in the drop-in override those of the definition
+		for _, entry := range dropInConf.AllValues {
+			switch entry.Key {
+			case model.HANAServiceDefinitionTCPKey, model.HANAServiceDefinitionUDPKey, DropInTCPAddKey, DropInTCPRemoveKey, DropInUDPAddKey, DropInUDPRemoveKey:
+			default:
+				conf.Set(entry.Key, entry.Value)
+			}
+		}
+	}
+	// Read the overridden keys while retaining the merged ports
+	tcp, udp := def.TCP, def.UDP
+	def.ReadFrom(conf)
+	def.TCP, def.UDP = tcp, udp
+	return
+}
+
+// setOrigins remembers the file path as origin of all the ports.
+func setOrigins(origins map[string]string, ports []string, filePath string) {
+	for _, port := range ports {
+		origins[port] = filePath
+	}
+}
+
+// applyDropIn replaces, adds, and removes ports according to the drop-in, and returns the new ports.
+func applyDropIn(dropInConf *txtparser.Sysconfig, dropIn string, ports []string, origins map[string]string, replaceKey, addKey, removeKey string) []string {
+	if _, exists := dropInConf.KeyValue[replaceKey]; exists {
+		ports = dropInConf.GetStringArray(replaceKey, []string{})
+		for port := range origins {
+			delete(origins, port)
+		}
+		setOrigins(origins, ports, dropIn)
+	}
+	for _, port := range dropInConf.GetStringArray(addKey, []string{}) {
+		if _, exists := origins[port]; !exists {
+			ports = append(ports, port)
+			origins[port] = dropIn
+		}
+	}
+	for _, remove := range dropInConf.GetStringArray(removeKey, []string{}) {
+		if _, exists := origins[remove]; !exists {
+			continue
+		}
+		delete(origins, remove)
+		remaining := make([]string, 0, len(ports))
+		for _, port := range ports {
+			if port != remove {
+				remaining = append(remaining, port)
+			}
+		}
+		ports = remaining
+	}
+	return ports
+}
@@ -0,0 +1,213 @@
+package loader
+
+import (
+	"github.com/SUSE/HANA-Firewall/model"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates files of the content under the directory, file paths are relative to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for filePath, content := range files {
+		filePath = path.Join(dir, filePath)
+		if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestLoader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor := path.Join(dir, "vendor")
+	admin := path.Join(dir, "admin")
+	writeFiles(t, vendor, map[string]string{
+		"HANA cockpit":         "# HANA cockpit\nTCP=\"51021 51023\"\n",
+		"HANA database client": "# HANA database client access\nTCP=\"3__INST_NUM__13 3__INST_NUM__15\"\n",
+		"HANA database client.conf.d/10-vendor.conf":   "TCP_ADD=\"3__INST_NUM__41\"\n",
+		"HANA database client.conf.d/20-shadowed.conf": "TCP_ADD=\"9999\"\n",
+		"Masked": "TCP=\"1\"\n",
+	})
+	writeFiles(t, admin, map[string]string{
+		"HANA cockpit": "TCP=\"51021\"\nUDP=\"51022\"\n",
+		"HANA database client.conf.d/20-shadowed.conf": "TCP_REMOVE=\"3__INST_NUM__15\"\nDESCRIPTION=\"Local SQL\"\n",
+		"HANA database client.conf.d/30-admin.conf":    "UDP_ADD=\"3__INST_NUM__13\"\n",
+		"Custom": "TCP=\"2\"\n",
+	})
+	if err := os.Symlink(os.DevNull, path.Join(admin, "Masked")); err != nil {
+		t.Fatal(err)
+	}
+
+	defs, report := (&Loader{Dirs: []string{vendor, admin}}).Load()
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 3 {
+		t.Fatalf("%+v", defs)
+	}
+	custom, cockpit, client := defs[0], defs[1], defs[2]
+	if custom.FileBaseName != "Custom" || custom.FilePath != path.Join(admin, "Custom") {
+		t.Fatalf("%+v", custom)
+	}
+	// Administrator overrides vendor definition entirely
+	if cockpit.FilePath != path.Join(admin, "HANA cockpit") || !reflect.DeepEqual(cockpit.TCP, []string{"51021"}) ||
+		!reflect.DeepEqual(cockpit.UDP, []string{"51022"}) || cockpit.ShortDescription != "" {
+		t.Fatalf("%+v", cockpit)
+	}
+	// Drop-ins amend the definition
+	if !reflect.DeepEqual(client.TCP, []string{"3__INST_NUM__13", "3__INST_NUM__41"}) ||
+		!reflect.DeepEqual(client.UDP, []string{"3__INST_NUM__13"}) ||
+		client.ShortDescription != "HANA database client access" || client.Description != "Local SQL" {
+		t.Fatalf("%+v", client)
+	}
+	dropIns := []string{
+		path.Join(vendor, "HANA database client.conf.d/10-vendor.conf"),
+		path.Join(admin, "HANA database client.conf.d/20-shadowed.conf"),
+		path.Join(admin, "HANA database client.conf.d/30-admin.conf"),
+	}
+	if !reflect.DeepEqual(client.DropIns, dropIns) {
+		t.Fatalf("%+v", client.DropIns)
+	}
+	tcpOrigins := map[string]string{
+		"3__INST_NUM__13": path.Join(vendor, "HANA database client"),
+		"3__INST_NUM__41": dropIns[0],
+	}
+	if !reflect.DeepEqual(client.TCPOrigins, tcpOrigins) || client.UDPOrigins["3__INST_NUM__13"] != dropIns[2] {
+		t.Fatalf("%+v", client)
+	}
+}
+
+func TestLoader_Hardening(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestLoader_Hardening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"Good":                 "TCP=\"1\"\n",
+		"Good~":                "TCP=\"2\"\n",
+		".Good.swp":            "TCP=\"3\"\n",
+		"Good.rpmnew":          "TCP=\"4\"\n",
+		"Good.rpmsave":         "TCP=\"5\"\n",
+		"sub/Nested":           "TCP=\"6\"\n",
+		"Bad.name":             "TCP=\"7\"\n",
+		"Good.conf.d/a.conf~":  "TCP_ADD=\"8\"\n",
+		"Good.conf.d/b.conf":   "TCP_ADD=\"9\"\n",
+		"Good.conf.d/c.txt":    "TCP_ADD=\"10\"\n",
+		"No ports":             "# Nothing\n",
+		"target/Linked target": "TCP=\"11\"\n",
+	})
+	if err := os.Symlink(path.Join(dir, "target/Linked target"), path.Join(dir, "Linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(path.Join(dir, "does-not-exist"), path.Join(dir, "Dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Follow symbolic links
+	defs, report := (&Loader{Dirs: []string{dir}, Symlinks: SymlinkFollow}).Load()
+	if len(defs) != 2 || defs[0].FileBaseName != "Good" || defs[1].FileBaseName != "Linked" {
+		t.Fatalf("%+v", defs)
+	}
+	if !reflect.DeepEqual(defs[0].TCP, []string{"1", "9"}) || !reflect.DeepEqual(defs[1].TCP, []string{"11"}) {
+		t.Fatalf("%+v", defs)
+	}
+	errPaths := make([]string, 0, 0)
+	for _, fileErr := range report.Errors {
+		errPaths = append(errPaths, fileErr.Path)
+	}
+	if !reflect.DeepEqual(errPaths, []string{path.Join(dir, "Bad.name"), path.Join(dir, "Dangling")}) || report.Err() == nil {
+		t.Fatalf("%+v", errPaths)
+	}
+	for _, skipped := range []string{"Good~", ".Good.swp", "Good.rpmnew", "Good.rpmsave", "sub", "target", "Good.conf.d/a.conf~", "Good.conf.d/c.txt", "No ports"} {
+		if _, exists := report.Skipped[path.Join(dir, skipped)]; !exists {
+			t.Fatalf("%s is not skipped: %+v", skipped, report.Skipped)
+		}
+	}
+
+	// Reject symbolic links
+	defs, report = (&Loader{Dirs: []string{dir}, Symlinks: SymlinkReject}).Load()
+	if len(defs) != 1 || len(report.Errors) != 3 {
+		t.Fatalf("%+v %+v", defs, report.Errors)
+	}
+	// The policy comes from global configuration, and an unknown policy follows links
+	for policy, want := range map[string]SymlinkPolicy{"": SymlinkFollow, "follow": SymlinkFollow, "reject": SymlinkReject, "bogus": SymlinkFollow} {
+		if loader := NewLoaderFor(&model.HANAGlobalParameters{DefinitionSymlinks: policy}); loader.Symlinks != want {
+			t.Fatal(policy, loader.Symlinks)
+		}
+	}
+
+	// Loading never creates files
+	if _, report := (&Loader{Dirs: []string{path.Join(dir, "does-not-exist")}}).Load(); report.Err() != nil {
+		t.Fatal(report.Err())
+	}
+	if _, err := os.Stat(path.Join(dir, "does-not-exist")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestLoader_Strict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestLoader_Strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"Good":                  "TCP=\"1\"\n",
+		"Duplicate":             "TCP=\"2\"\nTCP=\"3\"\n",
+		"Drop-in":               "TCP=\"4\"\n",
+		"Drop-in.conf.d/a.conf": "TCP_ADD=\"5\n",
+	})
+	// Lenient mode reads what can be read
+	defs, report := (&Loader{Dirs: []string{dir}}).Load()
+	if len(defs) != 3 || report.Err() != nil {
+		t.Fatal(defs, report)
+	}
+	// Strict mode skips files that have syntax errors
+	defs, report = (&Loader{Dirs: []string{dir}, Strict: true}).Load()
+	if len(defs) != 1 || defs[0].FileBaseName != "Good" || len(report.Errors) != 2 {
+		t.Fatal(defs, report)
+	}
+	for _, fileErr := range report.Errors {
+		parseErrs, ok := fileErr.Err.(txtparser.ParseErrors)
+		if !ok || len(parseErrs) != 1 || parseErrs[0].File != fileErr.Path || parseErrs[0].Line != 1 && parseErrs[0].Line != 2 {
+			t.Fatal(fileErr)
+		}
+	}
+}
+
+func TestLoader_UnknownKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestLoader_UnknownKeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"Typo":               "TCP=\"1\"\nTPC=\"2\"\n",
+		"Typo.conf.d/a.conf": "TCP_ADD=\"3\"\nUDP_REMOVE=\"4\"\n",
+		"Typo.conf.d/b.conf": "TCP_AD=\"5\"\n",
+	})
+	// Lenient mode warns about unknown keys
+	defs, report := (&Loader{Dirs: []string{dir}}).Load()
+	if len(defs) != 1 || !reflect.DeepEqual(defs[0].TCP, []string{"1", "3"}) || len(report.Errors) != 0 || len(report.Warnings) != 2 {
+		t.Fatal(defs, report)
+	}
+	if msg := report.Warnings[1].Error(); msg != path.Join(dir, "Typo.conf.d/b.conf")+`:1: unknown key "TCP_AD" in drop-in, did you mean "TCP_ADD"?` {
+		t.Fatal(msg)
+	}
+	// Strict mode rejects the definition
+	defs, report = (&Loader{Dirs: []string{dir}, Strict: true}).Load()
+	if len(defs) != 0 || len(report.Errors) != 1 || report.Errors[0].Path != path.Join(dir, "Typo") {
+		t.Fatal(defs, report)
+	}
+}
@@ -2,32 +2,130 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"github.com/SUSE/HANA-Firewall/audit"
+	"github.com/SUSE/HANA-Firewall/discovery"
 	"github.com/SUSE/HANA-Firewall/generator"
+	"github.com/SUSE/HANA-Firewall/loader"
 	"github.com/SUSE/HANA-Firewall/model"
 	"github.com/SUSE/HANA-Firewall/txtparser"
+	"github.com/SUSE/HANA-Firewall/watcher"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
 )
 
+// SAPRoot is the directory where HANA systems are installed.
+const SAPRoot = "/usr/sap"
+
+// HANASharedRoot is the directory shared among the hosts of HANA systems, it holds their custom configuration.
+const HANASharedRoot = "/hana/shared"
+
+// FingerprintFile remembers the fingerprint of the configuration generated by the last run.
+const FingerprintFile = "/var/lib/hana-firewall/fingerprint"
+
 // printHelpAndExit prints usage help and then exits the program.
 func printHelpAndExit(exitStatus int) {
 	fmt.Println(`hana-firewall: helps to generate HANA network service definitions for firewalld.
 Usage:
-	# hana-firewall generate-firewalld-services
+	# hana-firewall generate-firewalld-services [--force] [--quiet] [--if-changed]
 		Generate firewalld service XML files according to HANA service definitions.
-		Previously generated XML files will be overwritten.
+		Previously generated XML files will be overwritten, and those no longer defined will be removed.
+		Generated files that were modified by hand, and files of the same name that were not generated, are left alone
+		and reported, unless --force is given.
+		With --quiet, print a one-line summary instead of the generated services.
+		With --if-changed, do nothing unless the configuration or the generated files changed since the last
+		successful run, and reload firewalld after generating the files. This is used by hana-firewall.service.
+		If policy zones are configured, a firewalld policy for routed HANA traffic is generated as well.
+	# hana-firewall generate-ufw-profiles [--force] [--quiet]
+		Generate ufw application profiles in /etc/ufw/applications.d, named the same as the firewalld services.
+		Previously generated profiles will be overwritten, and those no longer defined will be removed.
+		Generated profiles that were modified by hand are left alone and reported, unless --force is given.
+		With --quiet, print a one-line summary instead of the generated profiles.
 	# hana-firewall dry-run
 		Display the service name and port numbers that will be generated in firewalld service XML files.
+	# hana-firewall show [--origin]
+		Display all HANA service definitions merged from /usr/share/hana-firewall and /etc/hana-firewall.
+		With --origin, display the file that contributed each port.
+	# hana-firewall list [--service TEXT] [--port PORT]
+		Display every HANA service definition with its file, state, descriptions, port definitions, and the port
+		numbers they yield per instance. Optionally only the definitions whose name contains TEXT, or that open PORT.
+	# hana-firewall which-port PORT[/tcp|/udp]
+		Explain which HANA service definitions open the port, and how their port definitions yield it.
+		Exit status is 1 if no definition opens the port.
+	# hana-firewall export --format kubernetes|cilium [--cidr CIDRS] [--namespace NS] [--pod-selector LABELS]
+	                       [--split] [--output DIR]
+		Render the firewalld services that would be generated as egress policies of client pods towards HANA:
+		a Kubernetes NetworkPolicy or a CiliumNetworkPolicy. CIDRS of the HANA hosts are separated by comma, and
+		services restricted to instance addresses use those instead. LABELS are KEY=VALUE separated by comma.
+		With --split, render one policy per service. The policies are printed unless DIR is given.
+	# hana-firewall export --format aws|azure|gcp|terraform --source-cidr CIDRS [--cidr CIDRS] [--priority NUM]
+	                       [--name-prefix PREFIX] [--provider aws|azure|gcp] [--max-rules NUM] [--split] [--output DIR]
+		Render the firewalld services that would be generated as ingress rules of cloud security groups: AWS
+		security group permissions, Azure network security rules, GCP firewall rules, or a Terraform module of
+		either. Port ranges are merged, or services combined, to fit in the rule limit of the provider, which
+		split files share. Split JSON files are printed as a single JSON array unless DIR is given.
+	# hana-firewall export --format ansible|salt [--split] [--output DIR]
+		Render the firewalld services that would be generated, the firewalld policy, and the zones that allow the
+		services in /usr/lib/firewalld/zones and /etc/firewalld/zones, as an Ansible task file or a Salt state file.
 	# hana-firewall define-new-hana-service
 		Interactively create a new HANA network service definition.
+	# hana-firewall define-new-hana-service --name NAME [--tcp PORTS] [--udp PORTS] [--short-description TEXT]
+	                                       [--description TEXT] [--force]
+		Create a new HANA network service definition without asking questions. PORTS are separated by space or comma.
+		An existing definition of the same name is only overwritten with --force.
+	# hana-firewall edit-hana-service --name NAME [--tcp PORTS] [--udp PORTS] [--short-description TEXT] [--description TEXT]
+		Change the ports or descriptions of an existing HANA network service definition, comments are retained.
+	# hana-firewall rename-hana-service --name NAME --new-name NEW_NAME
+		Rename a HANA network service definition, its drop-ins, its generated firewalld service, and references among
+		zones and policies.
+	# hana-firewall delete-hana-service --name NAME
+		Delete a HANA network service definition, its drop-ins, its generated firewalld service, and references among
+		zones and policies. A shipped definition of the same name applies again.
+	# hana-firewall import <firewalld service XML file> [definition name]
+		Create a new HANA network service definition from a hand-written firewalld service XML file.
+		Port numbers of the configured HANA instances are turned back into instance number placeholders.
+		Only TCP and UDP ports can be imported, other elements of the XML file are reported as an error.
+	# hana-firewall migrate-from-v1 [1.x sysconfig file] [1.x definition directory]
+		Carry over HANA systems, custom services, and interface-to-service mappings from hana-firewall 1.x.
+		The defaults are /etc/sysconfig/hana-firewall and /etc/hana-firewall.d.
+	# hana-firewall audit
+		Compare the sockets listening on this host against the generated firewalld services, and display per HANA
+		instance the HANA ports not opened by any service, and the opened ports that nothing listens on.
+		Exit status is 1 if any HANA port is not opened.
+	# hana-firewall watch [--debounce DURATION] [--force]
+		Keep running, and whenever /etc/sysconfig/hana-firewall, service definitions, HANA systems in /usr/sap, or
+		their custom configuration and instance profiles change, regenerate firewalld services and reload firewalld.
+		The default DURATION to wait for a burst of changes to settle is 2s. SIGHUP re-reads the configuration right
+		away, SIGTERM stops watching.
+	# hana-firewall validate
+		Check /etc/sysconfig/hana-firewall and all HANA service definitions for syntax errors, such as lines that are
+		not KEY="value", unterminated quotes, and duplicate keys, for unknown keys, such as a misspelled TPC, and for
+		invalid port definitions.
 	# hana-firewall help
-		Display this help message.`)
+		Display this help message.
+
+Global options, given before the command:
+	--log-format text|json|journal
+		Print diagnostic messages to standard error as plain text (default) or one JSON object per line,
+		or send them to systemd journal with structured fields.
+
+Exit status:
+	0 success, 1 other failure, 2 incorrect command line, 3 not run as root or permission denied,
+	4 configuration or definition file cannot be read or parsed, 5 invalid configuration or definition value,
+	6 generated files cannot be written.`)
 	os.Exit(exitStatus)
 }
 
@@ -39,96 +137,196 @@ func cliArg(i int) string {
 	return ""
 }
 
-// errorExit prints out a message to standard error and then exits the program with status 1.
-func errorExit(template string, stuff ...interface{}) {
-	fmt.Fprintf(os.Stderr, template+"\n", stuff...)
-	os.Exit(1)
-}
-
 func main() {
+	os.Args = parseLogFormat(os.Args)
 	if arg1 := cliArg(1); arg1 == "" || strings.Contains(arg1, "help") {
-		printHelpAndExit(0)
+		printHelpAndExit(ExitOK)
 	}
 	// All other actions require root privilege
 	if os.Geteuid() != 0 {
-		errorExit("Please run hana-firewall with root privilege.")
+		exitWithStatus(ExitPermission, "Please run hana-firewall with root privilege.")
 		return
 	}
 	switch cliArg(1) {
 	case "generate-firewalld-services":
-		GenerateFirewalldServices()
+		GenerateFirewalldServices(os.Args[2:])
+	case "generate-ufw-profiles":
+		GenerateUFWProfiles(os.Args[2:])
 	case "dry-run":
 		DryRun()
+	case "show":
+		ShowDefinitions(os.Args[2:])
+	case "list":
+		ListDefinitions(os.Args[2:])
+	case "which-port":
+		WhichPort(os.Args[2:])
+	case "export":
+		Export(os.Args[2:])
 	case "define-new-hana-service":
 		CreateNewService()
+	case "edit-hana-service":
+		EditService(os.Args[2:])
+	case "rename-hana-service":
+		RenameService(os.Args[2:])
+	case "delete-hana-service":
+		DeleteService(os.Args[2:])
+	case "import":
+		ImportService(cliArg(2), cliArg(3))
+	case "migrate-from-v1":
+		MigrateFromV1(cliArg(2), cliArg(3))
+	case "audit":
+		Audit(os.Args[2:])
+	case "watch":
+		Watch(os.Args[2:])
+	case "validate":
+		Validate(os.Args[2:])
+	default:
+		usageExit("Unknown command \"%s\", please see \"hana-firewall help\".", cliArg(1))
 	}
 }
 
 // readConfig reads HANA firewall configuration from /etc and return. If an error occurs, the program will exit.
 func readConfig() (globalParams model.HANAGlobalParameters, services []model.HANAServiceDefinition) {
-	// Read HANA firewall global config
-	globalConf, err := txtparser.ParseSysconfigFile("/etc/sysconfig/hana-firewall", true)
+	globalParams, definitions := readLayeredConfig()
+	services = make([]model.HANAServiceDefinition, 0, len(definitions))
+	for _, def := range definitions {
+		services = append(services, def.HANAServiceDefinition)
+	}
+	return
+}
+
+/*
+readLayeredConfig reads HANA firewall configuration from /etc, and service definitions from both vendor and administrator
+directories along with the origin of their ports. If an error occurs, the program will exit.
+*/
+func readLayeredConfig() (globalParams model.HANAGlobalParameters, definitions []loader.Definition) {
+	globalParams, definitions, err := loadLayeredConfig()
+	if err != nil {
+		errorExit("Failed to read HANA firewall configuration - %v", err)
+	}
+	return
+}
+
+/*
+loadLayeredConfig works like readLayeredConfig, but returns the error of reading global configuration instead of exiting
+the program. Erroneous service definitions are skipped with a warning.
+*/
+func loadLayeredConfig() (globalParams model.HANAGlobalParameters, definitions []loader.Definition, err error) {
+	// Read HANA firewall global config, a missing file is the same as an empty one.
+	globalConf, err := txtparser.ParseSysconfigFile(model.HANAGlobalParametersFile, false)
+	if os.IsNotExist(err) {
+		globalConf, err = txtparser.ParseSysconfig("")
+	}
 	if err != nil {
-		errorExit("Failed to create/open /etc/sysconfig/hana-firewall - %v", err)
+		err = &loader.FileError{Path: model.HANAGlobalParametersFile, Err: err}
 		return
 	}
+	for _, keyErr := range model.HANAGlobalParametersSchema.CheckKeys(model.HANAGlobalParametersFile, globalConf) {
+		log.Printf("readConfig: %v", keyErr)
+	}
 	globalParams = model.HANAGlobalParameters{}
 	globalParams.ReadFrom(globalConf)
-	// Read HANA service definitions - all of them
-	services = make([]model.HANAServiceDefinition, 0, 10)
-	walkRoot := "/etc/hana-firewall"
-	err = filepath.Walk(walkRoot, func(path string, info os.FileInfo, err error) error {
-		if path == walkRoot {
-			// Move on from the directory
-			return nil
-		}
-		service := model.HANAServiceDefinition{}
-		serviceConf, err := txtparser.ParseSysconfigFile(path, true)
-		if err != nil {
-			log.Printf("GenerateFirewalldServices: skip definition file \"%s\" due to error - %v", path, err)
-			// Move on
-			return nil
+	// Discover HANA systems installed on this host
+	systems, discoverErr := discovery.DiscoverSystems(SAPRoot)
+	if discoverErr != nil {
+		log.Printf("readConfig: failed to discover HANA systems in %s - %v", SAPRoot, discoverErr)
+	}
+	// Read the custom INI configuration of each system for the port placeholders that refer to it
+	for i, system := range systems {
+		config, tenantConfig, configErr := discovery.DiscoverConfig(SAPRoot, HANASharedRoot, system.SID)
+		if configErr != nil {
+			log.Printf("readConfig: failed to read configuration of HANA system %s - %v", system.SID, configErr)
 		}
-		service.ReadFrom(serviceConf)
-		// Skip services with empty definition
-		if len(service.TCP) > 0 || len(service.UDP) > 0 {
-			service.FileBaseName = filepath.Base(path)
-			services = append(services, service)
+		systems[i].Config, systems[i].TenantConfig = config, tenantConfig
+	}
+	// Resolving virtual host names may be slow, only instance destinations need their addresses
+	if globalParams.DestinationsEnabled() {
+		if resolveErr := discovery.ResolveVirtualHosts(systems, discovery.DefaultResolveTimeout); resolveErr != nil {
+			log.Printf("readConfig: failed to resolve virtual host names of HANA systems - %v", resolveErr)
 		}
-		return nil
-	})
-	if err != nil {
-		errorExit("Failed to read /etc/hana-firewall directory - %v", err)
-		return
+	}
+	globalParams.UseDiscoveredSystems(systems)
+	if _, symlinkErr := globalParams.RejectsDefinitionSymlinks(); symlinkErr != nil {
+		log.Printf("readConfig: %v", symlinkErr)
+	}
+	// Read HANA service definitions - all of them. Erroneous definitions are skipped.
+	definitions, report := loader.NewLoaderFor(&globalParams).Load()
+	for _, fileErr := range report.Errors {
+		log.Printf("readConfig: skip definition file \"%s\" due to error - %v", fileErr.Path, fileErr.Err)
+	}
+	for _, warning := range report.Warnings {
+		log.Printf("readConfig: %v", warning)
 	}
 	return
 }
 
-// GenerateFirewalldServices generates latest HANA service definition XML files for firewalld.
-func GenerateFirewalldServices() {
+/*
+GenerateFirewalldServices generates latest HANA service definition XML files for firewalld. Generated files that were
+modified by hand are only overwritten with --force. With --if-changed, the files are only generated if the resulting
+configuration or the generated files on disk differ from those of the last successful run, and firewalld is reloaded
+afterwards. The program exits with ExitFailure if the reload fails.
+*/
+func GenerateFirewalldServices(args []string) {
+	flags := flag.NewFlagSet("generate-firewalld-services", flag.ExitOnError)
+	force := flags.Bool("force", false, "overwrite and remove generated files even if they were modified by hand")
+	quiet := flags.Bool("quiet", false, "print a one-line summary instead of the generated services")
+	ifChanged := flags.Bool("if-changed", false, "generate only if the configuration changed since the last run, then reload firewalld")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
 	globalParams, services := readConfig()
 	// Generate firewalld service definitions
 	fw := generator.Firewalld{
 		HANAGlobal:   globalParams,
 		HANAServices: services,
+		Force:        *force,
 	}
-	firewalldServices, err := fw.GenerateConfig()
-	if err != nil {
-		errorExit("Failed to generate firewall config - %v", err)
-		return
+	lastFingerprint := ""
+	if *ifChanged {
+		if content, err := ioutil.ReadFile(FingerprintFile); err == nil {
+			lastFingerprint = string(content)
+		}
 	}
-	if len(firewalldServices) == 0 {
+	applied, err := fw.Apply("/etc/firewalld", lastFingerprint)
+	if err == generator.ErrNoServices {
 		errorExit("HANA instance number or service definitions are missing. Please check /etc/hana-firewall directory and /etc/sysconfig/hana-firewall file.")
 		return
+	} else if err != nil {
+		errorExit("Failed to generate or write firewall config - %v", err)
+		return
 	}
-	fmt.Printf("Generating %d services in /etc/firewalld/services:\n", len(firewalldServices))
-	for _, svc := range firewalldServices {
-		fmt.Println(svc.String())
-		fmt.Println("----------------------------------------------------------")
+	printStaleReferences(&fw, applied.Services)
+	if !applied.Changed {
+		reportInfo("HANA firewall configuration has not changed since the last run, there is nothing to do.")
+		return
+	}
+	firewalldServices, policies := applied.Services, applied.Policies
+	if !*quiet {
+		printSkippedServices(&fw)
+		fmt.Printf("Generated %d services in /etc/firewalld/services:\n", len(firewalldServices))
+		for shortName, svc := range firewalldServices {
+			fmt.Printf("[%s]\n%s\n", shortName, svc.String())
+			fmt.Println("----------------------------------------------------------")
+		}
+		if len(policies) > 0 {
+			fmt.Printf("Generated %d policies in /etc/firewalld/policies:\n", len(policies))
+			for _, policy := range policies {
+				fmt.Println(policy.String())
+				fmt.Println("----------------------------------------------------------")
+			}
+		}
 	}
-	// Write firewalld service definition XML
-	if err := fw.WriteConfig("/etc/firewalld/services", firewalldServices); err != nil {
-		errorExit("Failed to write XML files into /etc/firewalld/services - %v", err)
+	if *ifChanged {
+		if _, err := reloadAndRemember(applied); err != nil {
+			errorExit("%v", err)
+			return
+		}
+		reportInfo("Generated %d services and %d policies, and reloaded firewalld.", len(firewalldServices), len(policies))
+		return
+	}
+	if *quiet {
+		reportInfo("Generated %d services and %d policies, please restart firewalld service to make them visible.", len(firewalldServices), len(policies))
 		return
 	}
 	fmt.Println(`All done!
@@ -136,6 +334,98 @@ Please restart firewalld service (systemctl restart firewalld.service) to make n
 Remember: transient firewall configuration are lost when restarting firewalld.service.`)
 }
 
+// GenerateUFWProfiles generates ufw application profiles for the HANA services.
+func GenerateUFWProfiles(args []string) {
+	flags := flag.NewFlagSet("generate-ufw-profiles", flag.ExitOnError)
+	force := flags.Bool("force", false, "overwrite and remove generated profiles even if they were modified by hand")
+	quiet := flags.Bool("quiet", false, "print a one-line summary instead of the generated profiles")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	globalParams, services := readConfig()
+	fw := generator.Firewalld{
+		HANAGlobal:   globalParams,
+		HANAServices: services,
+		Force:        *force,
+	}
+	shortNames, profiles, err := fw.ApplyUFW(generator.UFWApplicationsDir)
+	if err == generator.ErrNoServices {
+		errorExit("HANA instance number or service definitions are missing. Please check /etc/hana-firewall directory and /etc/sysconfig/hana-firewall file.")
+		return
+	} else if err != nil {
+		errorExit("Failed to generate or write ufw profiles - %v", err)
+		return
+	}
+	if *quiet {
+		reportInfo("Generated %d ufw application profiles in %s.", len(shortNames), generator.UFWApplicationsDir)
+		return
+	}
+	printSkippedServices(&fw)
+	fmt.Printf("Generated %d ufw application profiles in %s:\n", len(shortNames), generator.UFWApplicationsDir)
+	for _, shortName := range shortNames {
+		fmt.Print(generator.UFWProfile(shortName, profiles[shortName]))
+		fmt.Println("----------------------------------------------------------")
+	}
+	fmt.Println(`All done!
+Run "ufw app list" to see the HANA applications, and "ufw allow APPLICATION" to allow one of them.
+Run "ufw app update APPLICATION" to refresh rules that already use a changed application.`)
+}
+
+/*
+reloadAndRemember reloads firewalld to make the applied configuration visible, and then remembers its fingerprint for
+the next run. The fingerprint is only remembered after a successful reload, so that a failed reload is retried next
+time. If firewalld is reloaded but the fingerprint cannot be written, reloaded is true along with the error.
+*/
+func reloadAndRemember(applied generator.Applied) (reloaded bool, err error) {
+	if err := generator.ReloadFirewalld(); err != nil {
+		return false, fmt.Errorf("Generated %d services and %d policies, but firewalld could not be reloaded - %w", len(applied.Services), len(applied.Policies), err)
+	}
+	if err := writeFingerprint(applied.Fingerprint); err != nil {
+		return true, fmt.Errorf("Failed to write %s - %w", FingerprintFile, err)
+	}
+	return true, nil
+}
+
+/*
+printStaleReferences warns about zones and policies in /etc/firewalld that enable a service which is no longer generated,
+because its definition now yields services of other names, and tells which services to enable instead.
+*/
+func printStaleReferences(fw *generator.Firewalld, services map[string]model.FirewalldService) {
+	stale, err := fw.FindStaleReferences("/etc/firewalld", services)
+	if err != nil {
+		reportWarning("Failed to look for zones and policies that refer to services no longer generated - %v", err)
+		return
+	}
+	for _, ref := range stale {
+		reportWarning("%s enables service \"%s\", which is no longer generated, please enable %s instead.", ref.Path, ref.ShortName, strings.Join(ref.Replacements, " "))
+	}
+}
+
+// writeFingerprint remembers the fingerprint of generated configuration for the next run.
+func writeFingerprint(fingerprint string) error {
+	if err := os.MkdirAll(path.Dir(FingerprintFile), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(FingerprintFile, []byte(fingerprint), 0600)
+}
+
+// printSkippedServices prints the HANA service definitions that are not turned into firewalld services, and the reasons.
+func printSkippedServices(fw *generator.Firewalld) {
+	_, skipped := fw.ApplicableServices()
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Skip definition \"%s\": %s\n", name, skipped[name])
+	}
+	if len(names) > 0 {
+		fmt.Println("----------------------------------------------------------")
+	}
+}
+
 func DryRun() {
 	globalParams, services := readConfig()
 	// Generate firewalld service definitions
@@ -148,27 +438,37 @@ func DryRun() {
 		errorExit("Failed to generate firewall config - %v", err)
 		return
 	}
-	for _, svc := range firewalldServices {
-		fmt.Println(svc.String())
+	for shortName, svc := range firewalldServices {
+		fmt.Printf("[%s]\n%s\n", shortName, svc.String())
 		fmt.Println("----------------------------------------------------------")
 	}
+	for _, policy := range fw.GeneratePolicies(firewalldServices) {
+		fmt.Println(policy.String())
+		fmt.Println("----------------------------------------------------------")
+	}
+	printSkippedServices(&fw)
 	fmt.Println(`If you run "hana-firewall generate-firewalld-services", the services above will be made available in firewalld.`)
 }
 
+// CreateNewService creates a new HANA service definition, interactively if there are no command line flags.
 func CreateNewService() {
+	if len(os.Args) > 2 {
+		createNewServiceFromFlags(os.Args[2:])
+		return
+	}
 	stdin := bufio.NewReader(os.Stdin)
 	fmt.Println("--------------------------------------------------------------")
 	fmt.Println("How would you like to name the new service? (e.g. \"database application support\"")
 	name, _ := stdin.ReadString('\n')
 	name = strings.TrimSpace(name)
-	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, '.') {
-		errorExit("Sorry, the name may not contain slash or full-stop character.")
-		return
-	}
 	if name == "" {
 		errorExit("Sorry, you have to give the new service a name.")
 		return
 	}
+	if err := model.ValidateDefinitionName(name); err != nil {
+		errorExit("Sorry, %v.", err)
+		return
+	}
 	fmt.Println("--------------------------------------------------------------")
 	fmt.Println("Which TCP ports are used by the service? Use space to separate multiple ports. If there are none, simply press enter.")
 	fmt.Println("For a special case, placeholder \"__INST_NUM__\" will be substituted by HANA instance numbers. and \"__INST_NUM+1__\" will be substituted by HANA instance number plus one.")
@@ -206,3 +506,979 @@ func CreateNewService() {
 	fmt.Println("--------------------------------------------------------------")
 	fmt.Println("All done! Remember to run \"hana-firewall generate-firewalld-services\" to make use of the new service.")
 }
+
+// ImportService reads a firewalld service XML file and writes an equivalent HANA service definition.
+func ImportService(xmlPath, name string) {
+	if xmlPath == "" {
+		usageExit("Please specify the path to firewalld service XML file.")
+		return
+	}
+	globalParams, _ := readConfig()
+	content, err := ioutil.ReadFile(xmlPath)
+	if err != nil {
+		errorExit("Failed to read \"%s\": %v", xmlPath, err)
+		return
+	}
+	svc, err := model.ParseFirewalldServiceXML(content)
+	if err != nil {
+		errorExit("Failed to read firewalld service from \"%s\": %v", xmlPath, err)
+		return
+	}
+	// The name of definition comes from command line, or the short name of the service, or the XML file name.
+	for _, candidate := range []string{svc.ShortName, strings.TrimSuffix(filepath.Base(xmlPath), ".xml")} {
+		if name == "" && model.ValidateDefinitionName(strings.TrimSpace(candidate)) == nil {
+			name = strings.TrimSpace(candidate)
+		}
+	}
+	if name == "" {
+		errorExit("Sorry, please give the definition a name.")
+		return
+	}
+	if err := model.ValidateDefinitionName(name); err != nil {
+		errorExit("Sorry, %v.", err)
+		return
+	}
+	filePath := path.Join("/etc/hana-firewall/", name)
+	if _, err := os.Stat(filePath); err == nil {
+		errorExit("Service definition \"%s\" already exists, please choose a different name.", filePath)
+		return
+	}
+	if len(globalParams.InstanceNumbers) == 0 {
+		fmt.Println("HANA_INSTANCE_NUMBERS is empty in /etc/sysconfig/hana-firewall, port numbers will be imported as-is.")
+	}
+	service := globalParams.MakeHANAServiceDefinition(name, &svc)
+	serviceConf, _ := txtparser.ParseSysconfig("")
+	service.WriteInto(serviceConf)
+	serviceConf.AllValues[0].LeadingComments = []string{"# " + model.DefinitionImportedComment + xmlPath, ""}
+	if err := ioutil.WriteFile(filePath, []byte(serviceConf.ToText()), 0600); err != nil {
+		errorExit("Failed to create service definition file at \"%s\": %v", filePath, err)
+		return
+	}
+	fmt.Printf("Created service definition \"%s\":\n%s", filePath, serviceConf.ToText())
+	fmt.Println("--------------------------------------------------------------")
+	fmt.Println("Please review the definition, and then run \"hana-firewall generate-firewalld-services\" to make use of it.")
+}
+
+// MigrateFromV1 converts hana-firewall 1.x configuration into 2.x global configuration, definitions, and firewalld zones.
+func MigrateFromV1(legacyConfPath, legacyDefDir string) {
+	if legacyConfPath == "" {
+		legacyConfPath = "/etc/sysconfig/hana-firewall"
+	}
+	if legacyDefDir == "" {
+		legacyDefDir = "/etc/hana-firewall.d"
+	}
+	legacyConf, err := txtparser.ParseSysconfigFile(legacyConfPath, false)
+	if err != nil {
+		errorExit("Failed to open hana-firewall 1.x configuration \"%s\" - %v", legacyConfPath, err)
+		return
+	}
+	var legacy model.LegacyConfiguration
+	legacy.ReadFrom(legacyConf)
+	// Read the 2.x global configuration as it is written, without values discovered from the HANA systems.
+	globalContent, err := ioutil.ReadFile(model.HANAGlobalParametersFile)
+	if err != nil && !os.IsNotExist(err) {
+		errorExit("Failed to open %s - %v", model.HANAGlobalParametersFile, err)
+		return
+	}
+	globalConf, err := txtparser.ParseSysconfigFile(model.HANAGlobalParametersFile, true)
+	if err != nil {
+		errorExit("Failed to create/open %s - %v", model.HANAGlobalParametersFile, err)
+		return
+	}
+	var globalParams model.HANAGlobalParameters
+	globalParams.ReadFrom(globalConf)
+	// The 1.x settings are removed from the file, which is kept as a backup beforehand.
+	backupPath := model.HANAGlobalParametersFile + ".v1"
+	removedKeys := model.RemoveLegacySettings(globalConf)
+	if _, err := os.Stat(backupPath); err == nil && len(removedKeys) > 0 {
+		errorExit("The backup \"%s\" already exists, please move it away before migrating again.", backupPath)
+		return
+	}
+	definitions, loadReport := loader.NewLoaderFor(&globalParams).Load()
+	for _, fileErr := range loadReport.Errors {
+		log.Printf("MigrateFromV1: skip definition file \"%s\" due to error - %v", fileErr.Path, fileErr.Err)
+	}
+	services := make([]model.HANAServiceDefinition, 0, len(definitions))
+	for _, def := range definitions {
+		services = append(services, def.HANAServiceDefinition)
+	}
+	report := make([]string, 0, 10)
+
+	// Carry over custom service definitions, the built-in ones are already shipped with 2.x.
+	legacyDefs, err := ioutil.ReadDir(legacyDefDir)
+	if err != nil && !os.IsNotExist(err) {
+		errorExit("Failed to read hana-firewall 1.x service definitions from \"%s\" - %v", legacyDefDir, err)
+		return
+	}
+	customDefs := make(map[string]*txtparser.Sysconfig)
+	for _, info := range legacyDefs {
+		name := info.Name()
+		legacyDefPath := path.Join(legacyDefDir, name)
+		if newName, isBuiltIn := model.LegacyServiceNames[name]; isBuiltIn || !info.Mode().IsRegular() {
+			if isBuiltIn {
+				fmt.Printf("Service \"%s\" is replaced by the 2.x definition \"%s\".\n", name, newName)
+			}
+			continue
+		}
+		if err := model.ValidateDefinitionName(name); err != nil {
+			report = append(report, fmt.Sprintf("%s: the custom service cannot be migrated under its name - %v", legacyDefPath, err))
+			continue
+		}
+		defConf, err := txtparser.ParseSysconfigFile(legacyDefPath, false)
+		if err != nil {
+			report = append(report, fmt.Sprintf("%s: failed to read the custom service - %v", legacyDefPath, err))
+			continue
+		}
+		service := model.HANAServiceDefinition{FileBaseName: name}
+		service.ReadFrom(defConf)
+		if len(service.TCP) == 0 && len(service.UDP) == 0 {
+			report = append(report, fmt.Sprintf("%s: the custom service does not define TCP or UDP ports", legacyDefPath))
+			continue
+		}
+		filePath := path.Join("/etc/hana-firewall/", name)
+		if _, err := os.Stat(filePath); err == nil {
+			report = append(report, fmt.Sprintf("%s: not migrated because \"%s\" already exists", legacyDefPath, filePath))
+			continue
+		}
+		serviceConf, _ := txtparser.ParseSysconfig("")
+		service.WriteInto(serviceConf)
+		serviceConf.AllValues[0].LeadingComments = []string{"# " + name, "# " + model.DefinitionMigratedComment + legacyDefPath, ""}
+		customDefs[legacyDefPath] = serviceConf
+		services = append(services, service)
+	}
+
+	// Nothing is written until the zones are known to be distinct
+	migration, err := legacy.Migrate(services)
+	if err != nil {
+		errorExit("Failed to migrate hana-firewall 1.x configuration - %v", err)
+		return
+	}
+	legacyDefPaths := make([]string, 0, len(customDefs))
+	for legacyDefPath := range customDefs {
+		legacyDefPaths = append(legacyDefPaths, legacyDefPath)
+	}
+	sort.Strings(legacyDefPaths)
+	for _, legacyDefPath := range legacyDefPaths {
+		filePath := path.Join("/etc/hana-firewall/", path.Base(legacyDefPath))
+		if err := ioutil.WriteFile(filePath, []byte(customDefs[legacyDefPath].ToText()), 0600); err != nil {
+			errorExit("Failed to create service definition file at \"%s\": %v", filePath, err)
+			return
+		}
+		fmt.Printf("Migrated custom service \"%s\" into \"%s\".\n", legacyDefPath, filePath)
+	}
+
+	// Carry over HANA instance numbers
+	report = append(migration.Report, report...)
+	globalParams.InstanceNumbers = model.UniqueSortedStrings(append(globalParams.InstanceNumbers, migration.InstanceNumbers...))
+	globalParams.SIDs = model.UniqueSortedStrings(append(globalParams.SIDs, migration.SIDs...))
+	if len(removedKeys) > 0 {
+		if err := ioutil.WriteFile(backupPath, globalContent, 0644); err != nil {
+			errorExit("Failed to back up %s - %v", model.HANAGlobalParametersFile, err)
+			return
+		}
+		fmt.Printf("Removed 1.x settings %s from %s, the original file is kept in %s.\n", strings.Join(removedKeys, " "), model.HANAGlobalParametersFile, backupPath)
+	}
+	globalParams.WriteInto(globalConf)
+	if err := ioutil.WriteFile(model.HANAGlobalParametersFile, []byte(globalConf.ToText()), 0644); err != nil {
+		errorExit("Failed to write /etc/sysconfig/hana-firewall - %v", err)
+		return
+	}
+	fmt.Printf("HANA instance numbers are now: %s\n", strings.Join(globalParams.InstanceNumbers, " "))
+
+	// Zones refer to the generated services, which carry a suffix if they are generated per peer or per instance.
+	globalParams, services = readConfig()
+	fw := generator.Firewalld{HANAGlobal: globalParams, HANAServices: services}
+	if generated, err := fw.GenerateConfig(); err != nil {
+		report = append(report, fmt.Sprintf("zones refer to the definition names, because the services cannot be generated - %v", err))
+	} else {
+		for zoneName, zone := range migration.Zones {
+			serviceNames := make([]string, 0, len(zone.Services))
+			for _, ref := range zone.Services {
+				if names := fw.GeneratedNamesOf(generated, ref.Name); len(names) > 0 {
+					serviceNames = append(serviceNames, names...)
+				} else {
+					serviceNames = append(serviceNames, ref.Name)
+				}
+			}
+			zone.Services = model.MakeFirewalldNameRefs(model.UniqueSortedStrings(serviceNames))
+			migration.Zones[zoneName] = zone
+		}
+	}
+
+	// Bind network interfaces to zones that allow the services
+	for zoneName, zone := range migration.Zones {
+		filePath := path.Join("/etc/firewalld/zones", zoneName+".xml")
+		if content, err := ioutil.ReadFile(filePath); err == nil && !model.IsGeneratedFile(content) {
+			report = append(report, fmt.Sprintf("%s: zone is not written because a zone of the same name already exists", filePath))
+			continue
+		}
+		if err := os.MkdirAll("/etc/firewalld/zones", 0750); err != nil {
+			errorExit("Failed to create directory /etc/firewalld/zones - %v", err)
+			return
+		}
+		if err := ioutil.WriteFile(filePath, []byte(zone.ToXML()), 0644); err != nil {
+			errorExit("Failed to write zone file \"%s\" - %v", filePath, err)
+			return
+		}
+		fmt.Printf("Generated zone in %s:\n%s", filePath, zone.String())
+	}
+
+	fmt.Println("--------------------------------------------------------------")
+	if len(report) > 0 {
+		fmt.Println("The following settings could not be carried over exactly, please review them:")
+		for _, line := range report {
+			fmt.Println("    " + line)
+		}
+		fmt.Println("--------------------------------------------------------------")
+	}
+	fmt.Println(`All done! Please run "hana-firewall generate-firewalld-services" and then restart firewalld service.
+If an interface is managed by NetworkManager, make sure its connection uses the generated zone as well.`)
+}
+
+// splitPorts returns port definitions separated by spaces or commas.
+func splitPorts(portsStr string) []string {
+	return strings.FieldsFunc(portsStr, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
+
+// createNewServiceFromFlags creates a new HANA service definition according to command line flags.
+func createNewServiceFromFlags(args []string) {
+	flags := flag.NewFlagSet("define-new-hana-service", flag.ExitOnError)
+	name := flags.String("name", "", "name of the new service")
+	tcpPortsStr := flags.String("tcp", "", "TCP ports separated by space or comma, placeholders are allowed")
+	udpPortsStr := flags.String("udp", "", "UDP ports separated by space or comma, placeholders are allowed")
+	shortDescription := flags.String("short-description", "", "human readable service name")
+	description := flags.String("description", "", "human readable description of the service")
+	force := flags.Bool("force", false, "overwrite an existing definition of the same name")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+		return
+	}
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		usageExit("Sorry, you have to give the new service a name.")
+		return
+	}
+	if err := model.ValidateDefinitionName(*name); err != nil {
+		usageExit("Sorry, %v.", err)
+		return
+	}
+	service := model.HANAServiceDefinition{
+		FileBaseName:     *name,
+		ShortDescription: strings.TrimSpace(*shortDescription),
+		Description:      strings.TrimSpace(*description),
+		TCP:              splitPorts(*tcpPortsStr),
+		UDP:              splitPorts(*udpPortsStr),
+	}
+	globalParams, _ := readConfig()
+	if err := globalParams.ValidateDefinition(&service); err != nil {
+		errorExit("The service definition is invalid: %v", err)
+		return
+	}
+	filePath := path.Join("/etc/hana-firewall/", *name)
+	if _, err := os.Stat(filePath); err == nil && !*force {
+		errorExit("Service definition \"%s\" already exists, use --force to overwrite it.", filePath)
+		return
+	}
+	serviceConf, _ := txtparser.ParseSysconfig("")
+	service.WriteInto(serviceConf)
+	serviceConf.AllValues[0].LeadingComments = []string{"# " + *name, ""}
+	if err := ioutil.WriteFile(filePath, []byte(serviceConf.ToText()), 0600); err != nil {
+		errorExit("Failed to create service definition file at \"%s\": %v", filePath, err)
+		return
+	}
+	fmt.Printf("Created service definition \"%s\".\n", filePath)
+}
+
+// definitionPath returns path to an existing HANA service definition file. If the file does not exist, the program will exit.
+func definitionPath(name string) string {
+	if strings.TrimSpace(name) == "" {
+		usageExit("Please specify the service definition name (file name under /etc/hana-firewall) with --name.")
+	}
+	if err := model.ValidateDefinitionName(name); err != nil {
+		usageExit("Sorry, %v.", err)
+	}
+	filePath := path.Join("/etc/hana-firewall/", name)
+	if info, err := os.Stat(filePath); err != nil || !info.Mode().IsRegular() {
+		if _, err := os.Stat(path.Join(loader.VendorDir, name)); err == nil {
+			errorExit("Service definition \"%s\" is shipped in %s, please override it by creating a definition or a drop-in in %s.", name, loader.VendorDir, loader.AdminDir)
+		}
+		errorExit("Service definition \"%s\" does not exist.", filePath)
+	}
+	return filePath
+}
+
+// readDefinition reads HANA service definition file. If an error occurs, the program will exit.
+func readDefinition(name string) (filePath string, def model.HANAServiceDefinition, conf *txtparser.Sysconfig) {
+	filePath = definitionPath(name)
+	conf, err := txtparser.ParseSysconfigFile(filePath, false)
+	if err != nil {
+		errorExit("Failed to read service definition file \"%s\": %v", filePath, err)
+		return
+	}
+	def = model.HANAServiceDefinition{FileBaseName: name}
+	def.ReadFrom(conf)
+	return
+}
+
+// printModifiedFiles prints the paths of firewalld configuration files modified by hana-firewall.
+func printModifiedFiles(modified []string) {
+	for _, filePath := range modified {
+		fmt.Printf("Updated firewalld configuration file \"%s\".\n", filePath)
+	}
+	if len(modified) > 0 {
+		fmt.Println("Please restart firewalld service (systemctl restart firewalld.service) to make the change effective.")
+	}
+}
+
+// EditService changes the ports of an existing HANA service definition according to command line flags.
+func EditService(args []string) {
+	flags := flag.NewFlagSet("edit-hana-service", flag.ExitOnError)
+	name := flags.String("name", "", "name of the service to edit")
+	tcpPortsStr := flags.String("tcp", "", "new TCP ports separated by space or comma, placeholders are allowed")
+	udpPortsStr := flags.String("udp", "", "new UDP ports separated by space or comma, placeholders are allowed")
+	shortDescription := flags.String("short-description", "", "new human readable service name")
+	description := flags.String("description", "", "new description of the service")
+	flags.Parse(args)
+	filePath, service, serviceConf := readDefinition(*name)
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "tcp":
+			service.TCP = splitPorts(*tcpPortsStr)
+		case "udp":
+			service.UDP = splitPorts(*udpPortsStr)
+		case "short-description":
+			service.ShortDescription = strings.TrimSpace(*shortDescription)
+		case "description":
+			service.Description = strings.TrimSpace(*description)
+		}
+	})
+	globalParams, _ := readConfig()
+	if err := globalParams.ValidateDefinition(&service); err != nil {
+		errorExit("The service definition is invalid: %v", err)
+		return
+	}
+	service.WriteInto(serviceConf)
+	if err := ioutil.WriteFile(filePath, []byte(serviceConf.ToText()), 0600); err != nil {
+		errorExit("Failed to write service definition file \"%s\": %v", filePath, err)
+		return
+	}
+	fmt.Printf("Updated service definition \"%s\":\n%s", filePath, serviceConf.ToText())
+	fmt.Println("Remember to run \"hana-firewall generate-firewalld-services\" to make use of the change.")
+}
+
+// RenameService renames an existing HANA service definition along with its generated firewalld service.
+func RenameService(args []string) {
+	flags := flag.NewFlagSet("rename-hana-service", flag.ExitOnError)
+	name := flags.String("name", "", "name of the service to rename")
+	newName := flags.String("new-name", "", "new name of the service")
+	flags.Parse(args)
+	filePath, service, _ := readDefinition(*name)
+	*newName = strings.TrimSpace(*newName)
+	if *newName == "" {
+		usageExit("Sorry, the new name may not be empty.")
+		return
+	}
+	if err := model.ValidateDefinitionName(*newName); err != nil {
+		usageExit("Sorry, %v.", err)
+		return
+	}
+	newFilePath := path.Join("/etc/hana-firewall/", *newName)
+	if _, err := os.Stat(newFilePath); err == nil {
+		errorExit("Service definition \"%s\" already exists, please choose a different name.", newFilePath)
+		return
+	}
+	globalParams, _ := readConfig()
+	if err := globalParams.ValidateDefinition(&service); err != nil {
+		errorExit("The service definition is invalid: %v", err)
+		return
+	}
+	dropInDir, newDropInDir := filePath+loader.DropInSuffix, newFilePath+loader.DropInSuffix
+	_, err := os.Stat(dropInDir)
+	hasDropIns := err == nil
+	if _, err := os.Stat(newDropInDir); err == nil && hasDropIns {
+		errorExit("Drop-in directory \"%s\" already exists, please move it away before renaming.", newDropInDir)
+		return
+	}
+	oldShortName := service.GetShortName()
+	service.FileBaseName = *newName
+	if err := os.Rename(filePath, newFilePath); err != nil {
+		errorExit("Failed to rename \"%s\" to \"%s\": %v", filePath, newFilePath, err)
+		return
+	}
+	fmt.Printf("Renamed service definition \"%s\" to \"%s\".\n", filePath, newFilePath)
+	// Drop-ins follow the definition, so that they keep applying to it
+	if hasDropIns {
+		if err := os.Rename(dropInDir, newDropInDir); err != nil {
+			errorExit("Failed to rename \"%s\" to \"%s\": %v", dropInDir, newDropInDir, err)
+			return
+		}
+		fmt.Printf("Renamed drop-in directory \"%s\" to \"%s\".\n", dropInDir, newDropInDir)
+	}
+	printVendorDefinition(*name)
+	fw := generator.Firewalld{HANAGlobal: globalParams}
+	modified, err := fw.RenameService("/etc/firewalld", oldShortName, service)
+	printModifiedFiles(modified)
+	if err != nil {
+		errorExit("Failed to rename firewalld service \"%s\" to \"%s\": %v", oldShortName, service.GetShortName(), err)
+		return
+	}
+}
+
+/*
+printVendorDefinition tells that the vendor definition of the name applies again, now that the definition in
+/etc/hana-firewall that overrode it is gone. It returns true if there is such a vendor definition.
+*/
+func printVendorDefinition(name string) bool {
+	vendorPath := path.Join(loader.VendorDir, name)
+	if _, err := os.Stat(vendorPath); err != nil {
+		return false
+	}
+	fmt.Printf("The shipped service definition \"%s\" applies again, run \"hana-firewall generate-firewalld-services\" to make use of it.\n", vendorPath)
+	return true
+}
+
+// DeleteService deletes an existing HANA service definition along with its generated firewalld service.
+func DeleteService(args []string) {
+	flags := flag.NewFlagSet("delete-hana-service", flag.ExitOnError)
+	name := flags.String("name", "", "name of the service to delete")
+	flags.Parse(args)
+	filePath, service, _ := readDefinition(*name)
+	if err := os.Remove(filePath); err != nil {
+		errorExit("Failed to delete \"%s\": %v", filePath, err)
+		return
+	}
+	fmt.Printf("Deleted service definition \"%s\".\n", filePath)
+	// Drop-ins would otherwise apply again to a new definition of the same name
+	dropInDir := filePath + loader.DropInSuffix
+	if _, err := os.Stat(dropInDir); err == nil {
+		if err := os.RemoveAll(dropInDir); err != nil {
+			errorExit("Failed to delete \"%s\": %v", dropInDir, err)
+			return
+		}
+		fmt.Printf("Deleted drop-in directory \"%s\".\n", dropInDir)
+	}
+	if printVendorDefinition(*name) {
+		// The firewalld service and its references remain in use by the vendor definition
+		return
+	}
+	fw := generator.Firewalld{}
+	modified, err := fw.DeleteService("/etc/firewalld", service.GetShortName(), "")
+	printModifiedFiles(modified)
+	if err != nil {
+		errorExit("Failed to delete firewalld service \"%s\": %v", service.GetShortName(), err)
+		return
+	}
+}
+
+// ShowDefinitions prints all HANA service definitions merged from all layers, and optionally the origin of each port.
+func ShowDefinitions(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	origin := flags.Bool("origin", false, "display the file that contributed each port")
+	flags.Parse(args)
+	_, definitions := readLayeredConfig()
+	for _, def := range definitions {
+		fmt.Printf("%s - %s (%s)\n", def.FileBaseName, def.ShortDescription, def.FilePath)
+		for _, dropIn := range def.DropIns {
+			fmt.Printf("    Drop-in %s\n", dropIn)
+		}
+		for _, protocol := range []struct {
+			name    string
+			ports   []string
+			origins map[string]string
+		}{{model.FirewalldProtocolTCP, def.TCP, def.TCPOrigins}, {model.FirewalldProtocolUDP, def.UDP, def.UDPOrigins}} {
+			for _, port := range protocol.ports {
+				if *origin {
+					fmt.Printf("    %s %s from %s\n", protocol.name, port, protocol.origins[port])
+				} else {
+					fmt.Printf("    %s %s\n", protocol.name, port)
+				}
+			}
+		}
+		fmt.Println("----------------------------------------------------------")
+	}
+}
+
+// definitionState tells whether the definition is generated into firewalld services, or why it is skipped.
+func definitionState(globalParams *model.HANAGlobalParameters, def *model.HANAServiceDefinition) string {
+	if ok, reason := globalParams.IsApplicable(def); !ok {
+		return "skipped - " + reason
+	}
+	return "generated"
+}
+
+// definitionProtocols returns the port definitions of the definition along with the file each of them comes from.
+func definitionProtocols(def *loader.Definition) []struct {
+	name    string
+	ports   []string
+	origins map[string]string
+} {
+	return []struct {
+		name    string
+		ports   []string
+		origins map[string]string
+	}{{model.FirewalldProtocolTCP, def.TCP, def.TCPOrigins}, {model.FirewalldProtocolUDP, def.UDP, def.UDPOrigins}}
+}
+
+/*
+ListDefinitions prints every HANA service definition with its file, state, descriptions, port definitions, and the port
+numbers that each port definition yields per instance number. The definitions may be filtered by name and by port.
+*/
+func ListDefinitions(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	service := flags.String("service", "", "only list the definitions whose name contains the text")
+	port := flags.Int("port", 0, "only list the definitions that open the port number")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	globalParams, definitions := readLayeredConfig()
+	if len(globalParams.InstanceNumbers) == 0 {
+		reportWarning("No HANA instance numbers are configured, port numbers cannot be calculated.")
+	}
+	listed := 0
+	for _, def := range definitions {
+		nameFilter := strings.ToLower(*service)
+		if !strings.Contains(strings.ToLower(def.FileBaseName), nameFilter) && !strings.Contains(def.GetShortName(), nameFilter) {
+			continue
+		}
+		lines := make([]string, 0, len(def.TCP)+len(def.UDP))
+		opensPort := false
+		for _, protocol := range definitionProtocols(&def) {
+			for _, portDefinition := range protocol.ports {
+				expansions, err := globalParams.ExplainPortDefinition(&def.HANAServiceDefinition, portDefinition)
+				if err != nil {
+					lines = append(lines, fmt.Sprintf("    %s %s - %v", protocol.name, portDefinition, err))
+					continue
+				}
+				resolved := make([]string, 0, len(expansions))
+				for _, expansion := range expansions {
+					instance := expansion.InstanceNumber
+					if expansion.Tenant != "" {
+						instance += " tenant " + expansion.Tenant
+					}
+					resolved = append(resolved, fmt.Sprintf("%s (%s)", model.FormatPortRanges(expansion.Ports), instance))
+					opensPort = opensPort || expansion.Contains(*port)
+				}
+				lines = append(lines, fmt.Sprintf("    %s %s = %s", protocol.name, portDefinition, strings.Join(resolved, ", ")))
+			}
+		}
+		if *port != 0 && !opensPort {
+			continue
+		}
+		fmt.Printf("%s (%s) - %s\n", def.FileBaseName, def.GetShortName(), definitionState(&globalParams, &def.HANAServiceDefinition))
+		fmt.Printf("    File: %s\n", def.FilePath)
+		for _, dropIn := range def.DropIns {
+			fmt.Printf("    Drop-in: %s\n", dropIn)
+		}
+		fmt.Printf("    Name: %s\n", def.ShortDescription)
+		if def.Description != "" {
+			fmt.Printf("    Description: %s\n", def.Description)
+		}
+		fmt.Println(strings.Join(lines, "\n"))
+		fmt.Println("----------------------------------------------------------")
+		listed++
+	}
+	if listed == 0 {
+		exitWithStatus(ExitFailure, "No service definition matches.")
+	}
+}
+
+/*
+WhichPort explains which HANA service definitions open the port, which may be followed by /tcp or /udp, and how their
+port definitions yield the port. If there are no instance numbers, all instance numbers are tried. The program exits
+with ExitFailure if no definition opens the port.
+*/
+func WhichPort(args []string) {
+	flags := flag.NewFlagSet("which-port", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usageExit("Please specify one port number, such as 30015 or 30015/tcp.")
+	}
+	portStr, wantProtocol := flags.Arg(0), ""
+	if slash := strings.IndexRune(portStr, '/'); slash > 0 {
+		portStr, wantProtocol = portStr[:slash], strings.ToLower(portStr[slash+1:])
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 || (wantProtocol != "" && wantProtocol != model.FirewalldProtocolTCP && wantProtocol != model.FirewalldProtocolUDP) {
+		usageExit("\"%s\" is not a port number, such as 30015 or 30015/tcp.", flags.Arg(0))
+	}
+	globalParams, definitions := readLayeredConfig()
+	if len(globalParams.InstanceNumbers) == 0 && len(globalParams.Systems) > 0 {
+		globalParams.InstanceNumbers = globalParams.DiscoveredInstanceNumbers()
+		fmt.Printf("No HANA instance numbers are configured, trying those of the discovered HANA systems: %s\n", strings.Join(globalParams.InstanceNumbers, " "))
+	} else if len(globalParams.InstanceNumbers) == 0 {
+		fmt.Println("No HANA instance numbers are configured or discovered, trying all instance numbers.")
+		for instNum := 0; instNum < 100; instNum++ {
+			globalParams.InstanceNumbers = append(globalParams.InstanceNumbers, fmt.Sprintf("%02d", instNum))
+		}
+	}
+	found := 0
+	for _, def := range definitions {
+		for _, protocol := range definitionProtocols(&def) {
+			if wantProtocol != "" && protocol.name != wantProtocol {
+				continue
+			}
+			for _, portDefinition := range protocol.ports {
+				expansions, err := globalParams.ExplainPortDefinition(&def.HANAServiceDefinition, portDefinition)
+				if err != nil {
+					continue
+				}
+				matches := make([]model.PortExpansion, 0, 1)
+				for _, expansion := range expansions {
+					if expansion.Contains(port) {
+						matches = append(matches, expansion)
+					}
+				}
+				if len(matches) == 0 {
+					continue
+				}
+				fmt.Printf("%d/%s: %s (%s) - %s\n", port, protocol.name, def.FileBaseName, def.GetShortName(), definitionState(&globalParams, &def.HANAServiceDefinition))
+				fmt.Printf("    %s=\"%s\" in %s\n", strings.ToUpper(protocol.name), portDefinition, protocol.origins[portDefinition])
+				if !strings.Contains(portDefinition, "__") {
+					fmt.Println("    The port definition does not depend on the instance number.")
+					matches = nil
+				}
+				for _, match := range matches {
+					explanation := fmt.Sprintf("    Instance number %s", match.InstanceNumber)
+					if match.Tenant != "" {
+						explanation += fmt.Sprintf(" reads \"%s\" from HANA configuration of tenant %s, which", match.Definition, match.Tenant)
+					} else if match.Definition != portDefinition {
+						explanation += fmt.Sprintf(" reads \"%s\" from HANA configuration, which", match.Definition)
+					}
+					if def.Replication && strings.Contains(match.Definition, model.InstanceNumberPlusOneSubstitutionMagic) {
+						explanation += " with the replication port offset"
+					}
+					fmt.Printf("%s yields %s\n", explanation, model.FormatPortRanges(match.Ports))
+				}
+				found++
+			}
+		}
+	}
+	if found == 0 {
+		exitWithStatus(ExitFailure, "No service definition opens port %s.", flags.Arg(0))
+	}
+}
+
+// splitLabels turns comma-separated KEY=VALUE pairs into a map, the program exits if a pair does not have a value.
+func splitLabels(labelsStr string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range splitPorts(labelsStr) {
+		fields := strings.SplitN(pair, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			usageExit("\"%s\" is not a label written as KEY=VALUE.", pair)
+		}
+		labels[fields[0]] = fields[1]
+	}
+	return labels
+}
+
+/*
+Export renders the firewalld services that generate-firewalld-services would generate in the format of another
+firewall, and prints them or writes them into the output directory.
+*/
+func Export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "export format: "+strings.Join(generator.ExportFormats, ", "))
+	cidrs := flags.String("cidr", "", "CIDRs of the HANA hosts, separated by comma")
+	namespace := flags.String("namespace", "", "namespace of Kubernetes policies")
+	podSelector := flags.String("pod-selector", "", "labels of client pods written as KEY=VALUE, separated by comma")
+	sourceCIDRs := flags.String("source-cidr", "", "CIDRs of clients that cloud rules allow, separated by comma")
+	priority := flags.Int("priority", generator.DefaultExportPriority, "priority of the first Azure rule, or of all GCP rules")
+	namePrefix := flags.String("name-prefix", generator.PolicyName+"-", "prefix of cloud rule names")
+	provider := flags.String("provider", "", "cloud provider of the terraform format: "+strings.Join(generator.CloudProviders, ", "))
+	maxRules := flags.Int("max-rules", 0, "maximum number of cloud rules, instead of the limit of the provider")
+	split := flags.Bool("split", false, "render one file per service")
+	output := flags.String("output", "", "directory to write the files into, instead of printing them")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	if *format == "" {
+		usageExit("Please specify --format, one of: %s.", strings.Join(generator.ExportFormats, ", "))
+	}
+	opts := generator.ExportOptions{
+		CIDRs:       splitPorts(*cidrs),
+		Namespace:   *namespace,
+		PodSelector: splitLabels(*podSelector),
+		Split:       *split,
+		SourceCIDRs: splitPorts(*sourceCIDRs),
+		Priority:    priority,
+		NamePrefix:  *namePrefix,
+		Provider:    *provider,
+		MaxRules:    *maxRules,
+	}
+	globalParams, services := readConfig()
+	fw := generator.Firewalld{HANAGlobal: globalParams, HANAServices: services}
+	firewalldServices, err := fw.GenerateConfig()
+	if err != nil {
+		errorExit("Failed to generate firewall config - %v", err)
+	}
+	if len(firewalldServices) == 0 {
+		errorExit("Failed to export firewall config - %v", generator.ErrNoServices)
+	}
+	if *format == "ansible" || *format == "salt" {
+		// Configuration management takes over zone assignments and policy along with the services
+		if opts.Zones, err = generator.ServiceZones([]string{generator.FirewalldVendorDir, "/etc/firewalld"}, firewalldServices); err != nil {
+			errorExit("Failed to read firewalld zones - %v", err)
+		}
+		if policy, found := fw.GeneratePolicies(firewalldServices)[generator.PolicyName]; found {
+			opts.Policy = &policy
+		}
+		opts.Firewalld = &fw
+	}
+	files, warnings, err := generator.Export(*format, firewalldServices, opts)
+	if err != nil {
+		errorExit("Failed to export firewall config - %v", err)
+	}
+	for _, warning := range warnings {
+		reportWarning("%s", warning)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if *output == "" && len(names) > 1 && strings.HasSuffix(names[0], ".json") {
+		// Split JSON files are printed as a single array, so that the output remains valid JSON
+		contents := make([]json.RawMessage, 0, len(names))
+		for _, name := range names {
+			contents = append(contents, json.RawMessage(files[name]))
+		}
+		out, err := json.MarshalIndent(contents, "", "  ")
+		if err != nil {
+			errorExit("Failed to export firewall config - %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	if *output == "" {
+		for i, name := range names {
+			if i > 0 && (strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml")) {
+				fmt.Println("---")
+			}
+			fmt.Print(files[name])
+		}
+		return
+	}
+	if err := os.MkdirAll(*output, 0755); err != nil {
+		errorExit("Failed to export firewall config - %v", &generator.WriteError{Path: *output, Err: err})
+	}
+	for _, name := range names {
+		filePath := path.Join(*output, name)
+		if err := ioutil.WriteFile(filePath, []byte(files[name]), 0644); err != nil {
+			errorExit("Failed to export firewall config - %v", &generator.WriteError{Path: filePath, Err: err})
+		}
+		fmt.Printf("Written %s\n", filePath)
+	}
+}
+
+/*
+Validate reads /etc/sysconfig/hana-firewall and all HANA service definitions in strict mode, and validates the port
+definitions of each service. All problems are reported before the program exits with the status of the first problem.
+*/
+func Validate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	problems := make([]error, 0, 0)
+	globalConf, err := txtparser.ParseSysconfigFileStrict(model.HANAGlobalParametersFile)
+	if err != nil && !os.IsNotExist(err) {
+		problems = append(problems, err)
+	}
+	if globalConf == nil {
+		globalConf, _ = txtparser.ParseSysconfig("")
+	}
+	if keyErrs := model.HANAGlobalParametersSchema.CheckKeys(model.HANAGlobalParametersFile, globalConf); len(keyErrs) > 0 {
+		problems = append(problems, keyErrs)
+	}
+	globalParams := model.HANAGlobalParameters{}
+	globalParams.ReadFrom(globalConf)
+	if globalParams.ReplicationEnabled() {
+		if _, err := globalParams.GetAdjacentReplicationPeers(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if globalParams.DestinationsEnabled() {
+		systems, _ := discovery.DiscoverSystems(SAPRoot)
+		// An automatic destination whose virtual host cannot be resolved is reported by GetInstanceDestinations
+		discovery.ResolveVirtualHosts(systems, discovery.DefaultResolveTimeout)
+		globalParams.UseDiscoveredSystems(systems)
+		if _, err := globalParams.GetInstanceDestinations(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if _, err := globalParams.RejectsDefinitionSymlinks(); err != nil {
+		problems = append(problems, err)
+	}
+	defLoader := loader.NewLoaderFor(&globalParams)
+	defLoader.Strict = true
+	definitions, report := defLoader.Load()
+	for _, fileErr := range report.Errors {
+		problems = append(problems, fileErr)
+	}
+	for _, def := range definitions {
+		if err := globalParams.ValidateDefinition(&def.HANAServiceDefinition); err != nil {
+			problems = append(problems, &loader.FileError{Path: def.FilePath, Err: err})
+		}
+	}
+	skippedPaths := make([]string, 0, len(report.Skipped))
+	for skippedPath := range report.Skipped {
+		skippedPaths = append(skippedPaths, skippedPath)
+	}
+	sort.Strings(skippedPaths)
+	for _, skippedPath := range skippedPaths {
+		reportWarning("%s: skipped - %s", skippedPath, report.Skipped[skippedPath])
+	}
+	if len(problems) == 0 {
+		fmt.Printf("The configuration and %d service definitions are valid.\n", len(definitions))
+		return
+	}
+	status := ExitOK
+	// Problems that do not name a file are found in the global configuration
+	problemFiles := make(map[string]struct{})
+	for _, problem := range problems {
+		if problemStatus := reportError(problem); status == ExitOK {
+			status = problemStatus
+		}
+		diag := diagnostic{}
+		diag.describeError(problem)
+		if diag.File == "" {
+			diag.File = model.HANAGlobalParametersFile
+		}
+		problemFiles[diag.File] = struct{}{}
+	}
+	exitWithStatus(status, "Found problems in %d file(s).", len(problemFiles))
+}
+
+/*
+Watch keeps running and regenerates firewalld services whenever the configuration, service definitions, installed HANA
+systems, or their custom configuration and instance profiles change, and then reloads firewalld. Errors do not stop the
+watch, they are reported instead. SIGHUP makes it re-read the configuration right away, and SIGTERM or SIGINT stops it.
+*/
+func Watch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	debounce := flags.Duration("debounce", 2*time.Second, "wait for a burst of changes to settle for this long")
+	force := flags.Bool("force", false, "overwrite and remove generated files even if they were modified by hand")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	lastFingerprint := ""
+	if content, err := ioutil.ReadFile(FingerprintFile); err == nil {
+		lastFingerprint = string(content)
+	}
+	w := watcher.Watcher{Targets: watchTargets(nil), Debounce: *debounce}
+	apply := func() {
+		globalParams, definitions, err := loadLayeredConfig()
+		if err != nil {
+			reportError(fmt.Errorf("Failed to read HANA firewall configuration - %w", err))
+			return
+		}
+		// Watch the configuration of newly discovered HANA systems too
+		w.Targets = watchTargets(globalParams.Systems)
+		fw := generator.Firewalld{HANAGlobal: globalParams, Force: *force}
+		for _, def := range definitions {
+			fw.HANAServices = append(fw.HANAServices, def.HANAServiceDefinition)
+		}
+		applied, err := fw.Apply("/etc/firewalld", lastFingerprint)
+		if err != nil {
+			reportError(fmt.Errorf("Failed to generate or write firewall config - %w", err))
+			return
+		} else if !applied.Changed {
+			return
+		}
+		printStaleReferences(&fw, applied.Services)
+		reloaded, err := reloadAndRemember(applied)
+		if !reloaded {
+			reportError(err)
+			return
+		}
+		lastFingerprint = applied.Fingerprint
+		if err != nil {
+			reportWarning("%v", err)
+		}
+		reportInfo("Generated %d services and %d policies, and reloaded firewalld.", len(applied.Services), len(applied.Policies))
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	apply()
+	reportInfo("Watching for changes in %s, %s, %s, %s, and the configuration of discovered HANA systems.", model.HANAGlobalParametersFile, loader.VendorDir, loader.AdminDir, SAPRoot)
+	if err := w.Run(apply, signals); err != nil {
+		errorExit("Failed to watch for changes - %v", err)
+	}
+	reportInfo("Stopped watching for changes.")
+}
+
+/*
+watchTargets returns the files and directories that the configuration is read from: the global configuration, the
+service definitions, the HANA installations, as well as the custom INI configuration and the instance profiles of each
+discovered HANA system.
+*/
+func watchTargets(systems []model.HANASystem) []watcher.Target {
+	targets := []watcher.Target{
+		{Path: model.HANAGlobalParametersFile},
+		{Path: loader.VendorDir, Depth: 1},
+		{Path: loader.AdminDir, Depth: 1},
+		{Path: SAPRoot, Depth: 2},
+	}
+	for _, system := range systems {
+		for _, configDir := range discovery.ConfigDirs(SAPRoot, HANASharedRoot, system.SID) {
+			targets = append(targets, watcher.Target{Path: configDir, Depth: 1})
+		}
+		// The instance profile is sapprofile.ini in the host directories of the instance
+		targets = append(targets, watcher.Target{Path: path.Join(SAPRoot, system.SID, "HDB"+system.InstanceNumber), Depth: 1})
+	}
+	return targets
+}
+
+/*
+Audit compares the listening sockets of this host with the ports of generated firewalld services, and prints the gaps
+per HANA instance. The program exits with ExitFailure if HANA listens on a port that no service opens.
+*/
+func Audit(args []string) {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageExit("Unexpected argument \"%s\", please see \"hana-firewall help\".", flags.Arg(0))
+	}
+	globalParams, services := readConfig()
+	fw := generator.Firewalld{HANAGlobal: globalParams, HANAServices: services}
+	expected, err := audit.ExpectedPorts(&fw)
+	if err != nil {
+		errorExit("Failed to generate firewall config - %v", err)
+	}
+	sockets, err := audit.ReadListeningSockets("/proc")
+	if err != nil {
+		errorExit("Failed to read listening sockets - %v", err)
+	}
+	report := audit.Compare(sockets, expected)
+	if !report.HasGaps() {
+		fmt.Printf("All %d ports of generated services are in use, and all HANA ports are opened.\n", len(expected))
+		return
+	}
+	for _, instanceNumber := range report.InstanceNumbers() {
+		if instanceNumber == "" {
+			fmt.Println("Not specific to an instance:")
+		} else {
+			fmt.Printf("Instance %s:\n", instanceNumber)
+		}
+		if uncovered := report.Uncovered[instanceNumber]; len(uncovered) > 0 {
+			fmt.Println("    Listening, but not opened by any generated service:")
+			for _, sock := range uncovered {
+				fmt.Printf("        %s\n", sock.String())
+			}
+		}
+		if unused := report.Unused[instanceNumber]; len(unused) > 0 {
+			fmt.Println("    Opened by generated services, but nothing listens:")
+			for _, port := range unused {
+				fmt.Printf("        %s %d in %s\n", port.Protocol, port.Port, strings.Join(port.Services, ", "))
+			}
+		}
+	}
+	if len(report.Uncovered) > 0 {
+		os.Exit(ExitFailure)
+	}
+}
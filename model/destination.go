@@ -0,0 +1,161 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// InstanceDestinationAuto is the destination that is taken from the SAPLOCALHOST of the instance profile.
+const InstanceDestinationAuto = "auto"
+
+/*
+parseDestinationAddresses turns comma-separated IPv4 and IPv6 addresses, each of which may carry a network mask, into a
+firewalld destination. There may be at most one address of each family.
+*/
+func parseDestinationAddresses(spec, addrs string) (dest FirewalldDestination, err error) {
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			if ip, _, err = net.ParseCIDR(addr); err != nil {
+				return dest, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: fmt.Sprintf("\"%s\" is not an IP address", addr)}
+			}
+		}
+		family := &dest.IPv6
+		if ip.To4() != nil {
+			family = &dest.IPv4
+		}
+		if *family != "" {
+			return dest, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: "there may only be one IPv4 and one IPv6 address"}
+		}
+		*family = addr
+	}
+	return
+}
+
+/*
+systemDestination returns the destination made of the first IPv4 and first IPv6 address that the virtual host name of
+the HANA system resolves to.
+*/
+func systemDestination(system *HANASystem) (dest FirewalldDestination, found bool) {
+	for _, addr := range system.VirtualAddresses {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		} else if ip.To4() != nil && dest.IPv4 == "" {
+			dest.IPv4 = addr
+		} else if ip.To4() == nil && dest.IPv6 == "" {
+			dest.IPv6 = addr
+		}
+	}
+	return dest, dest.IPv4 != "" || dest.IPv6 != ""
+}
+
+// DestinationsEnabled returns true if instance destinations are configured.
+func (global *HANAGlobalParameters) DestinationsEnabled() bool {
+	return len(global.InstanceDestinations) > 0
+}
+
+/*
+GetInstanceDestinations returns instance number vs the destination addresses of the instance. An entry of
+HANA_INSTANCE_DESTINATIONS is written as NN=ADDRESS[,ADDRESS] to give the addresses explicitly, or NN=auto to use the
+addresses of SAPLOCALHOST in the instance profile. A lone "auto" does the same for all discovered systems that have
+SAPLOCALHOST, and explicit entries take precedence over it.
+*/
+func (global *HANAGlobalParameters) GetInstanceDestinations() (ret map[string]FirewalldDestination, err error) {
+	ret = make(map[string]FirewalldDestination)
+	explicit := make(map[string]FirewalldDestination)
+	for _, spec := range global.InstanceDestinations {
+		if strings.ToLower(spec) == InstanceDestinationAuto {
+			for i := range global.Systems {
+				if dest, found := systemDestination(&global.Systems[i]); found {
+					ret[global.Systems[i].InstanceNumber] = dest
+				}
+			}
+			continue
+		}
+		fields := strings.SplitN(spec, "=", 2)
+		if len(fields) != 2 || len(fields[0]) != 2 || strings.Trim(fields[0], "0123456789") != "" {
+			return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: "the destination must be written as NN=ADDRESS[,ADDRESS] or NN=auto"}
+		}
+		instNum := fields[0]
+		if _, exists := explicit[instNum]; exists {
+			return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: "the instance number is given more than once"}
+		}
+		if strings.ToLower(fields[1]) == InstanceDestinationAuto {
+			system := global.GetSystem(instNum)
+			if system == nil {
+				return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: "the HANA system of the instance number is not found"}
+			}
+			dest, found := systemDestination(system)
+			if !found {
+				return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalInstanceDestinationsKey, Value: spec, Message: "the instance profile does not have a SAPLOCALHOST that resolves to an IP address"}
+			}
+			explicit[instNum] = dest
+			continue
+		}
+		if explicit[instNum], err = parseDestinationAddresses(spec, fields[1]); err != nil {
+			return nil, err
+		}
+	}
+	for instNum, dest := range explicit {
+		ret[instNum] = dest
+	}
+	return
+}
+
+// DependsOnInstance returns true if any port definition of the service definition uses an instance number placeholder.
+func (def *HANAServiceDefinition) DependsOnInstance() bool {
+	for _, portDefinition := range append(append([]string{}, def.TCP...), def.UDP...) {
+		if strings.Contains(portDefinition, InstanceNumberSubstitutionMagic) || strings.Contains(portDefinition, InstanceNumberPlusOneSubstitutionMagic) ||
+			strings.Contains(portDefinition, INISubstitutionMagic) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+MakeInstanceServices generates one firewalld service per instance number that has destination addresses, and the
+service carries only the ports of that instance along with a destination element. The ports of the remaining instances
+make up a service without destination, of the usual short name. The returned map is service short name vs service.
+*/
+func (global *HANAGlobalParameters) MakeInstanceServices(def *HANAServiceDefinition) (ret map[string]FirewalldService, err error) {
+	destinations, err := global.GetInstanceDestinations()
+	if err != nil {
+		return
+	}
+	ret = make(map[string]FirewalldService)
+	unrestricted := *global
+	unrestricted.InstanceNumbers = make([]string, 0, len(global.InstanceNumbers))
+	for _, instNum := range global.InstanceNumbers {
+		dest, found := destinations[instNum]
+		if !found {
+			unrestricted.InstanceNumbers = append(unrestricted.InstanceNumbers, instNum)
+			continue
+		}
+		single := *global
+		single.InstanceNumbers = []string{instNum}
+		shortName, svc, err := single.MakeFirewalldService(def)
+		if err != nil {
+			return nil, err
+		}
+		svc.ShortName = fmt.Sprintf("%s (instance %s)", svc.ShortName, instNum)
+		svc.Destination = &FirewalldDestination{IPv4: dest.IPv4, IPv6: dest.IPv6}
+		ret[InstanceServiceShortName(shortName, instNum)] = svc
+	}
+	if len(unrestricted.InstanceNumbers) > 0 {
+		shortName, svc, err := unrestricted.MakeFirewalldService(def)
+		if err != nil {
+			return nil, err
+		}
+		ret[shortName] = svc
+	}
+	return
+}
+
+// InstanceServiceShortName returns the short name of the firewalld service generated for a single instance number.
+func InstanceServiceShortName(definitionShortName, instNum string) string {
+	return definitionShortName + "-" + instNum
+}
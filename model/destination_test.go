@@ -0,0 +1,76 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHANAGlobalParameters_GetInstanceDestinations(t *testing.T) {
+	global := HANAGlobalParameters{
+		InstanceDestinations: []string{"auto", "00=10.0.0.5,fd00::5", "20=auto"},
+		Systems: []HANASystem{
+			{SID: "PRD", InstanceNumber: "00", VirtualHost: "prdvirt", VirtualAddresses: []string{"10.0.0.9"}},
+			{SID: "QAS", InstanceNumber: "10", VirtualHost: "qasvirt", VirtualAddresses: []string{"fd00::10", "10.0.0.10", "10.0.0.11"}},
+			{SID: "DEV", InstanceNumber: "20", VirtualHost: "devvirt", VirtualAddresses: []string{"10.0.0.20"}},
+			{SID: "TST", InstanceNumber: "30"},
+		},
+	}
+	destinations, err := global.GetInstanceDestinations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Explicit addresses win over the discovered ones
+	match := map[string]FirewalldDestination{
+		"00": {IPv4: "10.0.0.5", IPv6: "fd00::5"},
+		"10": {IPv4: "10.0.0.10", IPv6: "fd00::10"},
+		"20": {IPv4: "10.0.0.20"},
+	}
+	if !reflect.DeepEqual(destinations, match) {
+		t.Fatalf("%+v", destinations)
+	}
+	for _, invalid := range [][]string{
+		{"00"},
+		{"0=10.0.0.5"},
+		{"00=10.0.0.5", "00=10.0.0.6"},
+		{"00=10.0.0.5,10.0.0.6"},
+		{"00=prdvirt"},
+		{"30=auto"},
+		{"40=auto"},
+	} {
+		global.InstanceDestinations = invalid
+		if _, err := global.GetInstanceDestinations(); err == nil {
+			t.Fatal(invalid)
+		}
+	}
+	global.InstanceDestinations = []string{"00=10.0.0.0/24"}
+	if destinations, err := global.GetInstanceDestinations(); err != nil || destinations["00"].IPv4 != "10.0.0.0/24" {
+		t.Fatal(destinations, err)
+	}
+}
+
+func TestHANAGlobalParameters_MakeInstanceServices(t *testing.T) {
+	global := HANAGlobalParameters{InstanceNumbers: []string{"00", "01"}, InstanceDestinations: []string{"01=10.0.0.1,fd00::1"}}
+	if !definition.DependsOnInstance() || (&HANAServiceDefinition{TCP: []string{"1128"}}).DependsOnInstance() {
+		t.Fatal("wrong dependency on instance")
+	}
+	services, err := global.MakeInstanceServices(&definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrestricted, restricted := services["database-client"], services["database-client-01"]
+	if len(services) != 2 || unrestricted.Destination != nil || restricted.Destination == nil {
+		t.Fatalf("%+v", services)
+	}
+	if restricted.ShortName != "database-client (instance 01)" || restricted.Ports[1].Port != 1012 || unrestricted.Ports[1].Port != 1002 {
+		t.Fatalf("%+v", services)
+	}
+	xml := restricted.ToXML()
+	if !strings.Contains(xml, `<destination ipv4="10.0.0.1" ipv6="fd00::1"></destination>`) || strings.Contains(unrestricted.ToXML(), "destination") {
+		t.Fatal(xml)
+	}
+	// The destination survives a round trip through XML
+	if parsed, err := ParseFirewalldServiceXML([]byte(xml)); err != nil || !reflect.DeepEqual(parsed.Destination, restricted.Destination) {
+		t.Fatal(parsed, err)
+	}
+}
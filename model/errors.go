@@ -0,0 +1,31 @@
+package model
+
+import "fmt"
+
+// ValidationError tells that a value in HANA firewall configuration or service definition is not acceptable.
+type ValidationError struct {
+	Source  string // Source is the name of service definition or the configuration that carries the value.
+	Key     string // Key is the setting that carries the value, it may be empty.
+	Value   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	source := e.Source
+	if e.Key != "" {
+		source = fmt.Sprintf("%s (%s)", e.Source, e.Key)
+	}
+	if source == "" {
+		return fmt.Sprintf("invalid value \"%s\" - %s", e.Value, e.Message)
+	}
+	return fmt.Sprintf("%s: invalid value \"%s\" - %s", source, e.Value, e.Message)
+}
+
+// setErrorSource fills in the source and key of a validation error that does not have them yet.
+func setErrorSource(err error, source, key string) error {
+	if validationErr, ok := err.(*ValidationError); ok && validationErr.Source == "" {
+		validationErr.Source = source
+		validationErr.Key = key
+	}
+	return err
+}
@@ -4,32 +4,207 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"strconv"
+	"strings"
 )
 
 const (
 	FirewalldProtocolTCP = "tcp"
 	FirewalldProtocolUDP = "udp"
+
+	/*
+		GeneratedFileMarker is placed in an XML comment at the top of every file generated by hana-firewall. Only files
+		that carry the marker are considered to be owned by hana-firewall, hence only those may be overwritten or pruned.
+	*/
+	GeneratedFileMarker = "Generated by hana-firewall, manual changes will be lost."
 )
 
-// FirewalldService defines a service with its name, description, and ports.
+// xmlDocument serialises the element into a complete XML document that includes the XML header and ownership marker.
+func xmlDocument(elem interface{}) string {
+	out, err := xml.MarshalIndent(elem, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	return xml.Header + "<!-- " + GeneratedFileMarker + " -->\n" + string(out)
+}
+
+// IsGeneratedFile returns true if the file content carries the ownership marker of hana-firewall.
+func IsGeneratedFile(content []byte) bool {
+	return bytes.Contains(content, []byte(GeneratedFileMarker))
+}
+
+/*
+IsLegacyGeneratedFile returns true if the file content is a service XML written by hana-firewall versions that did not
+place the ownership marker. Such a file is recognised by the exact serialisation those versions used, and by the short
+name of the service being the file name without the .xml suffix.
+*/
+func IsLegacyGeneratedFile(fileName string, content []byte) bool {
+	var legacy struct {
+		XMLName     struct{}        `xml:"service"`
+		ShortName   string          `xml:"short"`
+		Description string          `xml:"description"`
+		Ports       []FirewalldPort `xml:"port"`
+	}
+	if IsGeneratedFile(content) || xml.Unmarshal(content, &legacy) != nil || legacy.ShortName != strings.TrimSuffix(fileName, ".xml") {
+		return false
+	}
+	out, err := xml.MarshalIndent(legacy, "", "    ")
+	return err == nil && xml.Header+string(out) == strings.TrimSpace(string(content))
+}
+
+// FirewalldService defines a service with its name, description, ports, and optionally the destination addresses.
 type FirewalldService struct {
-	ShortName   string          `xml:"short"`
-	Description string          `xml:"description"`
-	Ports       []FirewalldPort `xml:"port"`
+	ShortName   string                `xml:"short"`
+	Description string                `xml:"description"`
+	Ports       []FirewalldPort       `xml:"port"`
+	Destination *FirewalldDestination `xml:"destination,omitempty"`
+}
+
+// FirewalldDestination restricts a service to traffic destined to an IPv4 address, an IPv6 address, or both.
+type FirewalldDestination struct {
+	IPv4 string `xml:"ipv4,attr,omitempty"`
+	IPv6 string `xml:"ipv6,attr,omitempty"`
+}
+
+// String returns the destination addresses separated by comma.
+func (dest *FirewalldDestination) String() string {
+	addrs := make([]string, 0, 2)
+	for _, addr := range []string{dest.IPv4, dest.IPv6} {
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return strings.Join(addrs, ",")
+}
+
+/*
+xmlElement returns the service definition wrapped in the root element of firewalld service XML. Consecutive ports of the
+same protocol are folded into a single port range, such as port="51000-51500", which firewalld understands natively.
+*/
+func (svc *FirewalldService) xmlElement() interface{} {
+	type xmlPort struct {
+		Port     string `xml:"port,attr"`
+		Protocol string `xml:"protocol,attr"`
+	}
+	protocols := make([]string, 0, 2)
+	protocolPorts := make(map[string][]int)
+	for _, port := range svc.Ports {
+		if _, seen := protocolPorts[port.Protocol]; !seen {
+			protocols = append(protocols, port.Protocol)
+		}
+		protocolPorts[port.Protocol] = append(protocolPorts[port.Protocol], port.Port)
+	}
+	ports := make([]xmlPort, 0, len(svc.Ports))
+	for _, protocol := range protocols {
+		for _, portRange := range FoldPortRanges(protocolPorts[protocol]) {
+			ports = append(ports, xmlPort{Port: portRange.String(), Protocol: protocol})
+		}
+	}
+	return struct {
+		XMLName     struct{}              `xml:"service"` // the name of root element has to be "service"
+		ShortName   string                `xml:"short"`
+		Description string                `xml:"description"`
+		Ports       []xmlPort             `xml:"port"`
+		Destination *FirewalldDestination `xml:"destination,omitempty"`
+	}{ShortName: svc.ShortName, Description: svc.Description, Ports: ports, Destination: svc.Destination}
 }
 
 // ToXML serialised service definition into a complete XML document that includes the XML header.
 func (svc *FirewalldService) ToXML() string {
-	tmp := struct {
-		XMLName struct{} `xml:"service"` // the name of root element has to be "service"
-		*FirewalldService
-	}{FirewalldService: svc}
+	return xmlDocument(svc.xmlElement())
+}
 
-	out, err := xml.MarshalIndent(tmp, "", "    ")
-	if err != nil {
-		panic(err)
+// ToXMLWithProvenance serialises service definition into a complete XML document that includes the provenance comment.
+func (svc *FirewalldService) ToXMLWithProvenance(prov Provenance) string {
+	return xmlDocumentWithProvenance(svc.xmlElement(), prov)
+}
+
+/*
+ParseFirewalldServiceXML reads a firewalld service definition written in XML. Port ranges such as "30040-30099" are
+expanded into individual ports. A service definition can only express TCP and UDP ports, hence elements that cannot be
+expressed, such as ports of other protocols, protocol, source port, helper module, and include elements, are named in a
+ValidationError rather than dropped silently.
+*/
+func ParseFirewalldServiceXML(content []byte) (svc FirewalldService, err error) {
+	type xmlPort struct {
+		Port     string `xml:"port,attr"`
+		Protocol string `xml:"protocol,attr"`
+	}
+	var raw struct {
+		ShortName   string                `xml:"short"`
+		Description string                `xml:"description"`
+		Ports       []xmlPort             `xml:"port"`
+		Destination *FirewalldDestination `xml:"destination"`
+		Protocols   []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"protocol"`
+		SourcePorts []xmlPort `xml:"source-port"`
+		Modules     []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"module"`
+		Helpers []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"helper"`
+		Includes []struct {
+			Service string `xml:"service,attr"`
+		} `xml:"include"`
+	}
+	if err = xml.Unmarshal(content, &raw); err != nil {
+		if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+			err = &txtparser.ParseError{Line: syntaxErr.Line, Message: syntaxErr.Msg}
+		} else {
+			err = &txtparser.ParseError{Message: err.Error()}
+		}
+		return
+	}
+	svc = FirewalldService{
+		ShortName:   raw.ShortName,
+		Description: raw.Description,
+		Ports:       make([]FirewalldPort, 0, len(raw.Ports)),
+		Destination: raw.Destination,
+	}
+	for _, port := range raw.Ports {
+		var from, to int
+		bounds := strings.SplitN(port.Port, "-", 2)
+		if from, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+			return svc, &ValidationError{Source: raw.ShortName, Key: "port", Value: port.Port, Message: "failed to interpret port number"}
+		}
+		to = from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || to < from {
+				return svc, &ValidationError{Source: raw.ShortName, Key: "port", Value: port.Port, Message: "failed to interpret port range"}
+			}
+		}
+		for i := from; i <= to; i++ {
+			svc.Ports = append(svc.Ports, FirewalldPort{Port: i, Protocol: port.Protocol})
+		}
+	}
+	unsupported := make([]string, 0, 0)
+	for _, port := range raw.Ports {
+		if port.Protocol != FirewalldProtocolTCP && port.Protocol != FirewalldProtocolUDP {
+			unsupported = append(unsupported, fmt.Sprintf(`<port port="%s" protocol="%s">`, port.Port, port.Protocol))
+		}
+	}
+	for _, protocol := range raw.Protocols {
+		unsupported = append(unsupported, fmt.Sprintf(`<protocol value="%s">`, protocol.Value))
+	}
+	for _, port := range raw.SourcePorts {
+		unsupported = append(unsupported, fmt.Sprintf(`<source-port port="%s" protocol="%s">`, port.Port, port.Protocol))
+	}
+	for _, module := range raw.Modules {
+		unsupported = append(unsupported, fmt.Sprintf(`<module name="%s">`, module.Name))
+	}
+	for _, helper := range raw.Helpers {
+		unsupported = append(unsupported, fmt.Sprintf(`<helper name="%s">`, helper.Name))
 	}
-	return xml.Header + string(out)
+	for _, include := range raw.Includes {
+		unsupported = append(unsupported, fmt.Sprintf(`<include service="%s">`, include.Service))
+	}
+	if len(unsupported) > 0 {
+		err = &ValidationError{Source: raw.ShortName, Value: strings.Join(unsupported, " "), Message: "only TCP and UDP ports can be carried over into a service definition"}
+	}
+	return
 }
 
 // String returns firewall service details in an easy to read, indented format.
@@ -39,6 +214,9 @@ func (svc *FirewalldService) String() string {
 	for _, port := range svc.Ports {
 		out.WriteString(fmt.Sprintf("    Allow %s %d\n", port.Protocol, port.Port))
 	}
+	if svc.Destination != nil {
+		out.WriteString(fmt.Sprintf("    Only to %s\n", svc.Destination.String()))
+	}
 	return out.String()
 }
 
@@ -47,3 +225,104 @@ type FirewalldPort struct {
 	Port     int    `xml:"port,attr"`
 	Protocol string `xml:"protocol,attr"`
 }
+
+// FirewalldPolicy defines a policy that applies services to traffic flowing from ingress zones to egress zones.
+type FirewalldPolicy struct {
+	Target       string             `xml:"target,attr,omitempty"`
+	ShortName    string             `xml:"short"`
+	Description  string             `xml:"description"`
+	IngressZones []FirewalldNameRef `xml:"ingress-zone"`
+	EgressZones  []FirewalldNameRef `xml:"egress-zone"`
+	Services     []FirewalldNameRef `xml:"service"`
+}
+
+// xmlElement returns the policy definition wrapped in the root element of firewalld policy XML.
+func (policy *FirewalldPolicy) xmlElement() interface{} {
+	return struct {
+		XMLName struct{} `xml:"policy"` // the name of root element has to be "policy"
+		*FirewalldPolicy
+	}{FirewalldPolicy: policy}
+}
+
+// ToXML serialises policy definition into a complete XML document that includes the XML header.
+func (policy *FirewalldPolicy) ToXML() string {
+	return xmlDocument(policy.xmlElement())
+}
+
+// ToXMLWithProvenance serialises policy definition into a complete XML document that includes the provenance comment.
+func (policy *FirewalldPolicy) ToXMLWithProvenance(prov Provenance) string {
+	return xmlDocumentWithProvenance(policy.xmlElement(), prov)
+}
+
+// String returns policy details in an easy to read, indented format.
+func (policy *FirewalldPolicy) String() string {
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("%s - %s:\n", policy.ShortName, policy.Description))
+	out.WriteString(fmt.Sprintf("    From zones %s to zones %s\n", joinNameRefs(policy.IngressZones), joinNameRefs(policy.EgressZones)))
+	for _, svc := range policy.Services {
+		out.WriteString(fmt.Sprintf("    Allow service %s\n", svc.Name))
+	}
+	return out.String()
+}
+
+// FirewalldZone defines a zone with the network interfaces bound to it and the services allowed in it.
+type FirewalldZone struct {
+	ShortName   string             `xml:"short"`
+	Description string             `xml:"description"`
+	Interfaces  []FirewalldNameRef `xml:"interface"`
+	Services    []FirewalldNameRef `xml:"service"`
+}
+
+// ToXML serialises zone definition into a complete XML document that includes the XML header.
+func (zone *FirewalldZone) ToXML() string {
+	tmp := struct {
+		XMLName struct{} `xml:"zone"` // the name of root element has to be "zone"
+		*FirewalldZone
+	}{FirewalldZone: zone}
+	return xmlDocument(tmp)
+}
+
+// String returns zone details in an easy to read, indented format.
+func (zone *FirewalldZone) String() string {
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("%s - %s:\n", zone.ShortName, zone.Description))
+	out.WriteString(fmt.Sprintf("    Interfaces %s\n", joinNameRefs(zone.Interfaces)))
+	for _, svc := range zone.Services {
+		out.WriteString(fmt.Sprintf("    Allow service %s\n", svc.Name))
+	}
+	return out.String()
+}
+
+// ParseFirewalldZoneXML reads a firewalld zone definition written in XML, only the elements of FirewalldZone are kept.
+func ParseFirewalldZoneXML(content []byte) (zone FirewalldZone, err error) {
+	if err = xml.Unmarshal(content, &zone); err != nil {
+		if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+			err = &txtparser.ParseError{Line: syntaxErr.Line, Message: syntaxErr.Msg}
+		} else {
+			err = &txtparser.ParseError{Message: err.Error()}
+		}
+	}
+	return
+}
+
+// FirewalldNameRef refers to a zone or service by its name.
+type FirewalldNameRef struct {
+	Name string `xml:"name,attr"`
+}
+
+// MakeFirewalldNameRefs turns names into a list of name references.
+func MakeFirewalldNameRefs(names []string) []FirewalldNameRef {
+	ret := make([]FirewalldNameRef, len(names))
+	for i, name := range names {
+		ret[i] = FirewalldNameRef{Name: name}
+	}
+	return ret
+}
+
+func joinNameRefs(refs []FirewalldNameRef) string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name
+	}
+	return strings.Join(names, " ")
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"encoding/xml"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -36,14 +37,29 @@ func TestFirewalldXML(t *testing.T) {
 		t.Fatalf("%+v", elem)
 	}
 
-	// Serialise structure into XML and match again
+	// Serialise structure into XML and match again, the ports of each protocol come in ascending order
 	toXML := match.ToXML()
-	elem = FirewalldService{}
-	if err := xml.Unmarshal([]byte(toXML), &elem); err != nil {
+	elem, err := ParseFirewalldServiceXML([]byte(toXML))
+	if err != nil {
 		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(elem, match) {
-		t.Fatalf("\n%+v\n%+v\n", elem, match)
+	sorted := match
+	sorted.Ports = []FirewalldPort{{Protocol: "tcp", Port: 80}, {Protocol: "tcp", Port: 88}, {Protocol: "tcp", Port: 443}, {Protocol: "udp", Port: 88}}
+	if !reflect.DeepEqual(elem, sorted) {
+		t.Fatalf("\n%+v\n%+v\n", elem, sorted)
+	}
+
+	// Consecutive ports are folded into a range
+	ranged := FirewalldService{ShortName: "XS advanced", Ports: []FirewalldPort{{Protocol: "tcp", Port: 30033}}}
+	for port := 51000; port <= 51500; port++ {
+		ranged.Ports = append(ranged.Ports, FirewalldPort{Protocol: "tcp", Port: port})
+	}
+	ranged.Ports = append(ranged.Ports, FirewalldPort{Protocol: "udp", Port: 51001})
+	if toXML := ranged.ToXML(); strings.Count(toXML, "<port ") != 3 || !strings.Contains(toXML, `<port port="51000-51500" protocol="tcp"></port>`) {
+		t.Fatal(toXML)
+	}
+	if elem, err := ParseFirewalldServiceXML([]byte(ranged.ToXML())); err != nil || !reflect.DeepEqual(elem, ranged) {
+		t.Fatal(elem, err)
 	}
 
 	// Format for readability
@@ -57,3 +73,113 @@ func TestFirewalldXML(t *testing.T) {
 		t.Fatalf("\n%s\n%s\n%v\n%v\n", s, matchStr, []byte(s), []byte(matchStr))
 	}
 }
+
+func TestFirewalldPolicyXML(t *testing.T) {
+	policy := FirewalldPolicy{
+		Target:       "CONTINUE",
+		ShortName:    "hana-firewall",
+		Description:  "This is description",
+		IngressZones: MakeFirewalldNameRefs([]string{"podman"}),
+		EgressZones:  MakeFirewalldNameRefs([]string{"HOST", "public"}),
+		Services:     MakeFirewalldNameRefs([]string{"hana-cockpit"}),
+	}
+	toXML := policy.ToXML()
+	if !IsGeneratedFile([]byte(toXML)) {
+		t.Fatal(toXML)
+	}
+	matchXML := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generated by hana-firewall, manual changes will be lost. -->
+<policy target="CONTINUE">
+    <short>hana-firewall</short>
+    <description>This is description</description>
+    <ingress-zone name="podman"></ingress-zone>
+    <egress-zone name="HOST"></egress-zone>
+    <egress-zone name="public"></egress-zone>
+    <service name="hana-cockpit"></service>
+</policy>`
+	if toXML != matchXML {
+		t.Fatalf("\n%s\n%s\n", toXML, matchXML)
+	}
+	var elem FirewalldPolicy
+	if err := xml.Unmarshal([]byte(toXML), &elem); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(elem, policy) {
+		t.Fatalf("\n%+v\n%+v\n", elem, policy)
+	}
+
+	matchStr := `hana-firewall - This is description:
+    From zones podman to zones HOST public
+    Allow service hana-cockpit
+`
+	if s := policy.String(); s != matchStr {
+		t.Fatalf("\n%s\n%s\n", s, matchStr)
+	}
+}
+
+func TestParseFirewalldServiceXML(t *testing.T) {
+	sample := `<?xml version="1.0" encoding="utf-8"?>
+<service>
+    <short>HANA</short>
+    <description>Hand written</description>
+    <port protocol="tcp" port="30013"/>
+    <port protocol="tcp" port="30040-30042"/>
+    <port protocol="udp" port="161"/>
+</service>`
+	svc, err := ParseFirewalldServiceXML([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := FirewalldService{
+		ShortName:   "HANA",
+		Description: "Hand written",
+		Ports: []FirewalldPort{
+			{Protocol: "tcp", Port: 30013},
+			{Protocol: "tcp", Port: 30040},
+			{Protocol: "tcp", Port: 30041},
+			{Protocol: "tcp", Port: 30042},
+			{Protocol: "udp", Port: 161},
+		},
+	}
+	if !reflect.DeepEqual(svc, match) {
+		t.Fatalf("%+v", svc)
+	}
+	if _, err := ParseFirewalldServiceXML([]byte(`<service><port protocol="tcp" port="2-1"/></service>`)); err == nil {
+		t.Fatal("did not error")
+	}
+	// Elements that cannot be carried over are named in the error
+	lossy := `<service><short>lossy</short><port protocol="tcp" port="1"/><port protocol="sctp" port="2"/>
+<protocol value="gre"/><source-port protocol="udp" port="3"/><module name="nf_conntrack_tftp"/><include service="ssh"/></service>`
+	svc, err = ParseFirewalldServiceXML([]byte(lossy))
+	if validationErr, ok := err.(*ValidationError); !ok || validationErr.Value != `<port port="2" protocol="sctp"> <protocol value="gre"> <source-port port="3" protocol="udp"> <module name="nf_conntrack_tftp"> <include service="ssh">` {
+		t.Fatal(err)
+	}
+}
+
+func TestParseFirewalldZoneXML(t *testing.T) {
+	sample := `<?xml version="1.0" encoding="utf-8"?>
+<zone target="default">
+    <short>Public</short>
+    <description>Hand written</description>
+    <interface name="eth0"/>
+    <service name="ssh"/>
+    <service name="hana-database-client"/>
+    <port protocol="tcp" port="8080"/>
+</zone>`
+	zone, err := ParseFirewalldZoneXML([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := FirewalldZone{
+		ShortName:   "Public",
+		Description: "Hand written",
+		Interfaces:  []FirewalldNameRef{{Name: "eth0"}},
+		Services:    []FirewalldNameRef{{Name: "ssh"}, {Name: "hana-database-client"}},
+	}
+	if !reflect.DeepEqual(zone, match) {
+		t.Fatalf("%+v", zone)
+	}
+	if _, err := ParseFirewalldZoneXML([]byte(`<zone><service name="ssh">`)); err == nil {
+		t.Fatal("did not error")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/SUSE/HANA-Firewall/txtparser"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,16 +26,81 @@ const (
 	*/
 	InstanceNumberPlusOneSubstitutionMagic = "__INST_NUM+1__"
 
-	HANAServiceDefinitionTCPKey  = "TCP"
-	HANAServiceDefinitionUDPKey  = "UDP"
-	HANAGlobalInstanceNumbersKey = "HANA_INSTANCE_NUMBERS"
+	/*
+		INISubstitutionMagic starts a placeholder that refers to a value in the custom INI configuration of the HANA
+		system, written as __INI:file:section:key:default__. For example, "__INI:global.ini:communication:sqlport:3$(SAPSYSTEM)15__"
+		is substituted by the value of sqlport in section [communication] of global.ini, or "3$(SAPSYSTEM)15" if the value
+		is not configured. The default is optional, it may only be a literal that may contain colons, and "$(SAPSYSTEM)" in
+		both the configured value and the default is substituted by the instance number.
+	*/
+	INISubstitutionMagic = "__INI:"
+
+	// INIInstanceNumberVariable is substituted by the instance number among the values of HANA INI configuration.
+	INIInstanceNumberVariable = "$(SAPSYSTEM)"
+	// INISIDVariable is substituted by the SID among the values of HANA INI configuration.
+	INISIDVariable = "$(SAPSYSTEMNAME)"
+
+	HANAServiceDefinitionTCPKey              = "TCP"
+	HANAServiceDefinitionUDPKey              = "UDP"
+	HANAServiceDefinitionShortDescriptionKey = "SHORT_DESCRIPTION"
+	HANAServiceDefinitionDescriptionKey      = "DESCRIPTION"
+	HANAServiceDefinitionEnabledKey          = "ENABLED"
+	HANAServiceDefinitionScaleOutKey         = "REQUIRES_SCALEOUT"
+	HANAServiceDefinitionSIDsKey             = "ONLY_FOR_SIDS"
+	HANAServiceDefinitionReplicationKey      = "REPLICATION"
+	HANAServiceDefinitionMinVersionKey       = "MIN_HANA_VERSION"
+	HANAServiceDefinitionMaxVersionKey       = "MAX_HANA_VERSION"
+	HANAGlobalInstanceNumbersKey             = "HANA_INSTANCE_NUMBERS"
+	HANAGlobalPolicyIngressKey               = "HANA_POLICY_INGRESS_ZONES"
+	HANAGlobalPolicyEgressKey                = "HANA_POLICY_EGRESS_ZONES"
+	HANAGlobalSIDsKey                        = "HANA_SIDS"
+	HANAGlobalScaleOutKey                    = "HANA_SCALE_OUT"
+	HANAGlobalReplicationSiteNameKey         = "HANA_SR_SITE_NAME"
+	HANAGlobalReplicationTierKey             = "HANA_SR_TIER"
+	HANAGlobalReplicationRoleKey             = "HANA_SR_ROLE"
+	HANAGlobalReplicationPeersKey            = "HANA_SR_PEERS"
+	HANAGlobalReplicationPortOffsetKey       = "HANA_SR_PORT_OFFSET"
+	HANAGlobalInstanceDestinationsKey        = "HANA_INSTANCE_DESTINATIONS"
+	HANAGlobalDefinitionSymlinksKey          = "HANA_DEFINITION_SYMLINKS"
+
+	// HANAGlobalParametersFile is the location of HANA firewall global configuration.
+	HANAGlobalParametersFile = "/etc/sysconfig/hana-firewall"
+)
+
+var (
+	// validDefinitionName matches allowed names of service definitions, which are also the names of their files.
+	validDefinitionName = regexp.MustCompile(`^[[:alnum:]][[:alnum:] _+()-]*$`)
+	// iniPlaceholder matches INI placeholders, see INISubstitutionMagic. The default comes with the leading colon.
+	iniPlaceholder = regexp.MustCompile(`__INI:([^:]+?):([^:]+?):([^:]+?)((?::.*?)?)__`)
+	// HANAServiceDefinitionSchema declares the keys of HANA service definition files.
+	HANAServiceDefinitionSchema = txtparser.NewSchema("service definition",
+		HANAServiceDefinitionTCPKey, HANAServiceDefinitionUDPKey,
+		HANAServiceDefinitionShortDescriptionKey, HANAServiceDefinitionDescriptionKey,
+		HANAServiceDefinitionEnabledKey, HANAServiceDefinitionScaleOutKey, HANAServiceDefinitionSIDsKey,
+		HANAServiceDefinitionReplicationKey, HANAServiceDefinitionMinVersionKey, HANAServiceDefinitionMaxVersionKey)
+	// HANAGlobalParametersSchema declares the keys of /etc/sysconfig/hana-firewall.
+	HANAGlobalParametersSchema = txtparser.NewSchema(HANAGlobalParametersFile,
+		HANAGlobalInstanceNumbersKey, HANAGlobalPolicyIngressKey, HANAGlobalPolicyEgressKey,
+		HANAGlobalSIDsKey, HANAGlobalScaleOutKey,
+		HANAGlobalReplicationSiteNameKey, HANAGlobalReplicationTierKey, HANAGlobalReplicationRoleKey,
+		HANAGlobalReplicationPeersKey, HANAGlobalReplicationPortOffsetKey, HANAGlobalInstanceDestinationsKey,
+		HANAGlobalDefinitionSymlinksKey)
 )
 
 // HANAServiceDefinition is a HANA network service definition written in a sysconfig-style text file.
 type HANAServiceDefinition struct {
-	FileBaseName string   // FileBaseName is the base name of service definition file.
-	TCP          []string // TCP port numbers, each one may include the instance number substitution magic.
-	UDP          []string // UDP port numbers, each one may include the instance number substitution magic.
+	FileBaseName     string   // FileBaseName is the base name of service definition file.
+	FilePath         string   // FilePath is the path of service definition file, it is empty if the definition is not read from a file.
+	ShortDescription string   // ShortDescription is a human readable service name.
+	Description      string   // Description explains the purpose of the service.
+	TCP              []string // TCP port numbers, each one may include the instance number substitution magic.
+	UDP              []string // UDP port numbers, each one may include the instance number substitution magic.
+	Disabled         bool     // Disabled definitions are never turned into firewalld services.
+	RequiresScaleOut bool     // RequiresScaleOut definitions are only turned into firewalld services on scale-out systems.
+	OnlyForSIDs      []string // OnlyForSIDs restricts the definition to HANA systems of these SIDs, if it is not empty.
+	Replication      bool     // Replication definitions are turned into one firewalld service per system replication peer.
+	MinHANAVersion   string   // MinHANAVersion is the oldest HANA version that uses the service, it may be empty.
+	MaxHANAVersion   string   // MaxHANAVersion is the newest HANA version that uses the service, it may be empty.
 }
 
 // GetShortName returns a linted "short name" that identifies a Firewalld service and its XML file.
@@ -53,65 +119,407 @@ func (def *HANAServiceDefinition) GetShortName() string {
 	return ret.String()
 }
 
-// ReadFromText reads definition content from a sysconfig-style text file.
+// The comment lines written by import and migrate-from-v1 start with these prefixes to tell where a definition comes from.
+const (
+	DefinitionImportedComment = "Imported from "
+	DefinitionMigratedComment = "Migrated from "
+)
+
+/*
+commentDescriptions returns short description and description written in the leading comment block of a definition
+file. The first comment line is the short description, and the remaining lines make up the description. Comment lines
+that tell where the definition comes from are not descriptions.
+*/
+func commentDescriptions(txt *txtparser.Sysconfig) (shortDescription, description string) {
+	comments := make([]string, 0, 4)
+	for _, comment := range txt.GetLeadingComments() {
+		isProvenance := false
+		for _, prefix := range []string{DefinitionImportedComment, DefinitionMigratedComment} {
+			isProvenance = isProvenance || strings.HasPrefix(comment, prefix)
+		}
+		if !isProvenance {
+			comments = append(comments, comment)
+		}
+	}
+	if len(comments) > 0 {
+		shortDescription = comments[0]
+		description = strings.Join(comments[1:], " ")
+	}
+	return
+}
+
+/*
+ReadFromText reads definition content from a sysconfig-style text file. If the descriptions are not given by their
+keys, they are read from the leading comment block.
+*/
 func (def *HANAServiceDefinition) ReadFrom(txt *txtparser.Sysconfig) {
 	def.TCP = txt.GetStringArray(HANAServiceDefinitionTCPKey, []string{})
 	def.UDP = txt.GetStringArray(HANAServiceDefinitionUDPKey, []string{})
+	shortDescription, description := commentDescriptions(txt)
+	def.ShortDescription = txt.GetString(HANAServiceDefinitionShortDescriptionKey, shortDescription)
+	def.Description = txt.GetString(HANAServiceDefinitionDescriptionKey, description)
+	def.Disabled = !txt.GetBool(HANAServiceDefinitionEnabledKey, true)
+	def.RequiresScaleOut = txt.GetBool(HANAServiceDefinitionScaleOutKey, false)
+	def.OnlyForSIDs = txt.GetStringArray(HANAServiceDefinitionSIDsKey, []string{})
+	def.Replication = txt.GetBool(HANAServiceDefinitionReplicationKey, false)
+	def.MinHANAVersion = txt.GetString(HANAServiceDefinitionMinVersionKey, "")
+	def.MaxHANAVersion = txt.GetString(HANAServiceDefinitionMaxVersionKey, "")
+}
+
+/*
+GetHANAVersionRange returns the inclusive range of HANA versions that use the service. Either version is empty if the
+range is open on that side.
+*/
+func (def *HANAServiceDefinition) GetHANAVersionRange() (min, max HANAVersion, err error) {
+	if def.MinHANAVersion != "" {
+		if min, err = ParseHANAVersion(def.MinHANAVersion); err != nil {
+			return nil, nil, &ValidationError{Source: def.FileBaseName, Key: HANAServiceDefinitionMinVersionKey, Value: def.MinHANAVersion, Message: err.Error()}
+		}
+	}
+	if def.MaxHANAVersion != "" {
+		if max, err = ParseHANAVersion(def.MaxHANAVersion); err != nil {
+			return nil, nil, &ValidationError{Source: def.FileBaseName, Key: HANAServiceDefinitionMaxVersionKey, Value: def.MaxHANAVersion, Message: err.Error()}
+		}
+	}
+	if len(min) > 0 && len(max) > 0 && min.Compare(max) > 0 {
+		return nil, nil, &ValidationError{Source: def.FileBaseName, Key: HANAServiceDefinitionMaxVersionKey, Value: def.MaxHANAVersion, Message: "the version is older than " + HANAServiceDefinitionMinVersionKey}
+	}
+	return
 }
 
-// WriteInto overwrites keys and values of text file with the current definition content.
+/*
+WriteInto overwrites keys and values of text file with the current definition content. The description keys are only
+written if they already exist, or the descriptions differ from those in the leading comment block.
+*/
 func (def *HANAServiceDefinition) WriteInto(txt *txtparser.Sysconfig) {
+	shortDescription, description := commentDescriptions(txt)
+	if _, exists := txt.KeyValue[HANAServiceDefinitionShortDescriptionKey]; exists || def.ShortDescription != shortDescription {
+		txt.Set(HANAServiceDefinitionShortDescriptionKey, def.ShortDescription)
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionDescriptionKey]; exists || def.Description != description {
+		txt.Set(HANAServiceDefinitionDescriptionKey, def.Description)
+	}
 	txt.SetStringArray(HANAServiceDefinitionTCPKey, def.TCP)
 	txt.SetStringArray(HANAServiceDefinitionUDPKey, def.UDP)
+	// Conditions are only written if they are in use
+	if _, exists := txt.KeyValue[HANAServiceDefinitionEnabledKey]; exists || def.Disabled {
+		txt.Set(HANAServiceDefinitionEnabledKey, yesNo(!def.Disabled))
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionScaleOutKey]; exists || def.RequiresScaleOut {
+		txt.Set(HANAServiceDefinitionScaleOutKey, yesNo(def.RequiresScaleOut))
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionSIDsKey]; exists || len(def.OnlyForSIDs) > 0 {
+		txt.SetStringArray(HANAServiceDefinitionSIDsKey, def.OnlyForSIDs)
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionReplicationKey]; exists || def.Replication {
+		txt.Set(HANAServiceDefinitionReplicationKey, yesNo(def.Replication))
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionMinVersionKey]; exists || def.MinHANAVersion != "" {
+		txt.Set(HANAServiceDefinitionMinVersionKey, def.MinHANAVersion)
+	}
+	if _, exists := txt.KeyValue[HANAServiceDefinitionMaxVersionKey]; exists || def.MaxHANAVersion != "" {
+		txt.Set(HANAServiceDefinitionMaxVersionKey, def.MaxHANAVersion)
+	}
+}
+
+/*
+ValidateDefinitionName returns an error if the name is not allowed for a service definition. The name is also the file
+name of the definition, it may only consist of letters, numbers, space, and characters _+()-.
+*/
+func ValidateDefinitionName(name string) error {
+	if !validDefinitionName.MatchString(name) {
+		return &ValidationError{Value: name, Message: "the name may only consist of letters, numbers, space, and characters _+()-, and it must start with a letter or number"}
+	}
+	return nil
+}
+
+// yesNo returns the sysconfig representation of a boolean value.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
 }
 
 // HANAGlobalParameters are settings that come from /etc/sysconfig/hana-firewall.
 type HANAGlobalParameters struct {
-	InstanceNumbers []string
+	InstanceNumbers    []string
+	PolicyIngressZones []string     // PolicyIngressZones are the firewalld zones from which HANA traffic is routed.
+	PolicyEgressZones  []string     // PolicyEgressZones are the firewalld zones towards which HANA traffic is routed.
+	SIDs               []string     // SIDs of HANA systems, they are discovered automatically if left empty.
+	ScaleOut           string       // ScaleOut is "yes", "no", or empty to detect scale-out systems automatically.
+	Systems            []HANASystem // Systems are the HANA systems discovered on this host, they do not come from sysconfig.
+
+	ReplicationSiteName   string   // ReplicationSiteName is the name of this site in HANA system replication.
+	ReplicationTier       int      // ReplicationTier of this site, 1 is the primary site. 0 lets ReplicationRole decide.
+	ReplicationRole       string   // ReplicationRole is primary, secondary, tertiary, or empty.
+	ReplicationPeers      []string // ReplicationPeers are the other sites written as NAME:TIER:INSTANCE_NUMBER.
+	ReplicationPortOffset int      // ReplicationPortOffset overrides the port_offset of HANA global.ini if it is not 0.
+
+	// InstanceDestinations are written as NN=ADDRESS[,ADDRESS], NN=auto, or auto, see GetInstanceDestinations.
+	InstanceDestinations []string
+	// DefinitionSymlinks is "follow", "reject", or empty to follow symbolic links among definition directories.
+	DefinitionSymlinks string
 }
 
 func (global *HANAGlobalParameters) ReadFrom(txt *txtparser.Sysconfig) {
 	global.InstanceNumbers = txt.GetStringArray(HANAGlobalInstanceNumbersKey, []string{})
+	global.PolicyIngressZones = txt.GetStringArray(HANAGlobalPolicyIngressKey, []string{})
+	global.PolicyEgressZones = txt.GetStringArray(HANAGlobalPolicyEgressKey, []string{})
+	global.SIDs = txt.GetStringArray(HANAGlobalSIDsKey, []string{})
+	global.ScaleOut = strings.ToLower(txt.GetString(HANAGlobalScaleOutKey, ""))
+	global.ReplicationSiteName = txt.GetString(HANAGlobalReplicationSiteNameKey, "")
+	global.ReplicationTier = txt.GetInt(HANAGlobalReplicationTierKey, 0)
+	global.ReplicationRole = strings.ToLower(txt.GetString(HANAGlobalReplicationRoleKey, ""))
+	global.ReplicationPeers = txt.GetStringArray(HANAGlobalReplicationPeersKey, []string{})
+	global.ReplicationPortOffset = txt.GetInt(HANAGlobalReplicationPortOffsetKey, 0)
+	global.InstanceDestinations = txt.GetStringArray(HANAGlobalInstanceDestinationsKey, []string{})
+	global.DefinitionSymlinks = strings.ToLower(txt.GetString(HANAGlobalDefinitionSymlinksKey, ""))
 }
 
 func (global *HANAGlobalParameters) WriteInto(txt *txtparser.Sysconfig) {
 	txt.SetStringArray(HANAGlobalInstanceNumbersKey, global.InstanceNumbers)
+	if len(global.PolicyIngressZones) > 0 || len(global.PolicyEgressZones) > 0 {
+		txt.SetStringArray(HANAGlobalPolicyIngressKey, global.PolicyIngressZones)
+		txt.SetStringArray(HANAGlobalPolicyEgressKey, global.PolicyEgressZones)
+	}
+	if _, exists := txt.KeyValue[HANAGlobalSIDsKey]; exists || len(global.SIDs) > 0 {
+		txt.SetStringArray(HANAGlobalSIDsKey, global.SIDs)
+	}
+	if _, exists := txt.KeyValue[HANAGlobalScaleOutKey]; exists || global.ScaleOut != "" {
+		txt.Set(HANAGlobalScaleOutKey, global.ScaleOut)
+	}
+	if _, exists := txt.KeyValue[HANAGlobalReplicationPeersKey]; exists || global.ReplicationEnabled() {
+		txt.Set(HANAGlobalReplicationSiteNameKey, global.ReplicationSiteName)
+		txt.Set(HANAGlobalReplicationTierKey, global.ReplicationTier)
+		txt.Set(HANAGlobalReplicationRoleKey, global.ReplicationRole)
+		txt.SetStringArray(HANAGlobalReplicationPeersKey, global.ReplicationPeers)
+		if global.ReplicationPortOffset == 0 {
+			txt.Set(HANAGlobalReplicationPortOffsetKey, "")
+		} else {
+			txt.Set(HANAGlobalReplicationPortOffsetKey, global.ReplicationPortOffset)
+		}
+	}
+	if _, exists := txt.KeyValue[HANAGlobalInstanceDestinationsKey]; exists || global.DestinationsEnabled() {
+		txt.SetStringArray(HANAGlobalInstanceDestinationsKey, global.InstanceDestinations)
+	}
+	if _, exists := txt.KeyValue[HANAGlobalDefinitionSymlinksKey]; exists || global.DefinitionSymlinks != "" {
+		txt.Set(HANAGlobalDefinitionSymlinksKey, global.DefinitionSymlinks)
+	}
+}
+
+/*
+RejectsDefinitionSymlinks returns true if symbolic links among definition directories should be reported as errors
+instead of being followed. An error is returned if the setting is neither "follow" nor "reject".
+*/
+func (global *HANAGlobalParameters) RejectsDefinitionSymlinks() (bool, error) {
+	switch global.DefinitionSymlinks {
+	case "", "follow":
+		return false, nil
+	case "reject":
+		return true, nil
+	}
+	return false, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalDefinitionSymlinksKey, Value: global.DefinitionSymlinks, Message: "expecting \"follow\" or \"reject\""}
+}
+
+// PolicyEnabled returns true only if both ingress and egress zones are given for generating firewalld policy.
+func (global *HANAGlobalParameters) PolicyEnabled() bool {
+	return len(global.PolicyIngressZones) > 0 && len(global.PolicyEgressZones) > 0
 }
 
 /*
 GetPortNumbers returns actual service port numbers calculated by expanding definition string with instance number
-parameter. An error will be returned only if there is a number formatting.
+parameter. The definition may be an inclusive range of two port definitions separated by a dash, such as
+"3__INST_NUM__30-3__INST_NUM__33", which yields all port numbers of the range. If INI placeholders yield different
+definitions for the tenant databases of a system, the port numbers of all of them are returned. An error will be
+returned only if there is a number formatting.
 */
 func (global *HANAGlobalParameters) GetPortNumbers(portDefinition string) (ret []int, err error) {
 	ret = make([]int, 0, 10)
-	expandedPorts := make([]string, 0, 10)
+	seen := make(map[int]bool)
 	for _, instNumStr := range global.InstanceNumbers {
-		instancePort := portDefinition
-		// Replace magic strings among the definition by instance number string
-		if strings.Contains(instancePort, InstanceNumberSubstitutionMagic) {
-			instancePort = strings.Replace(instancePort, InstanceNumberSubstitutionMagic, instNumStr, -1)
+		expansions, err := global.expandDatabaseINIPlaceholders(portDefinition, instNumStr)
+		if err != nil {
+			return ret, err
 		}
-		if strings.Contains(instancePort, InstanceNumberPlusOneSubstitutionMagic) {
-			// Convert instance number string into integer, plus one, and add padding zero on the left.
-			instNum, err := strconv.Atoi(instNumStr)
+		for _, expansion := range expansions {
+			ports, err := getExpandedPortNumbers(portDefinition, expansion.definition, instNumStr)
 			if err != nil {
-				return ret, fmt.Errorf("HANAGlobalParameters.GetPortNumbers: from global parameters, an instance number \"%s\" is not a valid integer", instNumStr)
+				return ret, err
+			}
+			for _, port := range ports {
+				if !seen[port] {
+					seen[port] = true
+					ret = append(ret, port)
+				}
 			}
-			instancePort = strings.Replace(instancePort, InstanceNumberPlusOneSubstitutionMagic, fmt.Sprintf("%.2d", instNum+1), -1)
 		}
-		expandedPorts = append(expandedPorts, instancePort)
 	}
-	// Turn expanded port strings into integers
-	for _, portStr := range expandedPorts {
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
-			return ret, fmt.Errorf("HANAGlobalParameters.GetPortNumbers: failed to interpret port number \"%s\" while expanding \"%s\"", portStr, portDefinition)
-		}
+	return
+}
+
+// getExpandedPortNumbers returns the port numbers of a port definition whose INI placeholders are already expanded.
+func getExpandedPortNumbers(portDefinition, instancePort, instNumStr string) (ret []int, err error) {
+	firstDefinition, lastDefinition := instancePort, instancePort
+	if dash := strings.IndexRune(instancePort, '-'); dash > 0 {
+		firstDefinition, lastDefinition = instancePort[:dash], instancePort[dash+1:]
+	}
+	first, err := ExpandPortDefinition(firstDefinition, instNumStr)
+	if err != nil {
+		return nil, err
+	}
+	last, err := ExpandPortDefinition(lastDefinition, instNumStr)
+	if err != nil {
+		return nil, err
+	}
+	if last < first {
+		return nil, &ValidationError{Value: portDefinition, Message: "the range ends before it begins"}
+	}
+	for port := first; port <= last; port++ {
 		ret = append(ret, port)
 	}
 	return
 }
 
+// getDefinitionPortNumbers returns the port numbers of a port definition that belongs to the service definition.
+func (global *HANAGlobalParameters) getDefinitionPortNumbers(def *HANAServiceDefinition, portDefinition string) ([]int, error) {
+	if def.Replication {
+		return global.getReplicationPortNumbers(portDefinition)
+	}
+	return global.GetPortNumbers(portDefinition)
+}
+
+/*
+ExpandINIPlaceholders substitutes INI placeholders among the port definition by the values configured for the HANA
+system of the instance number, or by their defaults if the values are not configured or the system is not discovered.
+An error is returned if a value is neither configured nor given a default. The configuration of tenant databases is
+not considered.
+*/
+func (global *HANAGlobalParameters) ExpandINIPlaceholders(portDefinition, instNumStr string) (expanded string, err error) {
+	system := global.GetSystem(instNumStr)
+	var config map[string]*txtparser.INI
+	if system != nil {
+		config = system.Config
+	}
+	return expandINIPlaceholders(portDefinition, instNumStr, system, config)
+}
+
+// databaseExpansion is a port definition with INI placeholders substituted for the system or one of its tenants.
+type databaseExpansion struct {
+	tenant     string // tenant is empty for the configuration of the system.
+	definition string
+}
+
+/*
+expandDatabaseINIPlaceholders substitutes INI placeholders among the port definition in the same way as
+ExpandINIPlaceholders, once for the system database and once for each tenant database of the system, in the order of
+tenant names. Tenants whose configuration yields the same definition as an earlier database are left out.
+*/
+func (global *HANAGlobalParameters) expandDatabaseINIPlaceholders(portDefinition, instNumStr string) (ret []databaseExpansion, err error) {
+	expanded, err := global.ExpandINIPlaceholders(portDefinition, instNumStr)
+	if err != nil {
+		return nil, err
+	}
+	ret = []databaseExpansion{{definition: expanded}}
+	system := global.GetSystem(instNumStr)
+	if system == nil || !strings.Contains(portDefinition, INISubstitutionMagic) {
+		return
+	}
+	tenants := make([]string, 0, len(system.TenantConfig))
+	for tenant := range system.TenantConfig {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	seen := map[string]bool{expanded: true}
+	for _, tenant := range tenants {
+		if expanded, err = expandINIPlaceholders(portDefinition, instNumStr, system, system.TenantConfig[tenant]); err != nil {
+			return nil, err
+		}
+		if !seen[expanded] {
+			seen[expanded] = true
+			ret = append(ret, databaseExpansion{tenant: tenant, definition: expanded})
+		}
+	}
+	return
+}
+
+// expandINIPlaceholders substitutes INI placeholders among the port definition by the values of the configuration.
+func expandINIPlaceholders(portDefinition, instNumStr string, system *HANASystem, config map[string]*txtparser.INI) (expanded string, err error) {
+	if !strings.Contains(portDefinition, INISubstitutionMagic) {
+		return portDefinition, nil
+	}
+	expanded = iniPlaceholder.ReplaceAllStringFunc(portDefinition, func(placeholder string) string {
+		match := iniPlaceholder.FindStringSubmatch(placeholder)
+		fileName, section, key, defaultValue := match[1], match[2], match[3], match[4]
+		value, found := "", false
+		if config[fileName] != nil {
+			value, found = config[fileName].Get(section, key)
+		}
+		if !found {
+			if defaultValue == "" {
+				err = &ValidationError{Value: placeholder, Message: fmt.Sprintf("[%s] %s is not configured in %s of instance %s, and there is no default", section, key, fileName, instNumStr)}
+				return placeholder
+			}
+			value = defaultValue[1:]
+		}
+		value = strings.Replace(value, INIInstanceNumberVariable, instNumStr, -1)
+		if system != nil {
+			value = strings.Replace(value, INISIDVariable, system.SID, -1)
+		}
+		return strings.TrimSpace(value)
+	})
+	return
+}
+
+/*
+ExpandPortDefinition returns the actual port number calculated by substituting placeholders among the definition by
+the instance number. An error is returned if the result is not a valid port number.
+*/
+func ExpandPortDefinition(portDefinition, instNumStr string) (int, error) {
+	instancePort := portDefinition
+	// Replace magic strings among the definition by instance number string
+	if strings.Contains(instancePort, InstanceNumberSubstitutionMagic) {
+		instancePort = strings.Replace(instancePort, InstanceNumberSubstitutionMagic, instNumStr, -1)
+	}
+	if strings.Contains(instancePort, InstanceNumberPlusOneSubstitutionMagic) {
+		// Convert instance number string into integer, plus one, and add padding zero on the left.
+		instNum, err := strconv.Atoi(instNumStr)
+		if err != nil {
+			return 0, &ValidationError{Source: HANAGlobalInstanceNumbersKey, Value: instNumStr, Message: "instance number is not a valid integer"}
+		}
+		instancePort = strings.Replace(instancePort, InstanceNumberPlusOneSubstitutionMagic, fmt.Sprintf("%.2d", instNum+1), -1)
+	}
+	// Turn expanded port string into integer
+	port, err := strconv.Atoi(instancePort)
+	if err != nil {
+		return 0, &ValidationError{Value: portDefinition, Message: fmt.Sprintf("failed to interpret port number \"%s\"", instancePort)}
+	}
+	if port < 1 || port > 65535 {
+		return 0, &ValidationError{Value: portDefinition, Message: fmt.Sprintf("port number %d is out of range", port)}
+	}
+	return port, nil
+}
+
+/*
+ValidateDefinition expands all port definitions in the same way as generating firewalld service, and returns the
+first error encountered. If there are no instance numbers in global parameters, instance number 00 is used for the
+validation. The definition must have at least one port.
+*/
+func (global *HANAGlobalParameters) ValidateDefinition(def *HANAServiceDefinition) error {
+	if len(def.TCP) == 0 && len(def.UDP) == 0 {
+		return &ValidationError{Source: def.FileBaseName, Message: "the service must have at least one TCP or UDP port"}
+	}
+	if _, _, err := def.GetHANAVersionRange(); err != nil {
+		return err
+	}
+	validator := *global
+	if len(validator.InstanceNumbers) == 0 {
+		validator.InstanceNumbers = []string{"00"}
+	}
+	_, _, err := validator.MakeFirewalldService(def)
+	return err
+}
+
 // MakeFirewalldService generates firewalld service definition for a single HANA service definition.
 func (global *HANAGlobalParameters) MakeFirewalldService(def *HANAServiceDefinition) (serviceShortName string, svc FirewalldService, err error) {
 	serviceShortName = def.GetShortName()
@@ -120,16 +528,18 @@ func (global *HANAGlobalParameters) MakeFirewalldService(def *HANAServiceDefinit
 	udpPorts := make([]int, 0, 10)
 	for _, portDefinition := range def.TCP {
 		var actualPortNumbers []int
-		actualPortNumbers, err = global.GetPortNumbers(portDefinition)
+		actualPortNumbers, err = global.getDefinitionPortNumbers(def, portDefinition)
 		if err != nil {
+			err = setErrorSource(err, def.FileBaseName, HANAServiceDefinitionTCPKey)
 			return
 		}
 		tcpPorts = append(tcpPorts, actualPortNumbers...)
 	}
 	for _, portDefinition := range def.UDP {
 		var actualPortNumbers []int
-		actualPortNumbers, err = global.GetPortNumbers(portDefinition)
+		actualPortNumbers, err = global.getDefinitionPortNumbers(def, portDefinition)
 		if err != nil {
+			err = setErrorSource(err, def.FileBaseName, HANAServiceDefinitionUDPKey)
 			return
 		}
 		udpPorts = append(udpPorts, actualPortNumbers...)
@@ -149,13 +559,159 @@ func (global *HANAGlobalParameters) MakeFirewalldService(def *HANAServiceDefinit
 	}
 
 	svc = FirewalldService{
-		ShortName:   serviceShortName,
-		Description: def.FileBaseName,
+		ShortName:   def.ShortDescription,
+		Description: def.Description,
 		Ports:       ports,
 	}
+	if svc.ShortName == "" {
+		svc.ShortName = serviceShortName
+	}
+	if svc.Description == "" {
+		svc.Description = def.FileBaseName
+	}
+	return
+}
+
+/*
+MakeHANAServiceDefinition works the opposite way of MakeFirewalldService, it creates a HANA service definition from a
+firewalld service definition by putting instance number placeholders back into the port numbers.
+*/
+func (global *HANAGlobalParameters) MakeHANAServiceDefinition(name string, svc *FirewalldService) (def HANAServiceDefinition) {
+	tcpPorts := make([]int, 0, len(svc.Ports))
+	udpPorts := make([]int, 0, len(svc.Ports))
+	for _, port := range svc.Ports {
+		switch port.Protocol {
+		case FirewalldProtocolTCP:
+			tcpPorts = append(tcpPorts, port.Port)
+		case FirewalldProtocolUDP:
+			udpPorts = append(udpPorts, port.Port)
+		}
+	}
+	def = HANAServiceDefinition{
+		FileBaseName:     name,
+		ShortDescription: svc.ShortName,
+		Description:      svc.Description,
+		TCP:              global.GuessPortDefinitions(tcpPorts),
+		UDP:              global.GuessPortDefinitions(udpPorts),
+	}
 	return
 }
 
+/*
+GuessPortDefinitions turns actual port numbers into port definitions that may include instance number placeholders.
+Following the HANA port numbering convention, the instance number is expected to appear in the 2nd and 3rd digit of a
+5-digit port (e.g. 3xx13), or in the last two digits of a 4-digit port (e.g. 80xx). A placeholder is only put in place
+if the port numbers of all configured instance numbers are present, otherwise the port number is retained as-is.
+Consecutive port numbers are kept together as a range, such as "3__INST_NUM__40-3__INST_NUM__99" or "51000-51500".
+*/
+func (global *HANAGlobalParameters) GuessPortDefinitions(ports []int) []string {
+	all := make(map[int]struct{})
+	for _, port := range ports {
+		all[port] = struct{}{}
+	}
+	covered := make(map[int]struct{})
+	ret := make([]string, 0, len(all))
+	for {
+		remaining := make([]int, 0, len(all))
+		for port := range all {
+			if _, isCovered := covered[port]; !isCovered {
+				remaining = append(remaining, port)
+			}
+		}
+		if len(remaining) == 0 {
+			return ret
+		}
+		portRange := FoldPortRanges(remaining)[0]
+		portDefinition, expandedPorts := global.guessPortDefinition(portRange, all)
+		for _, expanded := range expandedPorts {
+			covered[expanded] = struct{}{}
+		}
+		ret = append(ret, portDefinition)
+	}
+}
+
+// portCandidate is a port definition with an instance number placeholder that may yield a port number.
+type portCandidate struct {
+	Key        string // Key identifies the placeholder and instance number that yield the port number.
+	Definition string
+}
+
+// placeholderCandidates returns the port definitions with an instance number placeholder that may yield the port.
+func (global *HANAGlobalParameters) placeholderCandidates(port int) []portCandidate {
+	portStr := strconv.Itoa(port)
+	var pos int
+	switch len(portStr) {
+	case 5:
+		pos = 1
+	case 4:
+		pos = 2
+	default:
+		return nil
+	}
+	candidates := make([]portCandidate, 0, 2*len(global.InstanceNumbers))
+	for _, magic := range []string{InstanceNumberSubstitutionMagic, InstanceNumberPlusOneSubstitutionMagic} {
+		for _, instNumStr := range global.InstanceNumbers {
+			instNum, err := strconv.Atoi(instNumStr)
+			if err != nil {
+				continue
+			}
+			if magic == InstanceNumberPlusOneSubstitutionMagic {
+				instNum++
+			}
+			if portStr[pos:pos+2] == fmt.Sprintf("%.2d", instNum) {
+				candidates = append(candidates, portCandidate{Key: magic + instNumStr, Definition: portStr[:pos] + magic + portStr[pos+2:]})
+			}
+		}
+	}
+	return candidates
+}
+
+/*
+guessPortDefinition returns a port definition for the range of consecutive ports, along with all port numbers covered
+by the definition. If the range cannot be expressed by placeholders as a whole, its first port may still be, otherwise
+the range is retained as-is.
+*/
+func (global *HANAGlobalParameters) guessPortDefinition(portRange PortRange, all map[int]struct{}) (string, []int) {
+	tries := make([]string, 0, 4)
+	for _, first := range global.placeholderCandidates(portRange.First) {
+		if portRange.Last == portRange.First {
+			tries = append(tries, first.Definition)
+			continue
+		}
+		for _, last := range global.placeholderCandidates(portRange.Last) {
+			if last.Key == first.Key {
+				tries = append(tries, first.Definition+"-"+last.Definition)
+			}
+		}
+	}
+	if portRange.Last != portRange.First {
+		for _, first := range global.placeholderCandidates(portRange.First) {
+			tries = append(tries, first.Definition)
+		}
+	}
+	for _, candidate := range tries {
+		expandedPorts, err := global.GetPortNumbers(candidate)
+		if err != nil {
+			continue
+		}
+		allPresent := true
+		for _, expanded := range expandedPorts {
+			if _, present := all[expanded]; !present {
+				allPresent = false
+				break
+			}
+		}
+		if allPresent {
+			return candidate, expandedPorts
+		}
+	}
+	literal := make([]int, 0, portRange.Last-portRange.First+1)
+	for port := portRange.First; port <= portRange.Last; port++ {
+		literal = append(literal, port)
+	}
+	return portRange.String(), literal
+}
+
 // UniqueSortedInts returns unique integers among the input, sorted in ascending order.
 func UniqueSortedInts(in []int) (out []int) {
 	uniq := map[int]struct{}{}
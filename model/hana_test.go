@@ -127,6 +127,32 @@ UDP="4000 4001"
 	}
 }
 
+func TestValidateDefinitionName(t *testing.T) {
+	for _, name := range []string{"HANA database client", "MY_SERVICE", "Tools (c++)", "a-b"} {
+		if err := ValidateDefinitionName(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"", " leading space", "a/b", "a.b", "-a", "a\tb", "a:b"} {
+		if err := ValidateDefinitionName(name); err == nil {
+			t.Fatal(name)
+		}
+	}
+}
+
+func TestHANAGlobalParameters_RejectsDefinitionSymlinks(t *testing.T) {
+	for policy, want := range map[string]bool{"": false, "follow": false, "reject": true} {
+		global := HANAGlobalParameters{DefinitionSymlinks: policy}
+		if reject, err := global.RejectsDefinitionSymlinks(); err != nil || reject != want {
+			t.Fatal(policy, reject, err)
+		}
+	}
+	global := HANAGlobalParameters{DefinitionSymlinks: "ignore"}
+	if _, err := global.RejectsDefinitionSymlinks(); err == nil {
+		t.Fatal("did not error")
+	}
+}
+
 func TestHANAServiceDefinition_GetShortName(t *testing.T) {
 	def := HANAServiceDefinition{FileBaseName: "/a?V&XDFn9_QW_.{:}|"}
 	name := def.GetShortName()
@@ -142,3 +168,194 @@ func TestUniqueSortedInts(t *testing.T) {
 		t.Fatal(out)
 	}
 }
+
+func TestMakeHANAServiceDefinition(t *testing.T) {
+	global := HANAGlobalParameters{InstanceNumbers: []string{"00", "02"}}
+	svc := FirewalldService{
+		ShortName: "Imported",
+		Ports: []FirewalldPort{
+			// Both instances are present, hence placeholders are restored.
+			{Protocol: "tcp", Port: 30013}, {Protocol: "tcp", Port: 30213},
+			{Protocol: "tcp", Port: 8000}, {Protocol: "tcp", Port: 8002},
+			{Protocol: "tcp", Port: 30101}, {Protocol: "tcp", Port: 30301},
+			// Only one instance is present, the port number is retained.
+			{Protocol: "tcp", Port: 30015},
+			// Ports that do not follow the convention.
+			{Protocol: "tcp", Port: 1128}, {Protocol: "udp", Port: 161},
+			// Ranges are kept together.
+			{Protocol: "tcp", Port: 30040}, {Protocol: "tcp", Port: 30041}, {Protocol: "tcp", Port: 30042},
+			{Protocol: "tcp", Port: 30240}, {Protocol: "tcp", Port: 30241}, {Protocol: "tcp", Port: 30242},
+			{Protocol: "udp", Port: 51000}, {Protocol: "udp", Port: 51001}, {Protocol: "udp", Port: 51002},
+		},
+	}
+	def := global.MakeHANAServiceDefinition("Imported", &svc)
+	match := HANAServiceDefinition{
+		FileBaseName:     "Imported",
+		ShortDescription: "Imported",
+		TCP:              []string{"1128", "80__INST_NUM__", "3__INST_NUM__13", "30015", "3__INST_NUM__40-3__INST_NUM__42", "3__INST_NUM+1__01"},
+		UDP:              []string{"161", "51000-51002"},
+	}
+	if !reflect.DeepEqual(def, match) {
+		t.Fatalf("\n%+v\n%+v\n", def, match)
+	}
+	// The definition must expand back into the same ports
+	_, roundTrip, err := global.MakeFirewalldService(&def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roundTrip.Ports) != len(svc.Ports) {
+		t.Fatalf("%+v", roundTrip)
+	}
+}
+
+func TestHANAGlobalParameters_ValidateDefinition(t *testing.T) {
+	var global HANAGlobalParameters
+	valid := HANAServiceDefinition{FileBaseName: "a", TCP: []string{"3__INST_NUM__13", "4__INST_NUM+1__01"}}
+	if err := global.ValidateDefinition(&valid); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []HANAServiceDefinition{
+		{FileBaseName: "empty"},
+		{FileBaseName: "typo", TCP: []string{"3__INSTNUM__13"}},
+		{FileBaseName: "range", UDP: []string{"7__INST_NUM__00"}},
+		{FileBaseName: "zero", UDP: []string{"0"}},
+	} {
+		if err := global.ValidateDefinition(&invalid); err == nil {
+			t.Fatalf("%+v", invalid)
+		}
+	}
+	// Port ranges and versions are validated as well
+	for _, def := range []HANAServiceDefinition{
+		{FileBaseName: "backwards", TCP: []string{"3__INST_NUM__33-3__INST_NUM__30"}},
+		{FileBaseName: "version", TCP: []string{"1"}, MinHANAVersion: "2.00 SPS05"},
+		{FileBaseName: "version range", TCP: []string{"1"}, MinHANAVersion: "2.00", MaxHANAVersion: "1.00"},
+	} {
+		if err := global.ValidateDefinition(&def); err == nil {
+			t.Fatalf("%+v", def)
+		}
+	}
+	ranged := HANAServiceDefinition{FileBaseName: "range", TCP: []string{"3__INST_NUM__30-3__INST_NUM__32", "51000-51001"}}
+	if _, svc, err := (&HANAGlobalParameters{InstanceNumbers: []string{"00"}}).MakeFirewalldService(&ranged); err != nil || len(svc.Ports) != 5 || svc.Ports[2].Port != 30032 {
+		t.Fatal(svc.Ports, err)
+	}
+	// Validation uses the configured instance numbers
+	global.InstanceNumbers = []string{"99"}
+	if err := global.ValidateDefinition(&valid); err == nil {
+		t.Fatal("did not error")
+	}
+}
+
+func TestHANAServiceDefinition_Descriptions(t *testing.T) {
+	sample := `# HANA cockpit
+# More information may be found in the SAP knowledge base article 2389709.
+
+TCP="51021 51023"
+`
+	conf, err := txtparser.ParseSysconfig(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := HANAServiceDefinition{FileBaseName: "HANA cockpit"}
+	def.ReadFrom(conf)
+	if def.ShortDescription != "HANA cockpit" || def.Description != "More information may be found in the SAP knowledge base article 2389709." {
+		t.Fatalf("%+v", def)
+	}
+	_, svc, err := globalParams.MakeFirewalldService(&def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.ShortName != def.ShortDescription || svc.Description != def.Description {
+		t.Fatalf("%+v", svc)
+	}
+
+	// Keys take precedence over comments
+	conf.Set(HANAServiceDefinitionDescriptionKey, "Administration of HANA via web browser")
+	def.ReadFrom(conf)
+	if def.ShortDescription != "HANA cockpit" || def.Description != "Administration of HANA via web browser" {
+		t.Fatalf("%+v", def)
+	}
+
+	// Only a changed description is written as key
+	def.ShortDescription = "Cockpit"
+	def.WriteInto(conf)
+	match := `# HANA cockpit
+# More information may be found in the SAP knowledge base article 2389709.
+
+TCP="51021 51023"
+DESCRIPTION="Administration of HANA via web browser"
+SHORT_DESCRIPTION="Cockpit"
+UDP=""
+`
+	if s := conf.ToText(); s != match {
+		t.Fatalf("\n%s\n%s\n", s, match)
+	}
+
+	// Comments that tell where the definition comes from are not descriptions
+	for _, sample := range []string{
+		"# " + DefinitionImportedComment + "/tmp/cockpit.xml\n\nTCP=\"51021\"\n",
+		"# HANA cockpit\n# " + DefinitionMigratedComment + "/etc/hana-firewall.d/HANA cockpit\n\nTCP=\"51021\"\n",
+	} {
+		conf, err := txtparser.ParseSysconfig(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		def := HANAServiceDefinition{FileBaseName: "HANA cockpit"}
+		def.ReadFrom(conf)
+		if def.ShortDescription != "" && def.ShortDescription != "HANA cockpit" || def.Description != "" {
+			t.Fatalf("%+v", def)
+		}
+	}
+}
+
+func TestHANAGlobalParameters_ExpandINIPlaceholders(t *testing.T) {
+	globalINI, err := txtparser.ParseINI(`[communication]
+sqlport = 3$(SAPSYSTEM)41
+[system_replication]
+port_offset = 200
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global := HANAGlobalParameters{InstanceNumbers: []string{"00", "10"}}
+	global.Systems = []HANASystem{
+		{SID: "PRD", InstanceNumber: "00", Config: map[string]*txtparser.INI{"global.ini": globalINI}},
+		{SID: "QAS", InstanceNumber: "10"},
+	}
+	// Configured value is used for instance 00, the default for instance 10
+	ports, err := global.GetPortNumbers("__INI:global.ini:communication:sqlport:3$(SAPSYSTEM)15__")
+	if err != nil || !reflect.DeepEqual(ports, []int{30041, 31015}) {
+		t.Fatal(ports, err)
+	}
+	// Placeholders mix with instance number placeholders
+	if expanded, err := global.ExpandINIPlaceholders("4__INI:global.ini:system_replication:port_offset:100__", "00"); err != nil || expanded != "4200" {
+		t.Fatal(expanded, err)
+	}
+	if expanded, err := global.ExpandINIPlaceholders("3__INST_NUM__15", "00"); err != nil || expanded != "3__INST_NUM__15" {
+		t.Fatal(expanded, err)
+	}
+	// The default may contain colons
+	if expanded, err := global.ExpandINIPlaceholders("__INI:global.ini:communication:listenaddress:[::1]:3$(SAPSYSTEM)00__", "10"); err != nil || expanded != "[::1]:31000" {
+		t.Fatal(expanded, err)
+	}
+	// Each tenant database expands the placeholders with its own configuration, and the ports of all of them are used
+	tenantINI, err := txtparser.ParseINI("[communication]\nsqlport = 3$(SAPSYSTEM)44\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Systems[0].TenantConfig = map[string]map[string]*txtparser.INI{
+		"TEN": {"global.ini": tenantINI},
+		"TWO": {"global.ini": globalINI},
+	}
+	ports, err = global.GetPortNumbers("__INI:global.ini:communication:sqlport:3$(SAPSYSTEM)15__")
+	if err != nil || !reflect.DeepEqual(ports, []int{30041, 30044, 31015}) {
+		t.Fatal(ports, err)
+	}
+	// A value that is neither configured nor given a default is an error
+	if _, err := global.GetPortNumbers("__INI:global.ini:communication:sqlport__"); err == nil {
+		t.Fatal("did not error")
+	}
+	def := HANAServiceDefinition{FileBaseName: "missing", TCP: []string{"__INI:nameserver.ini:communication:listenport__"}}
+	if err := global.ValidateDefinition(&def); err == nil {
+		t.Fatal("did not error")
+	}
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"strings"
+)
+
+// HANASystem is a HANA system installed on this host.
+type HANASystem struct {
+	SID            string
+	InstanceNumber string
+	Hosts          []string // Hosts that run the HANA system, there is more than one host in a scale-out system.
+	// Config is INI file name (such as global.ini) vs the custom configuration of the system.
+	Config map[string]*txtparser.INI
+	// TenantConfig is tenant database name vs INI file name vs the custom configuration of the tenant database, which
+	// includes the configuration of the system.
+	TenantConfig map[string]map[string]*txtparser.INI
+	// Version of the installed HANA software, it is empty if the version is unknown.
+	Version HANAVersion
+	// VirtualHost is the SAPLOCALHOST of the instance profile, it is empty if the instance uses the host name.
+	VirtualHost string
+	// VirtualAddresses are the IP addresses that the virtual host name resolves to.
+	VirtualAddresses []string
+}
+
+// GetSystem returns the discovered HANA system of the instance number, or nil if there is none.
+func (global *HANAGlobalParameters) GetSystem(instanceNumber string) *HANASystem {
+	for i, system := range global.Systems {
+		if system.InstanceNumber == instanceNumber {
+			return &global.Systems[i]
+		}
+	}
+	return nil
+}
+
+/*
+UseDiscoveredSystems remembers HANA systems discovered on this host. The configured instance numbers are left as they
+are, callers that wish to fall back to the discovered ones use DiscoveredInstanceNumbers.
+*/
+func (global *HANAGlobalParameters) UseDiscoveredSystems(systems []HANASystem) {
+	global.Systems = systems
+}
+
+// DiscoveredInstanceNumbers returns the instance numbers of the discovered HANA systems.
+func (global *HANAGlobalParameters) DiscoveredInstanceNumbers() []string {
+	instanceNumbers := make([]string, 0, len(global.Systems))
+	for _, system := range global.Systems {
+		instanceNumbers = append(instanceNumbers, system.InstanceNumber)
+	}
+	return UniqueSortedStrings(instanceNumbers)
+}
+
+// GetSIDs returns the configured SIDs, or SIDs of the discovered HANA systems if none is configured.
+func (global *HANAGlobalParameters) GetSIDs() []string {
+	if len(global.SIDs) > 0 {
+		return global.SIDs
+	}
+	sids := make([]string, 0, len(global.Systems))
+	for _, system := range global.Systems {
+		sids = append(sids, system.SID)
+	}
+	return UniqueSortedStrings(sids)
+}
+
+// IsScaleOut returns true if scale-out is configured, or if any discovered HANA system runs on more than one host.
+func (global *HANAGlobalParameters) IsScaleOut() bool {
+	switch global.ScaleOut {
+	case "yes", "true":
+		return true
+	case "no", "false":
+		return false
+	}
+	for _, system := range global.Systems {
+		if len(system.Hosts) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+IsApplicable returns true if the HANA service definition should be turned into firewalld service. If it should not,
+the reason is returned as well.
+*/
+func (global *HANAGlobalParameters) IsApplicable(def *HANAServiceDefinition) (applicable bool, reason string) {
+	if def.Disabled {
+		return false, "the definition is disabled by " + HANAServiceDefinitionEnabledKey
+	}
+	if def.RequiresScaleOut && !global.IsScaleOut() {
+		return false, "the definition requires a scale-out system"
+	}
+	if len(def.OnlyForSIDs) > 0 && !global.hasAnySID(def.OnlyForSIDs) {
+		return false, fmt.Sprintf("the definition is only for SIDs %s, but the SIDs are \"%s\"", strings.Join(def.OnlyForSIDs, " "), strings.Join(global.GetSIDs(), " "))
+	}
+	return global.isApplicableVersion(def)
+}
+
+// hasAnySID returns true if any of the SIDs is present, regardless of case.
+func (global *HANAGlobalParameters) hasAnySID(want []string) bool {
+	for _, wantSID := range want {
+		for _, sid := range global.GetSIDs() {
+			if strings.EqualFold(wantSID, sid) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+isApplicableVersion returns true if any discovered HANA system runs a HANA version that uses the service. If the
+versions of the systems are unknown, the definition is applicable regardless.
+*/
+func (global *HANAGlobalParameters) isApplicableVersion(def *HANAServiceDefinition) (applicable bool, reason string) {
+	if def.MinHANAVersion == "" && def.MaxHANAVersion == "" {
+		return true, ""
+	}
+	min, max, err := def.GetHANAVersionRange()
+	if err != nil {
+		return false, err.Error()
+	}
+	versions := make([]string, 0, len(global.Systems))
+	for _, system := range global.Systems {
+		if len(system.Version) == 0 {
+			continue
+		}
+		if system.Version.IsWithin(min, max) {
+			return true, ""
+		}
+		versions = append(versions, system.Version.String())
+	}
+	if len(versions) == 0 {
+		return true, ""
+	}
+	wanted := "HANA version " + def.MinHANAVersion + " or newer"
+	if def.MinHANAVersion == "" {
+		wanted = "HANA version " + def.MaxHANAVersion + " or older"
+	} else if def.MaxHANAVersion != "" {
+		wanted = "HANA versions " + def.MinHANAVersion + " to " + def.MaxHANAVersion
+	}
+	return false, fmt.Sprintf("the definition is only for %s, but the installed versions are \"%s\"", wanted, strings.Join(UniqueSortedStrings(versions), " "))
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHANAGlobalParameters_UseDiscoveredSystems(t *testing.T) {
+	global := HANAGlobalParameters{}
+	global.UseDiscoveredSystems([]HANASystem{
+		{SID: "QAS", InstanceNumber: "10", Hosts: []string{"hana1"}},
+		{SID: "PRD", InstanceNumber: "00", Hosts: []string{"hana1", "hana2"}},
+	})
+	// Instance numbers are only discovered on request
+	if len(global.InstanceNumbers) != 0 || !reflect.DeepEqual(global.DiscoveredInstanceNumbers(), []string{"00", "10"}) ||
+		!reflect.DeepEqual(global.GetSIDs(), []string{"PRD", "QAS"}) {
+		t.Fatalf("%+v", global)
+	}
+	if !global.IsScaleOut() {
+		t.Fatal("should be scale-out")
+	}
+	// Configuration takes precedence over discovery
+	global = HANAGlobalParameters{InstanceNumbers: []string{"01"}, SIDs: []string{"DEV"}, ScaleOut: "no"}
+	global.UseDiscoveredSystems([]HANASystem{{SID: "PRD", InstanceNumber: "00", Hosts: []string{"hana1", "hana2"}}})
+	if !reflect.DeepEqual(global.InstanceNumbers, []string{"01"}) || !reflect.DeepEqual(global.GetSIDs(), []string{"DEV"}) || global.IsScaleOut() {
+		t.Fatalf("%+v", global)
+	}
+}
+
+func TestHANAGlobalParameters_IsApplicable(t *testing.T) {
+	global := HANAGlobalParameters{SIDs: []string{"PRD"}, ScaleOut: "no"}
+	for _, def := range []HANAServiceDefinition{
+		{FileBaseName: "plain"},
+		{FileBaseName: "sid", OnlyForSIDs: []string{"QAS", "prd"}},
+	} {
+		if ok, reason := global.IsApplicable(&def); !ok {
+			t.Fatal(def, reason)
+		}
+	}
+	for _, def := range []HANAServiceDefinition{
+		{FileBaseName: "disabled", Disabled: true},
+		{FileBaseName: "scale-out", RequiresScaleOut: true},
+		{FileBaseName: "sid", OnlyForSIDs: []string{"QAS"}},
+	} {
+		if ok, reason := global.IsApplicable(&def); ok || reason == "" {
+			t.Fatal(def)
+		}
+	}
+}
+
+func TestHANAGlobalParameters_IsApplicableVersion(t *testing.T) {
+	hana1 := HANAServiceDefinition{FileBaseName: "hana1", MaxHANAVersion: "1.00"}
+	xsa := HANAServiceDefinition{FileBaseName: "xsa", MinHANAVersion: "1.00.110"}
+	// Versions are unknown
+	global := HANAGlobalParameters{Systems: []HANASystem{{SID: "PRD", InstanceNumber: "00"}}}
+	if ok, _ := global.IsApplicable(&hana1); !ok {
+		t.Fatal("should be applicable")
+	}
+	global.Systems[0].Version = HANAVersion{2, 0, 59, 0}
+	if ok, reason := global.IsApplicable(&hana1); ok || reason != `the definition is only for HANA version 1.00 or older, but the installed versions are "2.00.059.00"` {
+		t.Fatal(reason)
+	}
+	if ok, reason := global.IsApplicable(&xsa); !ok {
+		t.Fatal(reason)
+	}
+	// Any system of a suitable version makes the definition applicable
+	global.Systems = append(global.Systems, HANASystem{SID: "OLD", InstanceNumber: "10", Version: HANAVersion{1, 0, 122, 33}})
+	if ok, reason := global.IsApplicable(&hana1); !ok {
+		t.Fatal(reason)
+	}
+	invalid := HANAServiceDefinition{FileBaseName: "invalid", MinHANAVersion: "SPS05"}
+	if ok, reason := global.IsApplicable(&invalid); ok || reason == "" {
+		t.Fatal("should not be applicable")
+	}
+	// The version is checked even if the SID matches
+	global.Systems = []HANASystem{{SID: "PRD", InstanceNumber: "00", Version: HANAVersion{2, 0, 59, 0}}}
+	sidAndVersion := HANAServiceDefinition{FileBaseName: "sid-hana1", OnlyForSIDs: []string{"PRD"}, MaxHANAVersion: "1.00"}
+	if ok, reason := global.IsApplicable(&sidAndVersion); ok || !strings.Contains(reason, "HANA version") {
+		t.Fatal(reason)
+	}
+	sidAndVersion.MaxHANAVersion = ""
+	sidAndVersion.MinHANAVersion = "2.00"
+	if ok, reason := global.IsApplicable(&sidAndVersion); !ok {
+		t.Fatal(reason)
+	}
+}
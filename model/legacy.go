@@ -0,0 +1,230 @@
+package model
+
+import (
+	"fmt"
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+The configuration format of hana-firewall 1.x (SLES 12) is a sysconfig file that looks like:
+
+	HANA_SYSTEMS="HDB00 ABC01"
+	INTERFACE_0="eth0"
+	INTERFACE_0_SERVICES="HANA_* ssh"
+	INTERFACE_1="eth1"
+	INTERFACE_1_SERVICES="HANA_SYSTEM_REPLICATION:HDB00"
+	OPEN_ALL_SSH="yes"
+	ENABLE_LOGGING="no"
+
+Custom service definitions are located in /etc/hana-firewall.d, they carry the same TCP and UDP keys as 2.x definitions.
+*/
+const (
+	LegacyHANASystemsKey = "HANA_SYSTEMS"
+	LegacyOpenAllSSHKey  = "OPEN_ALL_SSH"
+	LegacyAllHANAService = "HANA_*"
+	LegacyZonePrefix     = "hana-"
+	// FirewalldZoneNameMaxLen is the maximum length of a zone name accepted by firewalld.
+	FirewalldZoneNameMaxLen = 17
+)
+
+var (
+	legacyInterfaceKey = regexp.MustCompile(`^INTERFACE_([0-9]+)$`)
+	legacyHANASystem   = regexp.MustCompile(`^([A-Z][A-Z0-9]{2})([0-9]{2})$`)
+
+	/*
+		LegacyServiceNames maps service names of hana-firewall 1.x to the file base name of corresponding service
+		definitions shipped with 2.x.
+	*/
+	LegacyServiceNames = map[string]string{
+		"HANA_DATABASE_CLIENT":              "HANA database client",
+		"HANA_DATA_PROVISIONING":            "HANA data provisioning",
+		"HANA_HTTP_CLIENT_ACCESS":           "HANA HTTP web access",
+		"HANA_SAP_SUPPORT":                  "SAP special support",
+		"HANA_STUDIO_LIFECYCLE_MANAGER":     "SAP host agent",
+		"HANA_SYSTEM_REPLICATION":           "HANA internal system replication",
+		"HANA_DISTRIBUTED_SYSTEMS":          "HANA internal distributed communication",
+		"HANA_COCKPIT":                      "HANA cockpit",
+		"SAP_SOFTWARE_PROVISIONING_MANAGER": "SAP software provisioning manager",
+	}
+)
+
+// LegacySystem is a HANA system identified by its SID and instance number.
+type LegacySystem struct {
+	SID            string
+	InstanceNumber string
+}
+
+// LegacyInterface is a network interface and the service names allowed on it.
+type LegacyInterface struct {
+	Key      string // Key is the sysconfig key that names the interface, e.g. INTERFACE_0.
+	Name     string
+	Services []string
+}
+
+// LegacyConfiguration is the content of /etc/sysconfig/hana-firewall written for hana-firewall 1.x.
+type LegacyConfiguration struct {
+	Systems    []LegacySystem
+	Interfaces []LegacyInterface
+	OpenAllSSH bool
+	Report     []string // Report explains the settings that could not be understood.
+}
+
+// ReadFrom reads 1.x configuration from a sysconfig-style text file. Settings that are not understood go into Report.
+func (legacy *LegacyConfiguration) ReadFrom(txt *txtparser.Sysconfig) {
+	legacy.Systems = make([]LegacySystem, 0, 4)
+	legacy.Interfaces = make([]LegacyInterface, 0, 4)
+	legacy.Report = make([]string, 0, 4)
+	for _, system := range txt.GetStringArray(LegacyHANASystemsKey, []string{}) {
+		if match := legacyHANASystem.FindStringSubmatch(strings.ToUpper(system)); match != nil {
+			legacy.Systems = append(legacy.Systems, LegacySystem{SID: match[1], InstanceNumber: match[2]})
+		} else {
+			legacy.Report = append(legacy.Report, fmt.Sprintf("%s: \"%s\" is not a valid SID and instance number (e.g. HDB00)", LegacyHANASystemsKey, system))
+		}
+	}
+	legacy.OpenAllSSH = txt.GetBool(LegacyOpenAllSSHKey, false)
+	for _, entry := range txt.AllValues {
+		switch {
+		case legacyInterfaceKey.MatchString(entry.Key):
+			if name := txt.GetString(entry.Key, ""); name != "" {
+				legacy.Interfaces = append(legacy.Interfaces, LegacyInterface{
+					Key:      entry.Key,
+					Name:     name,
+					Services: txt.GetStringArray(entry.Key+"_SERVICES", []string{}),
+				})
+			}
+		case entry.Key == LegacyHANASystemsKey || entry.Key == LegacyOpenAllSSHKey:
+		case strings.HasSuffix(entry.Key, "_SERVICES") && legacyInterfaceKey.MatchString(strings.TrimSuffix(entry.Key, "_SERVICES")):
+		case HANAGlobalParametersSchema.IsKnown(entry.Key):
+			// 2.x settings are already in place
+		default:
+			if entry.Value != "" {
+				legacy.Report = append(legacy.Report, fmt.Sprintf("%s=\"%s\": there is no equivalent setting in hana-firewall 2.x", entry.Key, entry.Value))
+			}
+		}
+	}
+}
+
+// LegacyMigration is the outcome of migrating 1.x configuration to 2.x.
+type LegacyMigration struct {
+	InstanceNumbers []string                 // InstanceNumbers of all HANA systems.
+	SIDs            []string                 // SIDs of all HANA systems.
+	Zones           map[string]FirewalldZone // Zones are zone name vs firewalld zone that binds interfaces to generated services.
+	Report          []string                 // Report explains the settings that could not be carried over.
+}
+
+/*
+RemoveLegacySettings removes the settings of 1.x, which are all keys unknown to 2.x, from the sysconfig file that is
+shared by both versions, and returns the removed keys.
+*/
+func RemoveLegacySettings(txt *txtparser.Sysconfig) (removed []string) {
+	removed = make([]string, 0, 8)
+	for _, entry := range txt.AllValues {
+		if !HANAGlobalParametersSchema.IsKnown(entry.Key) {
+			removed = append(removed, entry.Key)
+		}
+	}
+	for _, key := range removed {
+		txt.Delete(key)
+	}
+	return
+}
+
+/*
+Migrate turns 1.x configuration into 2.x global parameters and firewalld zones. Definitions are the 2.x HANA service
+definitions, including those migrated from 1.x custom services, they are used to resolve the service names allowed on
+each interface. An error is returned if two interfaces would end up in the same zone, because the zone names had to be
+shortened.
+*/
+func (legacy *LegacyConfiguration) Migrate(definitions []HANAServiceDefinition) (ret LegacyMigration, err error) {
+	ret = LegacyMigration{
+		InstanceNumbers: make([]string, 0, len(legacy.Systems)),
+		SIDs:            make([]string, 0, len(legacy.Systems)),
+		Zones:           make(map[string]FirewalldZone),
+		Report:          append([]string{}, legacy.Report...),
+	}
+	for _, system := range legacy.Systems {
+		ret.InstanceNumbers = append(ret.InstanceNumbers, system.InstanceNumber)
+		ret.SIDs = append(ret.SIDs, system.SID)
+	}
+	ret.InstanceNumbers = UniqueSortedStrings(ret.InstanceNumbers)
+	ret.SIDs = UniqueSortedStrings(ret.SIDs)
+	zoneKeys := make(map[string]string)
+	for _, iface := range legacy.Interfaces {
+		serviceNames := make([]string, 0, len(iface.Services))
+		for _, legacyService := range iface.Services {
+			// A service may be restricted to a single HANA system, e.g. HANA_DATABASE_CLIENT:HDB00
+			if colon := strings.IndexRune(legacyService, ':'); colon != -1 {
+				ret.Report = append(ret.Report, fmt.Sprintf("%s_SERVICES: \"%s\" is allowed for all HANA systems, because 2.x cannot restrict a service to a single system", iface.Key, legacyService))
+				legacyService = legacyService[:colon]
+			}
+			names := legacyServiceToFirewalld(legacyService, definitions)
+			if len(names) == 0 {
+				names = []string{strings.ToLower(legacyService)}
+				ret.Report = append(ret.Report, fmt.Sprintf("%s_SERVICES: \"%s\" is not a HANA service, it is assumed to be firewalld service \"%s\"", iface.Key, legacyService, names[0]))
+			}
+			serviceNames = append(serviceNames, names...)
+		}
+		if legacy.OpenAllSSH {
+			serviceNames = append(serviceNames, "ssh")
+		}
+		zoneName := LegacyZonePrefix + iface.Name
+		if len(zoneName) > FirewalldZoneNameMaxLen {
+			zoneName = zoneName[:FirewalldZoneNameMaxLen]
+		}
+		if otherKey, exists := zoneKeys[zoneName]; exists {
+			return ret, &ValidationError{Source: iface.Key, Value: iface.Name, Message: fmt.Sprintf("the zone name \"%s\" is shortened to the same as that of %s, please rename the interface", zoneName, otherKey)}
+		}
+		zoneKeys[zoneName] = iface.Key
+		ret.Zones[zoneName] = FirewalldZone{
+			ShortName:   zoneName,
+			Description: fmt.Sprintf("Migrated from hana-firewall 1.x setting %s", iface.Key),
+			Interfaces:  MakeFirewalldNameRefs([]string{iface.Name}),
+			Services:    MakeFirewalldNameRefs(UniqueSortedStrings(serviceNames)),
+		}
+	}
+	return
+}
+
+/*
+isLegacyHANAService returns true if the definition is one of the HANA services of 1.x, which are those matched by
+LegacyAllHANAService: the built-in HANA services, and custom services whose names start with "HANA_".
+*/
+func isLegacyHANAService(def *HANAServiceDefinition) bool {
+	if strings.HasPrefix(def.FileBaseName, "HANA_") {
+		return true
+	}
+	for legacyName, baseName := range LegacyServiceNames {
+		if strings.HasPrefix(legacyName, "HANA_") && def.FileBaseName == baseName {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyServiceToFirewalld returns the names of generated firewalld services that correspond to the 1.x service name.
+func legacyServiceToFirewalld(legacyService string, definitions []HANAServiceDefinition) []string {
+	ret := make([]string, 0, len(definitions))
+	for _, def := range definitions {
+		if (legacyService == LegacyAllHANAService && isLegacyHANAService(&def)) || def.FileBaseName == legacyService || def.FileBaseName == LegacyServiceNames[legacyService] {
+			ret = append(ret, def.GetShortName())
+		}
+	}
+	return ret
+}
+
+// UniqueSortedStrings returns unique strings among the input, sorted in ascending order.
+func UniqueSortedStrings(in []string) (out []string) {
+	uniq := map[string]struct{}{}
+	for _, s := range in {
+		uniq[s] = struct{}{}
+	}
+	out = make([]string, 0, len(uniq))
+	for s := range uniq {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"reflect"
+	"testing"
+)
+
+func TestLegacyConfiguration(t *testing.T) {
+	sample := `## Path:        Network/Firewall/HANA Firewall
+HANA_SYSTEMS="HDB00 abc01 BAD"
+INTERFACE_0="eth0"
+INTERFACE_0_SERVICES="HANA_* ssh"
+INTERFACE_1="eth1"
+INTERFACE_1_SERVICES="HANA_SYSTEM_REPLICATION:HDB00 MY_SERVICE"
+INTERFACE_2=""
+OPEN_ALL_SSH="yes"
+ENABLE_LOGGING="yes"
+`
+	conf, err := txtparser.ParseSysconfig(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy LegacyConfiguration
+	legacy.ReadFrom(conf)
+	if !reflect.DeepEqual(legacy.Systems, []LegacySystem{{SID: "HDB", InstanceNumber: "00"}, {SID: "ABC", InstanceNumber: "01"}}) {
+		t.Fatalf("%+v", legacy.Systems)
+	}
+	if len(legacy.Interfaces) != 2 || !legacy.OpenAllSSH {
+		t.Fatalf("%+v", legacy)
+	}
+
+	definitions := []HANAServiceDefinition{
+		{FileBaseName: "HANA database client", TCP: []string{"3__INST_NUM__13"}},
+		{FileBaseName: "HANA internal system replication", TCP: []string{"4__INST_NUM__01"}},
+		{FileBaseName: "MY_SERVICE", TCP: []string{"1234"}},
+		{FileBaseName: "HANA_MY_SERVICE", TCP: []string{"1235"}},
+		{FileBaseName: "SAP host agent", TCP: []string{"1128"}},
+	}
+	migration, err := legacy.Migrate(definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(migration.InstanceNumbers, []string{"00", "01"}) || !reflect.DeepEqual(migration.SIDs, []string{"ABC", "HDB"}) {
+		t.Fatalf("%+v", migration)
+	}
+	match := map[string]FirewalldZone{
+		"hana-eth0": {
+			ShortName:   "hana-eth0",
+			Description: "Migrated from hana-firewall 1.x setting INTERFACE_0",
+			Interfaces:  MakeFirewalldNameRefs([]string{"eth0"}),
+			Services:    MakeFirewalldNameRefs([]string{"hana-database-client", "hana-internal-system-replication", "hana-my-service", "sap-host-agent", "ssh"}),
+		},
+		"hana-eth1": {
+			ShortName:   "hana-eth1",
+			Description: "Migrated from hana-firewall 1.x setting INTERFACE_1",
+			Interfaces:  MakeFirewalldNameRefs([]string{"eth1"}),
+			Services:    MakeFirewalldNameRefs([]string{"hana-internal-system-replication", "my-service", "ssh"}),
+		},
+	}
+	if !reflect.DeepEqual(migration.Zones, match) {
+		t.Fatalf("\n%+v\n%+v\n", migration.Zones, match)
+	}
+	// Invalid system, unsupported logging, assumed firewalld service "ssh", and per-system restriction
+	if len(migration.Report) != 4 {
+		t.Fatalf("%+v", migration.Report)
+	}
+
+	// The 1.x settings are removed from the file shared with 2.x
+	conf.Set(HANAGlobalInstanceNumbersKey, "00 01")
+	if removed := RemoveLegacySettings(conf); len(removed) != 8 || conf.ToText() != "HANA_INSTANCE_NUMBERS=\"00 01\"\n" {
+		t.Fatalf("%+v\n%s", removed, conf.ToText())
+	}
+
+	// Interfaces whose zone names are shortened to the same name cannot be told apart
+	legacy.Interfaces = []LegacyInterface{{Key: "INTERFACE_0", Name: "enp0s31f6-vlan100"}, {Key: "INTERFACE_1", Name: "enp0s31f6-vlan101"}}
+	if _, err := legacy.Migrate(definitions); err == nil {
+		t.Fatal("did not error")
+	}
+}
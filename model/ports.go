@@ -0,0 +1,88 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of port numbers, a single port has the same first and last port.
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// String returns the port number, or the first and last port separated by a dash.
+func (portRange PortRange) String() string {
+	if portRange.First == portRange.Last {
+		return strconv.Itoa(portRange.First)
+	}
+	return strconv.Itoa(portRange.First) + "-" + strconv.Itoa(portRange.Last)
+}
+
+// FoldPortRanges turns port numbers into the fewest ranges that cover exactly those ports, in ascending order.
+func FoldPortRanges(ports []int) []PortRange {
+	ret := make([]PortRange, 0, len(ports))
+	for _, port := range UniqueSortedInts(ports) {
+		if len(ret) > 0 && ret[len(ret)-1].Last == port-1 {
+			ret[len(ret)-1].Last = port
+		} else {
+			ret = append(ret, PortRange{First: port, Last: port})
+		}
+	}
+	return ret
+}
+
+// FormatPortRanges returns the port numbers folded into ranges and separated by space.
+func FormatPortRanges(ports []int) string {
+	ranges := FoldPortRanges(ports)
+	ret := make([]string, 0, len(ranges))
+	for _, portRange := range ranges {
+		ret = append(ret, portRange.String())
+	}
+	return strings.Join(ret, " ")
+}
+
+/*
+PortExpansion explains the port numbers that a port definition yields for a single instance number, and for a single
+tenant database if its configuration yields a different definition than the system's.
+*/
+type PortExpansion struct {
+	InstanceNumber string
+	Tenant         string // Tenant is empty for the configuration of the system.
+	Definition     string // Definition is the port definition after INI placeholders are substituted.
+	Ports          []int
+}
+
+// Contains returns true if the expansion yields the port number.
+func (expansion *PortExpansion) Contains(port int) bool {
+	for _, expanded := range expansion.Ports {
+		if expanded == port {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ExplainPortDefinition expands a port definition of the service definition for each instance number and tenant database
+individually, in the same way as generating firewalld service does.
+*/
+func (global *HANAGlobalParameters) ExplainPortDefinition(def *HANAServiceDefinition, portDefinition string) (ret []PortExpansion, err error) {
+	ret = make([]PortExpansion, 0, len(global.InstanceNumbers))
+	for _, instNumStr := range global.InstanceNumbers {
+		single := *global
+		single.InstanceNumbers = []string{instNumStr}
+		databases, err := global.expandDatabaseINIPlaceholders(portDefinition, instNumStr)
+		if err != nil {
+			return nil, err
+		}
+		for _, database := range databases {
+			expansion := PortExpansion{InstanceNumber: instNumStr, Tenant: database.tenant, Definition: database.definition}
+			if expansion.Ports, err = single.getDefinitionPortNumbers(def, database.definition); err != nil {
+				return nil, err
+			}
+			ret = append(ret, expansion)
+		}
+	}
+	return
+}
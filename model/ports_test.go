@@ -0,0 +1,61 @@
+package model
+
+import (
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"reflect"
+	"testing"
+)
+
+func TestFoldPortRanges(t *testing.T) {
+	ranges := FoldPortRanges([]int{30015, 1128, 30013, 30014, 1129, 30013, 51000})
+	if !reflect.DeepEqual(ranges, []PortRange{{1128, 1129}, {30013, 30015}, {51000, 51000}}) {
+		t.Fatal(ranges)
+	}
+	if s := FormatPortRanges([]int{30015, 1128, 30013, 30014, 1129, 51000}); s != "1128-1129 30013-30015 51000" {
+		t.Fatal(s)
+	}
+	if len(FoldPortRanges(nil)) != 0 {
+		t.Fatal("should be empty")
+	}
+}
+
+func TestHANAGlobalParameters_ExplainPortDefinition(t *testing.T) {
+	global := HANAGlobalParameters{InstanceNumbers: []string{"00", "10"}}
+	expansions, err := global.ExplainPortDefinition(&definition, "3__INST_NUM__30-3__INST_NUM__31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := []PortExpansion{
+		{InstanceNumber: "00", Definition: "3__INST_NUM__30-3__INST_NUM__31", Ports: []int{30030, 30031}},
+		{InstanceNumber: "10", Definition: "3__INST_NUM__30-3__INST_NUM__31", Ports: []int{31030, 31031}},
+	}
+	if !reflect.DeepEqual(expansions, match) || !expansions[1].Contains(31031) || expansions[0].Contains(31031) {
+		t.Fatalf("%+v", expansions)
+	}
+	// Replication definitions use the port offset
+	global.ReplicationPortOffset = 500
+	if expansions, err := global.ExplainPortDefinition(&replicationDefinition, "3__INST_NUM+1__01"); err != nil || expansions[0].Ports[0] != 30501 {
+		t.Fatal(expansions, err)
+	}
+	if _, err := global.ExplainPortDefinition(&definition, "3__INSTNUM__01"); err == nil {
+		t.Fatal("did not error")
+	}
+	// Tenants that configure a different port are explained individually
+	tenantINI, err := txtparser.ParseINI("[sql]\nsqlport = 3$(SAPSYSTEM)44\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Systems = []HANASystem{{SID: "PRD", InstanceNumber: "00", TenantConfig: map[string]map[string]*txtparser.INI{
+		"TEN": {"indexserver.ini": tenantINI},
+		"TWO": {},
+	}}}
+	expansions, err = global.ExplainPortDefinition(&definition, "__INI:indexserver.ini:sql:sqlport:3$(SAPSYSTEM)15__")
+	match = []PortExpansion{
+		{InstanceNumber: "00", Definition: "30015", Ports: []int{30015}},
+		{InstanceNumber: "00", Tenant: "TEN", Definition: "30044", Ports: []int{30044}},
+		{InstanceNumber: "10", Definition: "31015", Ports: []int{31015}},
+	}
+	if err != nil || !reflect.DeepEqual(expansions, match) {
+		t.Fatalf("%+v %v", expansions, err)
+	}
+}
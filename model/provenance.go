@@ -0,0 +1,170 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"strings"
+)
+
+/*
+Provenance tells how a generated file came into being, it is written into the XML comment at the top of the file. It
+does not record the time of generation, so that generating the same configuration again yields identical files.
+*/
+type Provenance struct {
+	Version         string   // Version of hana-firewall that generated the file.
+	Sources         []string // Sources are paths of the files that the content was generated from.
+	InstanceNumbers []string // InstanceNumbers are the HANA instance numbers used for calculating port numbers.
+	Checksum        string   // Checksum is "sha256:" followed by hex digest of the document that follows the comment.
+}
+
+// Names of the provenance fields in the XML comment.
+const (
+	provenanceVersion         = "Version"
+	provenanceSource          = "Source"
+	provenanceInstanceNumbers = "Instance numbers"
+	provenanceChecksum        = "Checksum"
+)
+
+var (
+	/*
+		xmlCommentEscaper percent-encodes double-hyphens, which may not appear in an XML comment, and percent signs, so
+		that xmlCommentUnescaper restores the original text.
+	*/
+	xmlCommentEscaper   = strings.NewReplacer("%", "%25", "--", "%2D%2D")
+	xmlCommentUnescaper = strings.NewReplacer("%2D", "-", "%25", "%")
+)
+
+// Checksum returns the checksum of a document in the format used by Provenance.
+func Checksum(document []byte) string {
+	sum := sha256.Sum256(document)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fields returns the provenance as lines of "Name: value".
+func (prov Provenance) fields() []string {
+	ret := make([]string, 0, 4+len(prov.Sources))
+	ret = append(ret, provenanceVersion+": "+prov.Version)
+	for _, source := range prov.Sources {
+		ret = append(ret, provenanceSource+": "+source)
+	}
+	ret = append(ret, provenanceInstanceNumbers+": "+strings.Join(prov.InstanceNumbers, " "))
+	ret = append(ret, provenanceChecksum+": "+prov.Checksum)
+	return ret
+}
+
+// comment returns the XML comment that carries the ownership marker and provenance.
+func (prov Provenance) comment() string {
+	var out bytes.Buffer
+	out.WriteString("<!-- " + GeneratedFileMarker + "\n")
+	for _, field := range prov.fields() {
+		out.WriteString("     " + xmlCommentEscaper.Replace(field) + "\n")
+	}
+	out.Truncate(out.Len() - 1)
+	out.WriteString(" -->\n")
+	return out.String()
+}
+
+// hashComment returns the comment lines starting with "#" that carry the ownership marker and provenance.
+func (prov Provenance) hashComment() string {
+	var out bytes.Buffer
+	out.WriteString("# " + GeneratedFileMarker + "\n")
+	for _, field := range prov.fields() {
+		out.WriteString("#     " + field + "\n")
+	}
+	return out.String()
+}
+
+/*
+HashCommentedDocumentWithProvenance puts the provenance comment in front of a document whose comments start with "#",
+such as an ufw application profile.
+*/
+func HashCommentedDocumentWithProvenance(document string, prov Provenance) string {
+	prov.Checksum = Checksum([]byte(document))
+	return prov.hashComment() + document
+}
+
+// parseProvenanceFields reads the provenance from lines of "Name: value".
+func parseProvenanceFields(lines []string) (prov Provenance) {
+	for _, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon == -1 {
+			continue
+		}
+		value := strings.TrimSpace(line[colon+1:])
+		switch strings.TrimSpace(line[:colon]) {
+		case provenanceVersion:
+			prov.Version = value
+		case provenanceSource:
+			prov.Sources = append(prov.Sources, value)
+		case provenanceInstanceNumbers:
+			prov.InstanceNumbers = strings.Fields(value)
+		case provenanceChecksum:
+			prov.Checksum = value
+		}
+	}
+	return
+}
+
+// parseHashProvenance reads the provenance comment written by HashCommentedDocumentWithProvenance.
+func parseHashProvenance(content []byte) (prov Provenance, document []byte, found bool) {
+	lines := strings.SplitAfter(string(content), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "# "+GeneratedFileMarker {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && strings.HasPrefix(lines[end], "#") {
+			end++
+		}
+		fieldLines := make([]string, 0, end-i-1)
+		for _, fieldLine := range lines[i+1 : end] {
+			fieldLines = append(fieldLines, strings.TrimPrefix(fieldLine, "#"))
+		}
+		return parseProvenanceFields(fieldLines), []byte(strings.Join(lines[end:], "")), true
+	}
+	return
+}
+
+// xmlDocumentWithProvenance serialises the element into a complete XML document that includes the provenance comment.
+func xmlDocumentWithProvenance(elem interface{}, prov Provenance) string {
+	out, err := xml.MarshalIndent(elem, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	prov.Checksum = Checksum(out)
+	return xml.Header + prov.comment() + string(out)
+}
+
+/*
+ParseProvenance reads the provenance comment of a generated file, and returns the document that follows the comment.
+If the file does not carry the ownership marker, found is false. Files generated by earlier versions of hana-firewall
+carry the marker without provenance, the returned provenance is then empty. Files that are not XML carry the comment in
+lines starting with "#".
+*/
+func ParseProvenance(content []byte) (prov Provenance, document []byte, found bool) {
+	start := bytes.Index(content, []byte("<!-- "+GeneratedFileMarker))
+	if start == -1 {
+		return parseHashProvenance(content)
+	}
+	found = true
+	end := bytes.Index(content[start:], []byte("-->"))
+	if end == -1 {
+		return
+	}
+	end += start
+	document = bytes.TrimPrefix(content[end+len("-->"):], []byte("\n"))
+	prov = parseProvenanceFields(strings.Split(xmlCommentUnescaper.Replace(string(content[start:end])), "\n")[1:])
+	return
+}
+
+/*
+IsModifiedFile returns true if the file was generated by hana-firewall and its document no longer matches the checksum
+recorded in the provenance, which means the file was modified by hand. Files generated without a checksum are never
+considered modified.
+*/
+func IsModifiedFile(content []byte) bool {
+	prov, document, found := ParseProvenance(content)
+	return found && prov.Checksum != "" && prov.Checksum != Checksum(document)
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	svc := FirewalldService{
+		ShortName:   "HANA cockpit",
+		Description: "HANA cockpit",
+		Ports:       []FirewalldPort{{Port: 51021, Protocol: "tcp"}},
+	}
+	prov := Provenance{
+		Version:         "2.0",
+		Sources:         []string{"/etc/hana-firewall/HANA--cockpit 100%"},
+		InstanceNumbers: []string{"00", "01"},
+	}
+	content := svc.ToXMLWithProvenance(prov)
+	if !strings.HasPrefix(content, `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generated by hana-firewall, manual changes will be lost.
+     Version: 2.0
+     Source: /etc/hana-firewall/HANA%2D%2Dcockpit 100%25
+     Instance numbers: 00 01
+     Checksum: sha256:`) || !strings.HasSuffix(content, " -->\n"+svc.ToXML()[strings.Index(svc.ToXML(), "<service>"):]) {
+		t.Fatal(content)
+	}
+	if !IsGeneratedFile([]byte(content)) || IsModifiedFile([]byte(content)) {
+		t.Fatal("should be generated and unmodified")
+	}
+	parsed, document, found := ParseProvenance([]byte(content))
+	prov.Checksum = Checksum(document)
+	if !found || !reflect.DeepEqual(parsed, prov) {
+		t.Fatalf("%+v", parsed)
+	}
+	// Modify the port by hand
+	// The same provenance yields the same content
+	if svc.ToXMLWithProvenance(prov) != content {
+		t.Fatal("should be identical")
+	}
+	if modified := strings.Replace(content, "51021", "51022", 1); !IsModifiedFile([]byte(modified)) {
+		t.Fatal("should be modified")
+	}
+	// Files generated without provenance, and files not generated at all, are never considered modified
+	if IsModifiedFile([]byte(svc.ToXML())) || IsModifiedFile([]byte("<service/>")) {
+		t.Fatal("should not be modified")
+	}
+	if _, _, found := ParseProvenance([]byte("<service/>")); found {
+		t.Fatal("should not be found")
+	}
+}
+
+func TestHashCommentedDocumentWithProvenance(t *testing.T) {
+	prov := Provenance{
+		Version:         "2.0",
+		Sources:         []string{"/usr/share/hana-firewall/HANA database client"},
+		InstanceNumbers: []string{"00"},
+	}
+	document := "[hana-database-client]\ntitle=HANA database client access\nports=30013,30015/tcp\n"
+	content := HashCommentedDocumentWithProvenance(document, prov)
+	if !strings.HasPrefix(content, `# Generated by hana-firewall, manual changes will be lost.
+#     Version: 2.0
+#     Source: /usr/share/hana-firewall/HANA database client
+#     Instance numbers: 00
+#     Checksum: sha256:`) || !strings.HasSuffix(content, "\n"+document) {
+		t.Fatal(content)
+	}
+	parsed, parsedDocument, found := ParseProvenance([]byte(content))
+	prov.Checksum = Checksum([]byte(document))
+	if !found || string(parsedDocument) != document || !reflect.DeepEqual(parsed, prov) {
+		t.Fatalf("%+v %q", parsed, parsedDocument)
+	}
+	if !IsGeneratedFile([]byte(content)) || IsModifiedFile([]byte(content)) {
+		t.Fatal("should be generated and unmodified")
+	}
+	if modified := strings.Replace(content, "30015", "30017", 1); !IsModifiedFile([]byte(modified)) {
+		t.Fatal("should be modified")
+	}
+	if _, _, found := ParseProvenance([]byte(document)); found {
+		t.Fatal("should not be found")
+	}
+}
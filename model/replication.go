@@ -0,0 +1,237 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultReplicationPortOffset is the default of [system_replication] port_offset in HANA global.ini.
+	DefaultReplicationPortOffset = 100
+	// The replication port offset is read from [system_replication] port_offset of the custom global.ini of HANA.
+	ReplicationPortOffsetINIFile    = "global.ini"
+	ReplicationPortOffsetINISection = "system_replication"
+	ReplicationPortOffsetINIKey     = "port_offset"
+	// maxReplicationTier is the highest tier of a multi-tier replication supported by HANA.
+	maxReplicationTier = 5
+)
+
+// replicationRoleTiers are the replication roles that imply the tier of a site, if the tier is not configured.
+var replicationRoleTiers = map[string]int{
+	"primary":   1,
+	"secondary": 2,
+	"tertiary":  3,
+}
+
+// ReplicationPeer is another site of HANA system replication, written as NAME:TIER:INSTANCE_NUMBER in HANA_SR_PEERS.
+type ReplicationPeer struct {
+	SiteName       string
+	Tier           int
+	InstanceNumber string
+}
+
+// ParseReplicationPeer parses a replication peer written as NAME:TIER:INSTANCE_NUMBER.
+func ParseReplicationPeer(spec string) (peer ReplicationPeer, err error) {
+	fields := strings.Split(spec, ":")
+	if len(fields) != 3 {
+		return peer, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: "the peer must be written as NAME:TIER:INSTANCE_NUMBER"}
+	}
+	peer.SiteName = fields[0]
+	if peer.SiteName == "" {
+		return peer, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: "the site name must not be empty"}
+	}
+	if peer.Tier, err = strconv.Atoi(fields[1]); err != nil || peer.Tier < 1 || peer.Tier > maxReplicationTier {
+		return peer, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: fmt.Sprintf("the tier must be a number between 1 and %d", maxReplicationTier)}
+	}
+	peer.InstanceNumber = fields[2]
+	if instNum, convErr := strconv.Atoi(peer.InstanceNumber); convErr != nil || len(peer.InstanceNumber) != 2 || instNum < 0 {
+		return peer, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: "the instance number must consist of two digits"}
+	}
+	return peer, nil
+}
+
+// GetShortName returns the site name linted in the same way as the short name of a service definition.
+func (peer *ReplicationPeer) GetShortName() string {
+	return strings.TrimFunc(strings.Map(func(c rune) rune {
+		if unicode.IsNumber(c) || unicode.IsLetter(c) {
+			return unicode.ToLower(c)
+		}
+		return '-'
+	}, peer.SiteName), func(c rune) bool { return c == '-' })
+}
+
+// ReplicationEnabled returns true if system replication peers are configured.
+func (global *HANAGlobalParameters) ReplicationEnabled() bool {
+	return len(global.ReplicationPeers) > 0
+}
+
+/*
+GetReplicationTier returns the tier of this site in system replication, tier 1 being the primary site. If the tier is
+not configured, it is implied by the replication role.
+*/
+func (global *HANAGlobalParameters) GetReplicationTier() (int, error) {
+	roleTier, knownRole := replicationRoleTiers[global.ReplicationRole]
+	if global.ReplicationRole != "" && !knownRole {
+		return 0, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationRoleKey, Value: global.ReplicationRole, Message: "the role must be primary, secondary, or tertiary"}
+	}
+	tier := global.ReplicationTier
+	if tier == 0 {
+		tier = roleTier
+	}
+	switch {
+	case tier == 0:
+		return 0, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationTierKey, Message: "the tier of this site is required if replication peers are configured"}
+	case tier < 1 || tier > maxReplicationTier:
+		return 0, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationTierKey, Value: strconv.Itoa(tier), Message: fmt.Sprintf("the tier must be a number between 1 and %d", maxReplicationTier)}
+	case knownRole && roleTier != tier && !(global.ReplicationRole == "tertiary" && tier > roleTier):
+		return 0, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationTierKey, Value: strconv.Itoa(tier), Message: "the tier does not match role " + global.ReplicationRole}
+	}
+	return tier, nil
+}
+
+/*
+GetAdjacentReplicationPeers returns the replication peers that exchange data with this site directly, which are those
+one tier above (the source of this site) and one tier below (the targets of this site). In a multi-target setup, there
+are several peers on the same tier.
+*/
+func (global *HANAGlobalParameters) GetAdjacentReplicationPeers() (peers []ReplicationPeer, err error) {
+	tier, err := global.GetReplicationTier()
+	if err != nil {
+		return
+	}
+	peers = make([]ReplicationPeer, 0, len(global.ReplicationPeers))
+	names := make(map[string]struct{})
+	for _, spec := range global.ReplicationPeers {
+		peer, err := ParseReplicationPeer(spec)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(peer.SiteName, global.ReplicationSiteName) {
+			return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: "the peer has the site name of this site"}
+		}
+		if _, duplicated := names[peer.GetShortName()]; duplicated {
+			return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPeersKey, Value: spec, Message: "the site name is used by another peer"}
+		}
+		names[peer.GetShortName()] = struct{}{}
+		if peer.Tier == tier-1 || peer.Tier == tier+1 {
+			peers = append(peers, peer)
+		}
+	}
+	return
+}
+
+/*
+GetReplicationPortOffset returns the offset between internal ports and replication ports of the HANA system of the
+instance number. HANA_SR_PORT_OFFSET overrides the offset, otherwise it is [system_replication] port_offset of the
+custom global.ini of the system, or DefaultReplicationPortOffset if the value is not configured or the system is not
+discovered.
+*/
+func (global *HANAGlobalParameters) GetReplicationPortOffset(instNumStr string) (int, error) {
+	if global.ReplicationPortOffset != 0 {
+		return global.ReplicationPortOffset, nil
+	}
+	placeholder := fmt.Sprintf("%s%s:%s:%s:%d__", INISubstitutionMagic, ReplicationPortOffsetINIFile, ReplicationPortOffsetINISection, ReplicationPortOffsetINIKey, DefaultReplicationPortOffset)
+	value, err := global.ExpandINIPlaceholders(placeholder, instNumStr)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ValidationError{Source: ReplicationPortOffsetINIFile, Key: ReplicationPortOffsetINISection + "." + ReplicationPortOffsetINIKey, Value: value, Message: fmt.Sprintf("the port offset of instance %s is not a number", instNumStr)}
+	}
+	return offset, nil
+}
+
+/*
+getReplicationPortNumbers works like GetPortNumbers, but the instance number plus one placeholder is calculated from
+the replication port offset of each instance instead: HANA system replication listens on the internal ports plus the
+offset, which is the same as incrementing the instance number if the offset is 100.
+*/
+func (global *HANAGlobalParameters) getReplicationPortNumbers(portDefinition string) (ret []int, err error) {
+	if !strings.Contains(portDefinition, InstanceNumberPlusOneSubstitutionMagic) {
+		return global.GetPortNumbers(portDefinition)
+	}
+	internalDefinition := strings.Replace(portDefinition, InstanceNumberPlusOneSubstitutionMagic, InstanceNumberSubstitutionMagic, -1)
+	ret = make([]int, 0, 10)
+	for _, instNumStr := range global.InstanceNumbers {
+		single := *global
+		single.InstanceNumbers = []string{instNumStr}
+		internalPorts, err := single.GetPortNumbers(internalDefinition)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := global.GetReplicationPortOffset(instNumStr)
+		if err != nil {
+			return nil, err
+		}
+		if offset == 0 {
+			// Replication ports never coincide with internal ports
+			offset = DefaultReplicationPortOffset
+		}
+		for _, port := range internalPorts {
+			port += offset
+			if port < 1 || port > 65535 {
+				return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPortOffsetKey, Value: strconv.Itoa(offset), Message: fmt.Sprintf("the offset turns port definition \"%s\" into invalid port number %d", portDefinition, port)}
+			}
+			ret = append(ret, port)
+		}
+	}
+	return
+}
+
+/*
+MakeReplicationServices generates one firewalld service per adjacent replication peer from the system replication
+definition, so that each of them can be enabled in the zone that faces the peer. If a peer runs an instance number
+that this site does not, the ports of the peer's service are calculated for the peer's instance number as well, so that
+the replication connections are allowed regardless of which site opens them. The port offset of such a peer cannot be
+read from the HANA configuration of this host, hence HANA_SR_PORT_OFFSET must be given if the definition depends on
+the offset, otherwise an error is returned. The returned map is service short name vs service.
+*/
+func (global *HANAGlobalParameters) MakeReplicationServices(def *HANAServiceDefinition) (ret map[string]FirewalldService, err error) {
+	peers, err := global.GetAdjacentReplicationPeers()
+	if err != nil {
+		return
+	}
+	tier, _ := global.GetReplicationTier()
+	ret = make(map[string]FirewalldService)
+	usesOffset := false
+	for _, portDefinition := range append(append([]string{}, def.TCP...), def.UDP...) {
+		usesOffset = usesOffset || strings.Contains(portDefinition, InstanceNumberPlusOneSubstitutionMagic)
+	}
+	for _, peer := range peers {
+		if usesOffset && global.ReplicationPortOffset == 0 && global.GetSystem(peer.InstanceNumber) == nil && !isInstanceNumberOf(global.InstanceNumbers, peer.InstanceNumber) {
+			return nil, &ValidationError{Source: HANAGlobalParametersFile, Key: HANAGlobalReplicationPortOffsetKey, Message: fmt.Sprintf("site %s runs instance number %s, which is not discovered on this host, hence the replication port offset must be given", peer.SiteName, peer.InstanceNumber)}
+		}
+		withPeer := *global
+		withPeer.InstanceNumbers = UniqueSortedStrings(append(append([]string{}, global.InstanceNumbers...), peer.InstanceNumber))
+		shortName, svc, err := withPeer.MakeFirewalldService(def)
+		if err != nil {
+			return nil, err
+		}
+		direction := "target"
+		if peer.Tier < tier {
+			direction = "source"
+		}
+		svc.ShortName = fmt.Sprintf("%s - %s", svc.ShortName, peer.SiteName)
+		svc.Description = fmt.Sprintf("%s - replication with %s site %s (tier %d, instance number %s).", strings.TrimSuffix(svc.Description, "."), direction, peer.SiteName, peer.Tier, peer.InstanceNumber)
+		ret[ReplicationServiceShortName(shortName, peer)] = svc
+	}
+	return
+}
+
+// isInstanceNumberOf returns true if the instance number is among the instance numbers.
+func isInstanceNumberOf(instanceNumbers []string, instNumStr string) bool {
+	for _, instanceNumber := range instanceNumbers {
+		if instanceNumber == instNumStr {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplicationServiceShortName returns the short name of the firewalld service generated for the replication peer.
+func ReplicationServiceShortName(definitionShortName string, peer ReplicationPeer) string {
+	return definitionShortName + "-" + peer.GetShortName()
+}
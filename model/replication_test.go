@@ -0,0 +1,179 @@
+package model
+
+import (
+	"github.com/SUSE/HANA-Firewall/txtparser"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var replicationDefinition = HANAServiceDefinition{
+	FileBaseName:     "HANA internal system replication",
+	ShortDescription: "HANA system replication",
+	Description:      "Internal network communication for system replication.",
+	TCP:              []string{"3__INST_NUM+1__01", "4__INST_NUM__02"},
+	Replication:      true,
+}
+
+// replicationServiceNames returns the sorted short names of replication services generated by the global parameters.
+func replicationServiceNames(t *testing.T, global HANAGlobalParameters) []string {
+	services, err := global.MakeReplicationServices(&replicationDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestHANAGlobalParametersReplicationSysconfig(t *testing.T) {
+	conf, err := txtparser.ParseSysconfig(`HANA_INSTANCE_NUMBERS="00"
+HANA_SR_SITE_NAME="WDF"
+HANA_SR_ROLE="secondary"
+HANA_SR_PEERS="ROT:1:00 SIN:3:10"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var global HANAGlobalParameters
+	global.ReadFrom(conf)
+	if global.ReplicationSiteName != "WDF" || global.ReplicationPortOffset != 0 || !global.ReplicationEnabled() {
+		t.Fatalf("%+v", global)
+	}
+	if tier, err := global.GetReplicationTier(); err != nil || tier != 2 {
+		t.Fatal(tier, err)
+	}
+	// The ports of the replication definition follow the offset
+	_, svc, err := global.MakeFirewalldService(&replicationDefinition)
+	if err != nil || !reflect.DeepEqual(svc.Ports, []FirewalldPort{{Port: 30101, Protocol: FirewalldProtocolTCP}, {Port: 40002, Protocol: FirewalldProtocolTCP}}) {
+		t.Fatal(svc.Ports, err)
+	}
+	// The offset is read from global.ini of the HANA system
+	globalINI, err := txtparser.ParseINI("[system_replication]\nport_offset = 200\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Systems = []HANASystem{{SID: "PRD", InstanceNumber: "00", Config: map[string]*txtparser.INI{"global.ini": globalINI}}}
+	if _, svc, err := global.MakeFirewalldService(&replicationDefinition); err != nil || svc.Ports[0].Port != 30201 {
+		t.Fatal(svc.Ports, err)
+	}
+	// HANA_SR_PORT_OFFSET overrides global.ini
+	global.ReplicationPortOffset = 1000
+	if _, svc, err := global.MakeFirewalldService(&replicationDefinition); err != nil || svc.Ports[0].Port != 31001 {
+		t.Fatal(svc.Ports, err)
+	}
+	if offset, err := global.GetReplicationPortOffset("00"); err != nil || offset != 1000 {
+		t.Fatal(offset, err)
+	}
+	global.ReplicationPortOffset = 0
+	invalidINI, err := txtparser.ParseINI("[system_replication]\nport_offset = many\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.Systems[0].Config["global.ini"] = invalidINI
+	if _, err := global.GetReplicationPortOffset("00"); err == nil {
+		t.Fatal("did not error")
+	}
+	global.Systems = nil
+	// Other definitions are not affected by the offset
+	if _, svc, err := global.MakeFirewalldService(&definition); err != nil || svc.Ports[2].Port != 5016 {
+		t.Fatal(svc.Ports, err)
+	}
+}
+
+func TestHANAGlobalParameters_MakeReplicationServices(t *testing.T) {
+	// Two tiers, seen from both sites
+	primary := HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: "ROT", ReplicationRole: "primary", ReplicationPeers: []string{"WDF:2:00"}}
+	if names := replicationServiceNames(t, primary); !reflect.DeepEqual(names, []string{"hana-internal-system-replication-wdf"}) {
+		t.Fatal(names)
+	}
+	secondary := HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: "WDF", ReplicationTier: 2, ReplicationPeers: []string{"ROT:1:00"}}
+	services, err := secondary.MakeReplicationServices(&replicationDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := services["hana-internal-system-replication-rot"]
+	if svc.ShortName != "HANA system replication - ROT" ||
+		svc.Description != "Internal network communication for system replication - replication with source site ROT (tier 1, instance number 00)." ||
+		len(svc.Ports) != 2 {
+		t.Fatalf("%+v", services)
+	}
+
+	// A peer that runs another instance number gets the ports of both instance numbers, its offset must be given
+	otherInstance := HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: "ROT", ReplicationTier: 1, ReplicationPeers: []string{"WDF:2:10"}}
+	if _, err := otherInstance.MakeReplicationServices(&replicationDefinition); err == nil {
+		t.Fatal("did not error")
+	}
+	otherInstance.ReplicationPortOffset = 100
+	services, err = otherInstance.MakeReplicationServices(&replicationDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc := services["hana-internal-system-replication-wdf"]; !reflect.DeepEqual(svc.Ports, []FirewalldPort{
+		{Port: 30101, Protocol: FirewalldProtocolTCP}, {Port: 31101, Protocol: FirewalldProtocolTCP},
+		{Port: 40002, Protocol: FirewalldProtocolTCP}, {Port: 41002, Protocol: FirewalldProtocolTCP}}) {
+		t.Fatalf("%+v", svc.Ports)
+	}
+
+	// The offset is not needed if the peer's instance is discovered on this host or the definition does not use it
+	otherInstance.ReplicationPortOffset = 0
+	otherInstance.Systems = []HANASystem{{SID: "QAS", InstanceNumber: "10"}}
+	if _, err := otherInstance.MakeReplicationServices(&replicationDefinition); err != nil {
+		t.Fatal(err)
+	}
+	otherInstance.Systems = nil
+	withoutOffset := HANAServiceDefinition{FileBaseName: "Replication", TCP: []string{"4__INST_NUM__02"}, Replication: true}
+	if _, err := otherInstance.MakeReplicationServices(&withoutOffset); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three tiers: the middle tier talks to both, the outer tiers only to the middle tier
+	peers := []string{"ROT:1:00", "WDF:2:00", "SIN:3:00"}
+	for _, tc := range []struct {
+		site  string
+		tier  int
+		names []string
+	}{
+		{"ROT", 1, []string{"hana-internal-system-replication-wdf"}},
+		{"WDF", 2, []string{"hana-internal-system-replication-rot", "hana-internal-system-replication-sin"}},
+		{"SIN", 3, []string{"hana-internal-system-replication-wdf"}},
+	} {
+		sitePeers := make([]string, 0, 2)
+		for _, peer := range peers {
+			if peer[:3] != tc.site {
+				sitePeers = append(sitePeers, peer)
+			}
+		}
+		global := HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: tc.site, ReplicationTier: tc.tier, ReplicationPeers: sitePeers}
+		if names := replicationServiceNames(t, global); !reflect.DeepEqual(names, tc.names) {
+			t.Fatal(tc.site, names)
+		}
+	}
+
+	// Multi-target: the primary replicates to two secondaries, and one of them further to a tertiary
+	multiTarget := HANAGlobalParameters{InstanceNumbers: []string{"00"}, ReplicationSiteName: "ROT", ReplicationTier: 1, ReplicationPortOffset: 100,
+		ReplicationPeers: []string{"WDF:2:00", "Site 2B:2:10", "SIN:3:00"}}
+	if names := replicationServiceNames(t, multiTarget); !reflect.DeepEqual(names, []string{"hana-internal-system-replication-site-2b", "hana-internal-system-replication-wdf"}) {
+		t.Fatal(names)
+	}
+
+	// Invalid configuration
+	for _, invalid := range []HANAGlobalParameters{
+		{InstanceNumbers: []string{"00"}, ReplicationPeers: []string{"WDF:2:00"}},
+		{InstanceNumbers: []string{"00"}, ReplicationRole: "standby", ReplicationPeers: []string{"WDF:2:00"}},
+		{InstanceNumbers: []string{"00"}, ReplicationRole: "primary", ReplicationTier: 2, ReplicationPeers: []string{"WDF:1:00"}},
+		{InstanceNumbers: []string{"00"}, ReplicationTier: 1, ReplicationPeers: []string{"WDF:2"}},
+		{InstanceNumbers: []string{"00"}, ReplicationTier: 1, ReplicationPeers: []string{"WDF:9:00"}},
+		{InstanceNumbers: []string{"00"}, ReplicationTier: 1, ReplicationPeers: []string{"WDF:2:0"}},
+		{InstanceNumbers: []string{"00"}, ReplicationTier: 1, ReplicationPeers: []string{"WDF:2:00", "wdf:2:10"}},
+		{InstanceNumbers: []string{"00"}, ReplicationSiteName: "ROT", ReplicationTier: 1, ReplicationPeers: []string{"ROT:2:00"}},
+		{InstanceNumbers: []string{"99"}, ReplicationTier: 1, ReplicationPortOffset: 40000, ReplicationPeers: []string{"WDF:2:99"}},
+	} {
+		if _, err := invalid.MakeReplicationServices(&replicationDefinition); err == nil {
+			t.Fatalf("%+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+HANAVersion is the version of a HANA system made of major version, minor version, revision, and patch level, such as
+2.00.059.00 for HANA 2.0 SPS05 revision 59. A version may be shorter, for example 2.00 stands for all revisions of
+HANA 2.0. The empty version is unknown.
+*/
+type HANAVersion []int
+
+/*
+ParseHANAVersion parses a version written as MAJOR.MINOR.REVISION.PATCH, of which only the major version is required.
+Anything that follows the patch level, such as the build number of "2.00.059.00.1636541146", is ignored.
+*/
+func ParseHANAVersion(str string) (HANAVersion, error) {
+	fields := strings.Split(strings.TrimSpace(str), ".")
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	ver := make(HANAVersion, 0, len(fields))
+	for _, field := range fields {
+		num, err := strconv.Atoi(field)
+		if err != nil || num < 0 {
+			return nil, fmt.Errorf("\"%s\" is not a HANA version such as 2.00.059.00", str)
+		}
+		ver = append(ver, num)
+	}
+	return ver, nil
+}
+
+// String returns the version in the notation used by HANA, such as 2.00.059.00.
+func (ver HANAVersion) String() string {
+	formats := []string{"%d", "%02d", "%03d", "%02d"}
+	fields := make([]string, 0, len(ver))
+	for i, num := range ver {
+		fields = append(fields, fmt.Sprintf(formats[i], num))
+	}
+	return strings.Join(fields, ".")
+}
+
+/*
+Compare returns -1 if the version is older than the other, 1 if it is newer, and 0 if they are equal. Only as many
+components are compared as the shorter version has, so that 2.00.059.00 equals 2.00 and 2, but not 1.00.
+*/
+func (ver HANAVersion) Compare(other HANAVersion) int {
+	for i := 0; i < len(ver) && i < len(other); i++ {
+		if ver[i] < other[i] {
+			return -1
+		} else if ver[i] > other[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+/*
+IsWithin returns true if the version is within the inclusive range of the versions, either of which may be empty to
+leave the range open.
+*/
+func (ver HANAVersion) IsWithin(min, max HANAVersion) bool {
+	return (len(min) == 0 || ver.Compare(min) >= 0) && (len(max) == 0 || ver.Compare(max) <= 0)
+}
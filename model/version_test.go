@@ -0,0 +1,38 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHANAVersion(t *testing.T) {
+	ver, err := ParseHANAVersion("2.00.059.00.1636541146")
+	if err != nil || !reflect.DeepEqual(ver, HANAVersion{2, 0, 59, 0}) || ver.String() != "2.00.059.00" {
+		t.Fatal(ver, err)
+	}
+	for _, invalid := range []string{"", "SPS05", "2.00.x", "2.-1"} {
+		if _, err := ParseHANAVersion(invalid); err == nil {
+			t.Fatal(invalid)
+		}
+	}
+	for _, tc := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"2.00.059.00", "2.00.059.00", 0},
+		{"2.00.059.00", "2.00.060", -1},
+		{"2.00.059.00", "1.00.122.33", 1},
+		{"2.00.059.00", "2.00", 0},
+		{"1.00.122", "2", -1},
+	} {
+		a, _ := ParseHANAVersion(tc.a)
+		b, _ := ParseHANAVersion(tc.b)
+		if cmp := a.Compare(b); cmp != tc.cmp {
+			t.Fatal(tc, cmp)
+		}
+	}
+	ver = HANAVersion{1, 0, 122, 33}
+	if !ver.IsWithin(nil, HANAVersion{1, 0}) || !ver.IsWithin(HANAVersion{1, 0, 110}, nil) || ver.IsWithin(HANAVersion{2}, nil) {
+		t.Fatal("wrong range")
+	}
+}
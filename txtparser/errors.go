@@ -0,0 +1,35 @@
+package txtparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is a syntax error found in a text file. Line numbers start from 1, and 0 means the whole file.
+type ParseError struct {
+	File    string // File is the path of the text file, it is empty if the text did not come from a file.
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "(text)"
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", file, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", file, e.Message)
+}
+
+// ParseErrors is a list of syntax errors found in a text file, it is never empty.
+type ParseErrors []*ParseError
+
+func (errs ParseErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,74 @@
+package txtparser
+
+import "strings"
+
+// INI is the content of an INI file, such as HANA's global.ini. Section and key names are case-insensitive.
+type INI struct {
+	Sections map[string]map[string]string // Sections are lower case section name vs lower case key vs value.
+}
+
+// Read INI file and parse the file content into memory structures.
+func ParseINIFile(fileName string) (*INI, error) {
+	content, err := readSysconfigFile(fileName, false)
+	if err != nil {
+		return nil, err
+	}
+	ini, err := ParseINI(string(content))
+	if parseErr, ok := err.(*ParseError); ok {
+		parseErr.File = fileName
+	}
+	return ini, err
+}
+
+/*
+Read INI text and parse the text into memory structures. Lines that start with ';' or '#' are comments, and key-value
+pairs that come before the first section belong to the section of empty name. If a key appears more than once in a
+section, the last value wins.
+*/
+func ParseINI(input string) (*INI, error) {
+	ini := &INI{Sections: make(map[string]map[string]string)}
+	section := ""
+	for lineNum, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &ParseError{Line: lineNum + 1, Message: "unterminated section name \"" + line + "\""}
+			}
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		eqChar := strings.IndexRune(line, '=')
+		if eqChar < 1 {
+			return nil, &ParseError{Line: lineNum + 1, Message: "unknown syntax \"" + line + "\", expecting key = value"}
+		}
+		ini.Set(section, line[:eqChar], strings.TrimSpace(line[eqChar+1:]))
+	}
+	return ini, nil
+}
+
+// Get returns the value of the key in the section, and whether the key exists.
+func (ini *INI) Get(section, key string) (value string, exists bool) {
+	value, exists = ini.Sections[strings.ToLower(section)][strings.ToLower(strings.TrimSpace(key))]
+	return
+}
+
+// Set value for a key in the section. If the section or key does not yet exist, it is created.
+func (ini *INI) Set(section, key, value string) {
+	section = strings.ToLower(section)
+	if ini.Sections[section] == nil {
+		ini.Sections[section] = make(map[string]string)
+	}
+	ini.Sections[section][strings.ToLower(strings.TrimSpace(key))] = value
+}
+
+// Merge copies all values of the other INI into this one, the values of the other INI win.
+func (ini *INI) Merge(other *INI) {
+	for section, keyValues := range other.Sections {
+		for key, value := range keyValues {
+			ini.Set(section, key, value)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package txtparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestINI(t *testing.T) {
+	ini, err := ParseINI(`# global.ini
+top = level
+
+[System_Replication]
+port_offset = 200
+; comment
+mode=sync
+[communication]
+listenport = 3$(SAPSYSTEM)03
+mode = async
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct{ section, key, value string }{
+		{"", "top", "level"},
+		{"system_replication", "PORT_OFFSET", "200"},
+		{"SYSTEM_REPLICATION", "mode", "sync"},
+		{"communication", "listenport", "3$(SAPSYSTEM)03"},
+	} {
+		if value, exists := ini.Get(test.section, test.key); !exists || value != test.value {
+			t.Fatal(test, value)
+		}
+	}
+	if _, exists := ini.Get("communication", "port_offset"); exists {
+		t.Fatal("should not exist")
+	}
+	other, err := ParseINI("[communication]\nmode = sync\n[persistence]\nbasepath = /hana\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.Merge(other)
+	if !reflect.DeepEqual(ini.Sections["communication"], map[string]string{"listenport": "3$(SAPSYSTEM)03", "mode": "sync"}) ||
+		ini.Sections["persistence"]["basepath"] != "/hana" {
+		t.Fatal(ini.Sections)
+	}
+	if _, err := ParseINI("[ok]\nnot a key value\n"); err == nil || err.(*ParseError).Line != 2 {
+		t.Fatal(err)
+	}
+	if _, err := ParseINI("[unterminated\n"); err == nil || err.(*ParseError).Line != 1 {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package txtparser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema declares the keys that may appear in a type of sysconfig file, so that misspelled keys can be told apart.
+type Schema struct {
+	Name string   // Name describes the type of file in error messages, such as "service definition".
+	Keys []string // Keys are the known keys, those that come first are preferred when suggesting a key.
+}
+
+// NewSchema returns a schema of the known keys.
+func NewSchema(name string, keys ...string) *Schema {
+	return &Schema{Name: name, Keys: keys}
+}
+
+// With returns a new schema that knows the additional keys, the schema itself is not changed.
+func (schema *Schema) With(name string, keys ...string) *Schema {
+	allKeys := make([]string, 0, len(schema.Keys)+len(keys))
+	allKeys = append(allKeys, schema.Keys...)
+	return NewSchema(name, append(allKeys, keys...)...)
+}
+
+// IsKnown returns true only if the key is declared in the schema.
+func (schema *Schema) IsKnown(key string) bool {
+	for _, known := range schema.Keys {
+		if known == key {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Suggest returns the known key that is the closest to the unknown key, or an empty string if none of the known keys is
+close enough. Letter case is ignored, and a swap of adjacent characters counts as a single edit.
+*/
+func (schema *Schema) Suggest(key string) string {
+	maxDistance := len(key) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	suggestion, suggestionDistance := "", maxDistance+1
+	for _, known := range schema.Keys {
+		if distance := editDistance(strings.ToUpper(key), strings.ToUpper(known)); distance < suggestionDistance {
+			suggestion, suggestionDistance = known, distance
+		}
+	}
+	return suggestion
+}
+
+/*
+CheckKeys returns a parse error for each key of the sysconfig that is not declared in the schema, in the order of lines.
+The file name only appears in the errors. If all keys are known, the return value is nil.
+*/
+func (schema *Schema) CheckKeys(fileName string, conf *Sysconfig) (errs ParseErrors) {
+	for _, entry := range conf.AllValues {
+		if schema.IsKnown(entry.Key) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown key \"%s\" in %s", entry.Key, schema.Name)
+		if suggestion := schema.Suggest(entry.Key); suggestion != "" {
+			msg += fmt.Sprintf(", did you mean \"%s\"?", suggestion)
+		}
+		errs = append(errs, &ParseError{File: fileName, Line: entry.Line, Message: msg})
+	}
+	return
+}
+
+// Merge returns the parse errors of both lists in the order of lines, or nil if both lists are empty.
+func (errs ParseErrors) Merge(more ParseErrors) ParseErrors {
+	if len(errs)+len(more) == 0 {
+		return nil
+	}
+	ret := make(ParseErrors, 0, len(errs)+len(more))
+	ret = append(append(ret, errs...), more...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Line < ret[j].Line
+	})
+	return ret
+}
+
+// editDistance returns the Levenshtein distance between two strings, counting a swap of adjacent characters as one edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	dist := make([][]int, len(ra)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(rb)+1)
+		dist[i][0] = i
+	}
+	for j := range dist[0] {
+		dist[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			dist[i][j] = minInt(dist[i-1][j]+1, dist[i][j-1]+1, dist[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				dist[i][j] = minInt(dist[i][j], dist[i-2][j-2]+1)
+			}
+		}
+	}
+	return dist[len(ra)][len(rb)]
+}
+
+func minInt(first int, others ...int) int {
+	for _, other := range others {
+		if other < first {
+			first = other
+		}
+	}
+	return first
+}
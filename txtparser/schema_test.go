@@ -0,0 +1,45 @@
+package txtparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema := NewSchema("service definition", "TCP", "UDP", "HANA_INSTANCE_NUMBERS")
+	dropIn := schema.With("drop-in", "TCP_ADD")
+	if !dropIn.IsKnown("TCP_ADD") || schema.IsKnown("TCP_ADD") || !dropIn.IsKnown("UDP") {
+		t.Fatal(dropIn, schema)
+	}
+	for unknown, suggestion := range map[string]string{
+		"Tcp":                  "TCP",
+		"TPC":                  "TCP",
+		"HANA_INSTANCE_NUMBER": "HANA_INSTANCE_NUMBERS",
+		"tcp_add":              "",
+		"SHORT_DESCRIPTION":    "",
+	} {
+		if s := schema.Suggest(unknown); s != suggestion {
+			t.Fatal(unknown, s)
+		}
+	}
+	conf, err := ParseSysconfig("TCP=\"1\"\n# Comment\nTpc=\"2\"\nFOO=\"3\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := schema.CheckKeys("def", conf)
+	if len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 4 {
+		t.Fatal(errs)
+	}
+	if errs[0].Error() != `def:3: unknown key "Tpc" in service definition, did you mean "TCP"?` ||
+		errs[1].Error() != `def:4: unknown key "FOO" in service definition` {
+		t.Fatal(errs)
+	}
+	merged := ParseErrors{{Line: 5}, {Line: 1}}.Merge(errs)
+	lines := []int{merged[0].Line, merged[1].Line, merged[2].Line, merged[3].Line}
+	if !reflect.DeepEqual(lines, []int{1, 3, 4, 5}) {
+		t.Fatal(lines)
+	}
+	if ParseErrors(nil).Merge(nil) != nil {
+		t.Fatal("expecting nil")
+	}
+}
@@ -10,15 +10,20 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var consecutiveSpaces = regexp.MustCompile("[[:space:]]+")
 
+// validKeyName matches a key name that is acceptable to shell, which sources sysconfig files.
+var validKeyName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
 // A single key-value pair in sysconfig file.
 type SysconfigEntry struct {
 	LeadingComments []string // The comment lines leading to the key-value pair, including prefix '#', excluding end-of-line.
 	Key             string   // The key.
 	Value           string   // The value, excluding '=' character and double-quotes. Values will always come in double-quotes when converted to text.
+	Line            int      // The line number of the key-value pair in the original text, or 0 if the key was added later.
 }
 
 // Key-value pairs of a sysconfig file. It is able to convert back to original text in the original key order.
@@ -29,6 +34,24 @@ type Sysconfig struct {
 
 // Read sysconfig file and parse the file content into memory structures.
 func ParseSysconfigFile(fileName string, autoCreate bool) (*Sysconfig, error) {
+	content, err := readSysconfigFile(fileName, autoCreate)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSysconfig(string(content))
+}
+
+// Read sysconfig file and parse the file content in strict mode, see ParseSysconfigStrict. The file is never created.
+func ParseSysconfigFileStrict(fileName string) (*Sysconfig, error) {
+	content, err := readSysconfigFile(fileName, false)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSysconfigStrict(fileName, string(content))
+}
+
+// Read the content of sysconfig file, optionally create the file if it does not yet exist.
+func readSysconfigFile(fileName string, autoCreate bool) ([]byte, error) {
 	content, err := ioutil.ReadFile(fileName)
 	if os.IsNotExist(err) && autoCreate {
 		err = os.MkdirAll(path.Dir(fileName), 0755)
@@ -43,7 +66,7 @@ func ParseSysconfigFile(fileName string, autoCreate bool) (*Sysconfig, error) {
 	} else if err != nil {
 		return nil, err
 	}
-	return ParseSysconfig(string(content))
+	return content, nil
 }
 
 // Read sysconfig text and parse the text into memory structures.
@@ -53,7 +76,7 @@ func ParseSysconfig(input string) (*Sysconfig, error) {
 		KeyValue:  make(map[string]*SysconfigEntry),
 	}
 	leadingComments := make([]string, 0, 0)
-	for _, line := range strings.Split(input, "\n") {
+	for lineNum, line := range strings.Split(input, "\n") {
 		line = strings.TrimSpace(line)
 		if strings.HasPrefix(line, "#") {
 			// Line is a comment
@@ -66,6 +89,7 @@ func ParseSysconfig(input string) (*Sysconfig, error) {
 				LeadingComments: leadingComments,
 				Key:             key,
 				Value:           value,
+				Line:            lineNum + 1,
 			}
 			conf.AllValues = append(conf.AllValues, kv)
 			conf.KeyValue[key] = kv
@@ -79,6 +103,77 @@ func ParseSysconfig(input string) (*Sysconfig, error) {
 	return conf, nil
 }
 
+/*
+Read sysconfig text and parse the text into memory structures, like ParseSysconfig does, and additionally report lines
+that the lenient parser would silently accept: lines that are not valid UTF-8 or contain NUL characters, lines that are
+neither comment nor key-value pair, invalid key names, unterminated quotes, and keys that are defined more than once.
+The file name only appears in the errors. If any problem is found, the returned error is ParseErrors that lists all of
+them in the order of lines, and the parsed text is returned nonetheless.
+*/
+func ParseSysconfigStrict(fileName, input string) (*Sysconfig, error) {
+	conf, err := ParseSysconfig(input)
+	if err != nil {
+		return nil, err
+	}
+	errs := make(ParseErrors, 0, 0)
+	firstLine := make(map[string]int)
+	for lineNum, line := range strings.Split(input, "\n") {
+		fail := func(template string, stuff ...interface{}) {
+			errs = append(errs, &ParseError{File: fileName, Line: lineNum + 1, Message: fmt.Sprintf(template, stuff...)})
+		}
+		if strings.ContainsRune(line, 0) {
+			fail("the line contains a NUL character, the file does not contain text")
+			continue
+		} else if !utf8.ValidString(line) {
+			fail("the line is not valid UTF-8 text")
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eqChar := strings.IndexRune(line, '=')
+		if eqChar == -1 {
+			fail("unknown syntax \"%s\", expecting KEY=\"value\" or a comment", line)
+			continue
+		}
+		key := strings.TrimSpace(line[0:eqChar])
+		if !validKeyName.MatchString(key) {
+			fail("invalid key name \"%s\"", key)
+			continue
+		}
+		if first, exists := firstLine[key]; exists {
+			fail("duplicate key \"%s\", it is already defined on line %d", key, first)
+		} else {
+			firstLine[key] = lineNum + 1
+		}
+		if msg := checkQuotes(strings.TrimSpace(line[eqChar+1:])); msg != "" {
+			fail("%s in the value of key \"%s\"", msg, key)
+		}
+	}
+	if len(errs) > 0 {
+		return conf, errs
+	}
+	return conf, nil
+}
+
+// Return a description of the problem with double-quotes in a raw value, or an empty string if there is no problem.
+func checkQuotes(value string) string {
+	if !strings.HasPrefix(value, `"`) {
+		if strings.Contains(value, `"`) {
+			return "unexpected double-quote"
+		}
+		return ""
+	}
+	if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+		return "unterminated double-quote"
+	}
+	if strings.Contains(value[1:len(value)-1], `"`) {
+		return "unexpected double-quote"
+	}
+	return ""
+}
+
 // Set value for a key. If the key does not yet exist, it is created.
 func (conf *Sysconfig) Set(key string, value interface{}) {
 	kv, exists := conf.KeyValue[key]
@@ -96,6 +191,21 @@ func (conf *Sysconfig) Set(key string, value interface{}) {
 	conf.KeyValue[key] = kv
 }
 
+// Remove a key along with its leading comments. Nothing happens if the key does not exist.
+func (conf *Sysconfig) Delete(key string) {
+	if _, exists := conf.KeyValue[key]; !exists {
+		return
+	}
+	delete(conf.KeyValue, key)
+	remaining := make([]*SysconfigEntry, 0, len(conf.AllValues))
+	for _, kv := range conf.AllValues {
+		if kv.Key != key {
+			remaining = append(remaining, kv)
+		}
+	}
+	conf.AllValues = remaining
+}
+
 // Give a space-separated integer array value to a key. If the key does not yet exist, it is created.
 func (conf *Sysconfig) SetIntArray(key string, values []int) {
 	strs := make([]string, len(values))
@@ -189,6 +299,28 @@ func (conf *Sysconfig) GetBool(key string, defaultValue bool) bool {
 	return (value == "yes" || value == "true")
 }
 
+/*
+Return the text of comment lines at the very beginning of the file, up to the first line that is not a comment.
+The comment prefix '#' and surrounding spaces are removed, comment lines that start with "##" are skipped.
+*/
+func (conf *Sysconfig) GetLeadingComments() (ret []string) {
+	ret = make([]string, 0, 4)
+	if len(conf.AllValues) == 0 {
+		return
+	}
+	for _, line := range conf.AllValues[0].LeadingComments {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if !strings.HasPrefix(line, "##") {
+			if text := strings.TrimSpace(strings.TrimLeft(line, "#")); text != "" {
+				ret = append(ret, text)
+			}
+		}
+	}
+	return
+}
+
 // Convert key-value pairs back into text. Values are always surrounded by double-quotes.
 func (conf *Sysconfig) ToText() string {
 	var ret bytes.Buffer
@@ -2,6 +2,9 @@ package txtparser
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"reflect"
 	"testing"
 )
@@ -141,3 +144,91 @@ func TestSysconfig(t *testing.T) {
 		t.Fatal("failed to convert back into text")
 	}
 }
+
+func TestSysconfig_GetLeadingComments(t *testing.T) {
+	conf, err := ParseSysconfig(sysconfSampleText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments := conf.GetLeadingComments(); len(comments) != 0 {
+		t.Fatal(comments)
+	}
+	conf, err = ParseSysconfig("# HANA cockpit\n#\n# More information.\n\n# Not leading\nTCP=\"1\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments := conf.GetLeadingComments(); !reflect.DeepEqual(comments, []string{"HANA cockpit", "More information."}) {
+		t.Fatal(comments)
+	}
+}
+
+func TestParseSysconfigFile_Binary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-txtparser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "binary")
+	if err := ioutil.WriteFile(filePath, []byte("TCP=\"1\"\nUDP=\"\x00\x01\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// NUL characters are only rejected by the strict parser, the lenient parser reads the file as it always did
+	if conf, err := ParseSysconfigFile(filePath, false); err != nil || conf.GetString("TCP", "") != "1" {
+		t.Fatal(err)
+	}
+	_, err = ParseSysconfigFileStrict(filePath)
+	parseErrs, ok := err.(ParseErrors)
+	if !ok || len(parseErrs) != 1 || parseErrs[0].File != filePath || parseErrs[0].Line != 2 {
+		t.Fatal(err)
+	}
+	if parseErrs[0].Error() != filePath+":2: "+parseErrs[0].Message {
+		t.Fatal(parseErrs[0].Error())
+	}
+	// Text that is not UTF-8, such as a Latin-1 comment, is only rejected by the strict parser
+	if err := ioutil.WriteFile(filePath, []byte("# Gr\xfc\xdfe\nTCP=\"1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if conf, err := ParseSysconfigFile(filePath, false); err != nil || conf.GetString("TCP", "") != "1" {
+		t.Fatal(err)
+	}
+	_, err = ParseSysconfigFileStrict(filePath)
+	if parseErrs, ok := err.(ParseErrors); !ok || len(parseErrs) != 1 || parseErrs[0].Line != 1 {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSysconfigStrict(t *testing.T) {
+	text := `# Comment
+A="1"
+
+B = "2"
+C=3
+not a key-value pair
+1D="4"
+A="5"
+E="6
+F="7"8"
+G=
+`
+	conf, err := ParseSysconfigStrict("strict.conf", text)
+	if conf == nil || conf.GetString("A", "") != "5" || conf.GetString("C", "") != "3" {
+		t.Fatal(conf)
+	}
+	parseErrs, ok := err.(ParseErrors)
+	if !ok {
+		t.Fatal(err)
+	}
+	lines := make([]int, 0, 0)
+	for _, parseErr := range parseErrs {
+		if parseErr.File != "strict.conf" {
+			t.Fatal(parseErr)
+		}
+		lines = append(lines, parseErr.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{6, 7, 8, 9, 10}) {
+		t.Fatal(err)
+	}
+	if _, err := ParseSysconfigStrict("strict.conf", sysconfSampleText); err != nil {
+		t.Fatal(err)
+	}
+}
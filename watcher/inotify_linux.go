@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the changes that are reported by inotify.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// inotify is the notifier implemented by Linux inotify.
+type inotify struct {
+	fd     int
+	file   *os.File // file wraps the non-blocking descriptor, so that reading it can be interrupted by closing it.
+	evChan chan event
+	errCh  chan error
+	closed chan struct{}
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("watcher: failed to initialise inotify - %v", err)
+	}
+	n := &inotify{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		evChan: make(chan event, 64),
+		errCh:  make(chan error, 1),
+		closed: make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) add(dir string) (int, error) {
+	return syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+}
+
+func (n *inotify) events() <-chan event {
+	return n.evChan
+}
+
+func (n *inotify) errors() <-chan error {
+	return n.errCh
+}
+
+func (n *inotify) close() error {
+	close(n.closed)
+	return n.file.Close()
+}
+
+// read decodes inotify events until the descriptor is closed.
+func (n *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		length, err := n.file.Read(buf)
+		if err != nil {
+			select {
+			case <-n.closed:
+			default:
+				n.errCh <- fmt.Errorf("watcher: failed to read inotify events - %v", err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= length; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			name := string(buf[nameStart:nameEnd])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			ev := event{wd: int(raw.Wd), name: name, overflow: raw.Mask&syscall.IN_Q_OVERFLOW != 0}
+			select {
+			case n.evChan <- ev:
+			case <-n.closed:
+				return
+			}
+			offset = nameEnd
+		}
+	}
+}
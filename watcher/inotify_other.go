@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+import "errors"
+
+func newNotifier() (notifier, error) {
+	return nil, errors.New("watcher: watching for changes is only supported on Linux")
+}
@@ -0,0 +1,125 @@
+/*
+Watch files and directories for changes.
+
+A watcher notices creation, removal, renaming, and modification of files in the watched directories and their
+sub-directories, as well as the creation and removal of the watched paths themselves. Bursts of changes are debounced
+into a single notification.
+*/
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// Target is a file or directory to be watched.
+type Target struct {
+	Path  string // Path of a file or directory, it does not have to exist yet.
+	Depth int    // Depth is the number of sub-directory levels to watch underneath a directory.
+}
+
+// Watcher calls a function after changes happen to the targets.
+type Watcher struct {
+	Targets  []Target
+	Debounce time.Duration // Debounce is the quiet period after the last change, before the function is called.
+}
+
+// event is a change reported by the operating system.
+type event struct {
+	wd       int    // wd is the watch descriptor returned by notifier.add.
+	name     string // name of the file that changed in the watched directory, it is empty for the directory itself.
+	overflow bool   // overflow tells that some changes may have been lost.
+}
+
+// notifier is the operating system facility that reports changes in directories.
+type notifier interface {
+	add(dir string) (wd int, err error)
+	events() <-chan event
+	errors() <-chan error
+	close() error
+}
+
+/*
+Run watches the targets and calls onChange once after each burst of changes, until SIGTERM or SIGINT arrives from the
+signals channel, in which case the return value is nil. SIGHUP calls onChange right away. The watches are renewed after
+each call to onChange, so that newly created directories are watched too, and so are the targets that onChange may
+have changed.
+*/
+func (w *Watcher) Run(onChange func(), signals <-chan os.Signal) error {
+	n, err := newNotifier()
+	if err != nil {
+		return err
+	}
+	defer n.close()
+	filters := w.addWatches(n)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				return nil
+			}
+			onChange()
+			filters = w.addWatches(n)
+		case ev := <-n.events():
+			if names, watched := filters[ev.wd]; ev.overflow || watched && matchName(names, ev.name) {
+				debounce = time.After(w.Debounce)
+			}
+		case err := <-n.errors():
+			return err
+		case <-debounce:
+			debounce = nil
+			onChange()
+			filters = w.addWatches(n)
+		}
+	}
+}
+
+// matchName returns true if the name is among the names, or if an empty string is among them, which matches all names.
+func matchName(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == "" || candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+addWatches watches the directory of each target for the target's own creation and removal, and the target itself along
+with its sub-directories if it is a directory. The returned watch descriptors map to the names of interesting files in
+the directory, an empty name stands for all files. Directories that do not exist are not watched.
+*/
+func (w *Watcher) addWatches(n notifier) map[int][]string {
+	filters := make(map[int][]string)
+	watch := func(dir, name string) {
+		if wd, err := n.add(dir); err == nil {
+			filters[wd] = append(filters[wd], name)
+		}
+	}
+	var watchTree func(dir string, depth int)
+	watchTree = func(dir string, depth int) {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return
+		}
+		watch(dir, "")
+		if depth <= 0 {
+			return
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			watchTree(path.Join(dir, entry.Name()), depth-1)
+		}
+	}
+	for _, target := range w.Targets {
+		watch(path.Dir(target.Path), path.Base(target.Path))
+		watchTree(target.Path, target.Depth)
+	}
+	return filters
+}
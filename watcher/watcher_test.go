@@ -0,0 +1,107 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana-firewall-TestWatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defs := path.Join(dir, "defs")
+	w := &Watcher{
+		Targets:  []Target{{Path: defs, Depth: 1}, {Path: path.Join(dir, "sysconfig")}},
+		Debounce: 50 * time.Millisecond,
+	}
+	changes := make(chan struct{}, 10)
+	signals := make(chan os.Signal)
+	done := make(chan error)
+	extra := path.Join(dir, "extra")
+	go func() {
+		done <- w.Run(func() {
+			// The function may add targets, e.g. the configuration of a newly discovered HANA system
+			if len(w.Targets) == 2 {
+				w.Targets = append(w.Targets, Target{Path: extra})
+			}
+			changes <- struct{}{}
+		}, signals)
+	}()
+	// Give the watcher a moment to set up its watches
+	time.Sleep(100 * time.Millisecond)
+
+	expectChange := func(what string) {
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change noticed after", what)
+		}
+		select {
+		case <-changes:
+			t.Fatal("more than one change noticed after", what)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	expectNothing := func(what string) {
+		select {
+		case <-changes:
+			t.Fatal("unexpected change noticed after", what)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	writeFile := func(filePath string) {
+		if err := ioutil.WriteFile(filePath, []byte("TCP=\"1\"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The definition directory does not exist at first
+	if err := os.Mkdir(defs, 0700); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("creating directory")
+	// A burst of changes is noticed only once
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(path.Join(defs, name))
+	}
+	expectChange("writing files")
+	// Newly created sub-directories are watched as well
+	if err := os.Mkdir(path.Join(defs, "a.conf.d"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("creating sub-directory")
+	writeFile(path.Join(defs, "a.conf.d", "x.conf"))
+	expectChange("writing drop-in")
+	// Only the targets are interesting among the files of their parent directory
+	writeFile(path.Join(dir, "unrelated"))
+	expectNothing("writing unrelated file")
+	writeFile(path.Join(dir, "sysconfig"))
+	expectChange("writing sysconfig")
+	writeFile(extra)
+	expectChange("writing a target added by the function")
+	if err := os.Remove(path.Join(defs, "b")); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("removing file")
+	// SIGHUP calls the function right away, SIGTERM stops the watcher
+	signals <- syscall.SIGHUP
+	expectChange("SIGHUP")
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not stop")
+	}
+}